@@ -0,0 +1,203 @@
+package blaim
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// TimeWindow restricts accept log entries to those accepted within [Since, Until).
+// A zero Since or Until leaves that end of the window open.
+type TimeWindow struct {
+	Since time.Time
+	Until time.Time
+}
+
+// Contains reports whether t falls within the window. Entries with an unknown
+// (zero) timestamp are always considered to be within the window, since we
+// can't tell when they were accepted.
+func (w TimeWindow) Contains(t time.Time) bool {
+	if t.IsZero() {
+		return true
+	}
+	if !w.Since.IsZero() && t.Before(w.Since) {
+		return false
+	}
+	if !w.Until.IsZero() && !t.Before(w.Until) {
+		return false
+	}
+	return true
+}
+
+// ParsePolicy controls how malformed accept log lines are handled.
+type ParsePolicy int
+
+const (
+	// ParseDefault fails on lines that look like accept log entries but
+	// don't contain valid JSON, and ignores lines that don't look like entries
+	// at all, since the VS Code output channel may contain arbitrary text.
+	ParseDefault ParsePolicy = iota
+	// ParseStrict fails on any non-empty line that isn't a valid entry.
+	ParseStrict
+	// ParseLenient never fails, and skips any line that isn't a valid entry.
+	ParseLenient
+)
+
+// AcceptLogOptions controls which accept log entries are read, and how
+// strictly.
+type AcceptLogOptions struct {
+	Window TimeWindow
+	Policy ParsePolicy
+	// NormalizeFileName, if non-nil, rewrites the file name of every entry,
+	// e.g. to make names recorded relative to an editor's workspace relative to
+	// the root of the repository instead.
+	NormalizeFileName func(fileName string) string
+	// IncludeCompletions makes EventCompleted entries, as recorded by blaim
+	// proxy, attributable. They're ignored otherwise, since most completions
+	// a model returns are never accepted.
+	IncludeCompletions bool
+}
+
+// AcceptLogProblem describes a line of the accept log that couldn't be used.
+type AcceptLogProblem struct {
+	// LineNumber is the 1-based line number in the accept log.
+	LineNumber int
+	// Failed is true if the line looked like an entry but couldn't be parsed,
+	// and false if it didn't look like an entry at all.
+	Failed bool
+	Err    error
+}
+
+func (p AcceptLogProblem) String() string {
+	return fmt.Sprintf("line %d: %v", p.LineNumber, p.Err)
+}
+
+// AcceptLogReport summarizes what happened to each line of an accept log.
+type AcceptLogReport struct {
+	// Parsed is the number of entries within the time window that inserted text into a file.
+	Parsed int
+	// Ignored is the number of entries within the time window that didn't insert text
+	// (e.g. shown or rejected suggestions), or were superseded by a later entry for
+	// the same suggestion.
+	Ignored int
+	// Used is the number of parsed entries that matched text in the diff.
+	Used int
+	// OutsideWindow is the number of valid entries that fell outside the time window.
+	OutsideWindow int
+	// Skipped is the number of non-empty lines that weren't accept log entries.
+	Skipped int
+	// Failed is the number of lines that looked like entries but couldn't be parsed.
+	Failed   int
+	Problems []AcceptLogProblem
+}
+
+func (r *AcceptLogReport) addProblem(p AcceptLogProblem) {
+	if p.Failed {
+		r.Failed++
+	} else {
+		r.Skipped++
+	}
+	r.Problems = append(r.Problems, p)
+}
+
+// Err returns an error listing every problem that is fatal under policy,
+// or nil if there aren't any.
+func (r *AcceptLogReport) Err(policy ParsePolicy) error {
+	fatal := []string{}
+	for _, p := range r.Problems {
+		if policy == ParseLenient || (policy == ParseDefault && !p.Failed) {
+			continue
+		}
+		fatal = append(fatal, p.String())
+	}
+	if len(fatal) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d malformed accept log lines:\n%s", len(fatal), strings.Join(fatal, "\n"))
+}
+
+// Write prints a summary of the report, followed by every problem found.
+func (r *AcceptLogReport) Write(out io.Writer) {
+	fmt.Fprintf(out, "accept log: %d used, %d unused, %d ignored, %d outside time window, %d skipped, %d failed\n",
+		r.Used, r.Parsed-r.Used, r.Ignored, r.OutsideWindow, r.Skipped, r.Failed)
+	for _, p := range r.Problems {
+		fmt.Fprintf(out, "  %s\n", p)
+	}
+}
+
+// ReadAcceptLog parses the contents of a "accepted.suggestions.log" file which the
+// VS Code extension has been writing entries to as the user has edited code and
+// been shown, accepted or rejected AI-generated suggestions. Returns every entry
+// logged within opts.Window, in log order. Every line that can't be parsed is
+// recorded in the returned report, and an error is returned if any of them are
+// fatal under opts.Policy.
+func ReadAcceptLog(in io.Reader, opts AcceptLogOptions) ([]*AcceptLogLine, *AcceptLogReport, error) {
+	ret := []*AcceptLogLine{}
+	report := &AcceptLogReport{}
+
+	b, err := io.ReadAll(in)
+	if err != nil {
+		return nil, nil, err
+	}
+	lines := strings.Split(string(b), "\n")
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		parsed, err := ParseAcceptLogLine(line)
+		if err != nil {
+			report.addProblem(AcceptLogProblem{LineNumber: i + 1, Failed: true, Err: err})
+			continue
+		}
+		if parsed == nil {
+			report.addProblem(AcceptLogProblem{LineNumber: i + 1, Err: fmt.Errorf("not an accept log entry: %.40q", line)})
+			continue
+		}
+		if !opts.Window.Contains(parsed.Timestamp) {
+			report.OutsideWindow++
+			continue
+		}
+		if opts.NormalizeFileName != nil {
+			parsed.FileName = opts.NormalizeFileName(parsed.FileName)
+		}
+		ret = append(ret, parsed)
+	}
+	if err := report.Err(opts.Policy); err != nil {
+		return nil, report, err
+	}
+	return ret, report, nil
+}
+
+// ReadAttributableAccepts reads the accept log and groups the entries that
+// inserted text into a file (full and partial accepts, and edits made after
+// accepting) by file name. When several such entries share a SuggestionID, only
+// the last one is kept, since it reflects the text that ended up in the file.
+func ReadAttributableAccepts(in io.Reader, opts AcceptLogOptions) (map[string][]*AcceptLogLine, *AcceptLogReport, error) {
+	entries, report, err := ReadAcceptLog(in, opts)
+	if err != nil {
+		return nil, report, err
+	}
+
+	lastForSuggestion := map[string]int{}
+	for i, entry := range entries {
+		if entry.SuggestionID != "" && entry.AttributedText() != "" {
+			lastForSuggestion[entry.SuggestionID] = i
+		}
+	}
+
+	ret := map[string][]*AcceptLogLine{}
+	for i, entry := range entries {
+		if entry.AttributedText() == "" || (entry.EventType() == EventCompleted && !opts.IncludeCompletions) {
+			report.Ignored++
+			continue
+		}
+		if entry.SuggestionID != "" && lastForSuggestion[entry.SuggestionID] != i {
+			report.Ignored++
+			continue
+		}
+		report.Parsed++
+		ret[entry.FileName] = append(ret[entry.FileName], entry)
+	}
+	return ret, report, nil
+}
@@ -0,0 +1,136 @@
+package blaim
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTimeWindowContains(t *testing.T) {
+	since := time.Date(2024, 6, 10, 0, 0, 0, 0, time.UTC)
+	until := time.Date(2024, 6, 11, 0, 0, 0, 0, time.UTC)
+	for _, test := range []struct {
+		name     string
+		window   TimeWindow
+		t        time.Time
+		expected bool
+	}{
+		{"open window", TimeWindow{}, since, true},
+		{"unknown timestamp", TimeWindow{Since: since, Until: until}, time.Time{}, true},
+		{"before since", TimeWindow{Since: since}, since.Add(-time.Second), false},
+		{"at since", TimeWindow{Since: since}, since, true},
+		{"before until", TimeWindow{Until: until}, until.Add(-time.Second), true},
+		{"at until", TimeWindow{Until: until}, until, false},
+	} {
+		if got := test.window.Contains(test.t); got != test.expected {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, got)
+		}
+	}
+}
+
+func TestReadAttributableAccepts(t *testing.T) {
+	logText := `2024-06-10 15:42:42.061 [info] {"fileName":"playground.js","position":{"line":25,"character":0},"text":"function test() {\n  return 1;\n}","inferenceConfig":{"modelName":"codegemma","temperature":0.2,"maxTokens":20}}`
+	acceptsForFile, _, err := ReadAttributableAccepts(strings.NewReader(logText), AcceptLogOptions{})
+	if err != nil {
+		t.Errorf("error processing accept log: %v", err)
+	}
+	if len(acceptsForFile["playground.js"]) != 1 {
+		t.Errorf("expected 1 accept, got %d", len(acceptsForFile["playground.js"]))
+	}
+}
+
+const eventsAcceptLogText = `2024-06-10 15:40:00.000 [info] {"event":"shown","suggestionId":"1","fileName":"a.js","text":"foo(a, b);","inferenceConfig":{"modelName":"codegemma"}}
+2024-06-10 15:40:01.000 [info] {"event":"partiallyAccepted","suggestionId":"1","partialAcceptKind":"word","fileName":"a.js","text":"foo(a, b);","acceptedText":"foo(","inferenceConfig":{"modelName":"codegemma"}}
+2024-06-10 15:40:02.000 [info] {"event":"partiallyAccepted","suggestionId":"1","partialAcceptKind":"word","fileName":"a.js","text":"foo(a, b);","acceptedText":"foo(a, ","inferenceConfig":{"modelName":"codegemma"}}
+2024-06-10 15:41:00.000 [info] {"event":"shown","suggestionId":"2","fileName":"a.js","text":"bar();","inferenceConfig":{"modelName":"codegemma"}}
+2024-06-10 15:41:01.000 [info] {"event":"rejected","suggestionId":"2","fileName":"a.js","text":"bar();","inferenceConfig":{"modelName":"codegemma"}}
+2024-06-10 15:42:00.000 [info] {"event":"shown","suggestionId":"3","fileName":"a.js","text":"baz();","inferenceConfig":{"modelName":"codellama"}}
+2024-06-10 15:42:01.000 [info] {"suggestionId":"3","fileName":"a.js","text":"baz();","inferenceConfig":{"modelName":"codellama"}}
+2024-06-10 15:42:05.000 [info] {"event":"editedAfterAccept","suggestionId":"3","fileName":"a.js","text":"baz();","editedText":"baz(1);","inferenceConfig":{"modelName":"codellama"}}
+2024-06-10 15:43:00.000 [info] {"fileName":"a.js","text":"legacy();","inferenceConfig":{"modelName":"stable-code"}}
+`
+
+func TestReadAttributableAcceptsEvents(t *testing.T) {
+	acceptsForFile, report, err := ReadAttributableAccepts(strings.NewReader(eventsAcceptLogText), AcceptLogOptions{})
+	if err != nil {
+		t.Fatalf("error processing accept log: %v", err)
+	}
+	got := []string{}
+	for _, accept := range acceptsForFile["a.js"] {
+		got = append(got, accept.AttributedText())
+	}
+	// Only the latest partial accept and the edit of each suggestion should be attributed.
+	expected := []string{"foo(a, ", "baz(1);", "legacy();"}
+	if strings.Join(got, "|") != strings.Join(expected, "|") {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+	if report.Parsed != 3 || report.Ignored != 6 {
+		t.Errorf("expected 3 parsed and 6 ignored, got %+v", report)
+	}
+}
+
+const malformedAcceptLogText = `2024-06-10 15:40:00.000 [info] {"fileName":"a.js","text":"ok();"}
+Extension host started
+
+2024-06-10 15:41:00.000 [info] {"fileName":"a.js","text":
+2024-06-10 15:42:00.000 [info] {"fileName":"b.js","text":"ok();"}
+`
+
+func TestReadAttributableAcceptsPolicies(t *testing.T) {
+	for _, test := range []struct {
+		name        string
+		policy      ParsePolicy
+		expectError string
+	}{
+		{name: "default", policy: ParseDefault, expectError: "line 4:"},
+		{name: "strict", policy: ParseStrict, expectError: "2 malformed accept log lines:\nline 2: not an accept log entry"},
+		{name: "lenient", policy: ParseLenient},
+	} {
+		acceptsForFile, report, err := ReadAttributableAccepts(strings.NewReader(malformedAcceptLogText), AcceptLogOptions{Policy: test.policy})
+		if report.Skipped != 1 || report.Failed != 1 {
+			t.Errorf("%s: expected 1 skipped and 1 failed, got %+v", test.name, report)
+		}
+		if test.expectError != "" {
+			if err == nil || !strings.Contains(err.Error(), test.expectError) {
+				t.Errorf("%s: expected error containing %q, got %v", test.name, test.expectError, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+		}
+		if report.Parsed != 2 || len(acceptsForFile["a.js"]) != 1 || len(acceptsForFile["b.js"]) != 1 {
+			t.Errorf("%s: expected 1 accept each for a.js and b.js, got %v", test.name, acceptsForFile)
+		}
+	}
+}
+
+func TestReadAcceptLogWindow(t *testing.T) {
+	window := TimeWindow{Since: time.Date(2024, 6, 10, 15, 41, 0, 0, time.Local)}
+	entries, report, err := ReadAcceptLog(strings.NewReader(malformedAcceptLogText), AcceptLogOptions{Window: window, Policy: ParseLenient})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].FileName != "b.js" || report.OutsideWindow != 1 {
+		t.Errorf("expected only the b.js entry, got %v and %+v", entries, report)
+	}
+}
+
+func TestReadAttributableAcceptsNormalizeFileName(t *testing.T) {
+	logText := `2024-06-10 15:40:00.000 [info] {"fileName":"playground.js","text":"a();"}
+2024-06-10 15:41:00.000 [info] {"fileName":"blaim/vscode-extension/playground.js","text":"b();"}
+`
+	opts := AcceptLogOptions{NormalizeFileName: func(fileName string) string {
+		if strings.HasPrefix(fileName, "blaim/") {
+			return fileName
+		}
+		return "blaim/vscode-extension/" + fileName
+	}}
+	acceptsForFile, _, err := ReadAttributableAccepts(strings.NewReader(logText), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(acceptsForFile) != 1 || len(acceptsForFile["blaim/vscode-extension/playground.js"]) != 2 {
+		t.Errorf("expected both entries under the normalized name, got %v", acceptsForFile)
+	}
+}
@@ -1,10 +1,19 @@
+// Package blaim reads, writes and generates attributions of machine-generated
+// code: .blaim files, the accept logs they are generated from, and the line
+// ranges they describe. The blaim CLI in ./cmd is built on it.
 package blaim
 
 import (
 	"encoding/json"
 	"strings"
+	"time"
 )
 
+// AcceptLogTimestampLayout is the layout of the timestamp that the VS Code
+// output channel logger writes at the start of each accept log line, e.g.
+// "2024-06-10 15:42:42.061 [info] {...}". The timestamp is in local time.
+const AcceptLogTimestampLayout = "2006-01-02 15:04:05.000"
+
 // BlaimLine represents an entry in a .blaim file.
 // Each entry describes a single range of text in
 // a named source code file.  The description of the
@@ -21,6 +30,41 @@ type BlaimLine struct {
 	// InferenceConfig describes the request sent to the code-generating model,
 	// (e.g. the name of the model, temperature etc).
 	InferenceConfig InferenceConfig `json:"inferenceConfig"`
+	// Signature, if present, signs the rest of the entry so that edits to it can be detected.
+	Signature *Signature `json:"signature,omitempty"`
+}
+
+// SignatureFormat identifies how a Signature was made.
+type SignatureFormat string
+
+const (
+	// SignatureEd25519 is a raw ed25519 signature of the signing payload.
+	SignatureEd25519 SignatureFormat = "ed25519"
+	// SignatureSSH is an armored SSH signature of the signing payload, in the
+	// same format as "ssh-keygen -Y sign" and git's SSH commit signing produce.
+	SignatureSSH SignatureFormat = "ssh"
+)
+
+// SSHSignatureNamespace is the namespace that SSH signatures of BlaimLines are
+// made in, so they can't be confused with signatures made for other purposes.
+const SSHSignatureNamespace = "blaim"
+
+// Signature is a signature over the SigningPayload of a BlaimLine.
+type Signature struct {
+	Format SignatureFormat `json:"format"`
+	// PublicKey is the signer's public key in authorized_keys format
+	// (e.g. "ssh-ed25519 AAAA..."), for both signature formats.
+	PublicKey string `json:"publicKey"`
+	// Value is the base64-encoded signature for SignatureEd25519, or the
+	// armored signature for SignatureSSH.
+	Value string `json:"value"`
+}
+
+// SigningPayload returns the bytes that a Signature of b signs: the JSON
+// encoding of b without its Signature.
+func (b BlaimLine) SigningPayload() ([]byte, error) {
+	b.Signature = nil
+	return json.Marshal(b)
 }
 
 type Position struct {
@@ -51,12 +95,90 @@ type InferenceConfig struct {
 	Delay       int     `json:"delay"`
 }
 
+// EventType identifies what happened to a code suggestion in an accept log entry.
+type EventType string
+
+const (
+	// EventAccepted means the user accepted the whole suggestion. Entries
+	// written before event types were introduced have an empty EventType, which
+	// also means EventAccepted.
+	EventAccepted EventType = "accepted"
+	// EventShown means the suggestion was displayed to the user.
+	EventShown EventType = "shown"
+	// EventRejected means the user dismissed the suggestion, or kept typing
+	// until it no longer applied.
+	EventRejected EventType = "rejected"
+	// EventPartiallyAccepted means the user accepted a prefix of the suggestion
+	// (e.g. with accept-word or accept-line). AcceptedText holds the text
+	// accepted so far, so a later partial accept of the same suggestion
+	// supersedes an earlier one.
+	EventPartiallyAccepted EventType = "partiallyAccepted"
+	// EventEditedAfterAccept means the user changed an accepted suggestion
+	// before committing it. EditedText holds the text after the edit.
+	EventEditedAfterAccept EventType = "editedAfterAccept"
+	// EventCompleted means a model returned the suggestion, as recorded by a
+	// proxy between the editor and the model rather than by the editor. It's
+	// unknown whether the suggestion was accepted, or which file it was for, so
+	// if AcceptLogOptions.IncludeCompletions is set, it's attributed wherever
+	// its text appears exactly in a diff.
+	EventCompleted EventType = "completed"
+)
+
+// PartialAcceptKind identifies how a partial accept was made.
+type PartialAcceptKind string
+
+const (
+	PartialAcceptWord PartialAcceptKind = "word"
+	PartialAcceptLine PartialAcceptKind = "line"
+)
+
 type AcceptLogLine struct {
+	// Timestamp is the time at which the suggestion was accepted, as parsed from
+	// the log line prefix. It is the zero time if the prefix could not be parsed.
+	Timestamp       time.Time       `json:"-"`
 	FileName        string          `json:"fileName"`
 	Position        Position        `json:"position"`
 	Text            string          `json:"text"`
 	HeadGitCommit   GitCommit       `json:"headGitCommit"`
 	InferenceConfig InferenceConfig `json:"inferenceConfig"`
+	// Event is what happened to the suggestion. Empty means EventAccepted.
+	Event EventType `json:"event,omitempty"`
+	// SuggestionID identifies the suggestion across the events logged for it,
+	// e.g. shown, then partially accepted, then edited.
+	SuggestionID string `json:"suggestionId,omitempty"`
+	// PartialAcceptKind is set for EventPartiallyAccepted entries.
+	PartialAcceptKind PartialAcceptKind `json:"partialAcceptKind,omitempty"`
+	// AcceptedText is the prefix of Text accepted so far, for EventPartiallyAccepted entries.
+	AcceptedText string `json:"acceptedText,omitempty"`
+	// EditedText is the text that replaced Text, for EventEditedAfterAccept entries.
+	EditedText string `json:"editedText,omitempty"`
+	// PromptHash is the hex SHA-256 hash of the prompt the suggestion was
+	// generated from, for EventCompleted entries.
+	PromptHash string `json:"promptHash,omitempty"`
+}
+
+// EventType returns what happened to the suggestion, treating entries with no
+// event type as EventAccepted.
+func (l *AcceptLogLine) EventType() EventType {
+	if l.Event == "" {
+		return EventAccepted
+	}
+	return l.Event
+}
+
+// AttributedText returns the text that this entry inserted into the file, or
+// the empty string if the entry didn't insert any text (e.g. EventShown or
+// EventRejected).
+func (l *AcceptLogLine) AttributedText() string {
+	switch l.EventType() {
+	case EventAccepted, EventCompleted:
+		return l.Text
+	case EventPartiallyAccepted:
+		return l.AcceptedText
+	case EventEditedAfterAccept:
+		return l.EditedText
+	}
+	return ""
 }
 
 func ParseAcceptLogLine(logLine string) (*AcceptLogLine, error) {
@@ -69,5 +191,20 @@ func ParseAcceptLogLine(logLine string) (*AcceptLogLine, error) {
 	jsonText := logLine[jsonStart+2:]
 	line := &AcceptLogLine{}
 	err := json.Unmarshal([]byte(jsonText), &line)
+	line.Timestamp = parseAcceptLogTimestamp(logLine[:jsonStart])
 	return line, err
 }
+
+// parseAcceptLogTimestamp parses the timestamp from a log line prefix such as
+// "2024-06-10 15:42:42.061 [info". Returns the zero time if the prefix doesn't
+// start with a timestamp in the expected layout.
+func parseAcceptLogTimestamp(prefix string) time.Time {
+	if levelStart := strings.LastIndex(prefix, " ["); levelStart != -1 {
+		prefix = prefix[:levelStart]
+	}
+	t, err := time.ParseInLocation(AcceptLogTimestampLayout, strings.TrimSpace(prefix), time.Local)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
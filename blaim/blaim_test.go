@@ -3,6 +3,7 @@ package blaim
 import (
 	"reflect"
 	"testing"
+	"time"
 )
 
 func TestParseAcceptLogLine(t *testing.T) {
@@ -16,9 +17,10 @@ func TestParseAcceptLogLine(t *testing.T) {
 			logLine: `2024-05-31 14:14:17.804 [info] {"fileName":"inline-completions/playground.js","position":{"line":20,"character":9},"text":"foo(){\n  return \"bar\";\n}","headGitCommit":{"type":0,"name":"logaccepts","commit":"f0d3f3eea79cff732255067ba85588a2bbc4d7c3","ahead":0,"behind":0}
 		,"inferenceConfig":{"endpoint":"http://127.0.0.1:11434","maxLines":16,"maxTokens":256,"temperature":0.2,"modelName":"stable-code:3b-code-q4_0","modelFormat":"stable-code","delay":250}}`,
 			expected: &AcceptLogLine{
-				FileName: "inline-completions/playground.js",
-				Position: Position{20, 9},
-				Text:     "foo(){\n  return \"bar\";\n}",
+				Timestamp: time.Date(2024, 5, 31, 14, 14, 17, 804000000, time.Local),
+				FileName:  "inline-completions/playground.js",
+				Position:  Position{20, 9},
+				Text:      "foo(){\n  return \"bar\";\n}",
 				HeadGitCommit: GitCommit{
 					Type:   0,
 					Name:   "logaccepts",
@@ -47,3 +49,46 @@ func TestParseAcceptLogLine(t *testing.T) {
 		}
 	}
 }
+
+func TestParseAcceptLogTimestamp(t *testing.T) {
+	for _, test := range []struct {
+		prefix   string
+		expected time.Time
+	}{
+		{
+			prefix:   "2024-06-10 15:42:42.061 [info",
+			expected: time.Date(2024, 6, 10, 15, 42, 42, 61000000, time.Local),
+		},
+		{
+			prefix:   "[info",
+			expected: time.Time{},
+		},
+		{
+			prefix:   "not a timestamp [info",
+			expected: time.Time{},
+		},
+	} {
+		got := parseAcceptLogTimestamp(test.prefix)
+		if !got.Equal(test.expected) {
+			t.Errorf("%q: expected %v, got %v", test.prefix, test.expected, got)
+		}
+	}
+}
+
+func TestAttributedText(t *testing.T) {
+	for _, test := range []struct {
+		line     AcceptLogLine
+		expected string
+	}{
+		{AcceptLogLine{Text: "foo()"}, "foo()"},
+		{AcceptLogLine{Event: EventAccepted, Text: "foo()"}, "foo()"},
+		{AcceptLogLine{Event: EventShown, Text: "foo()"}, ""},
+		{AcceptLogLine{Event: EventRejected, Text: "foo()"}, ""},
+		{AcceptLogLine{Event: EventPartiallyAccepted, Text: "foo()", AcceptedText: "foo"}, "foo"},
+		{AcceptLogLine{Event: EventEditedAfterAccept, Text: "foo()", EditedText: "foo(1)"}, "foo(1)"},
+	} {
+		if got := test.line.AttributedText(); got != test.expected {
+			t.Errorf("%q event: expected %q, got %q", test.line.Event, test.expected, got)
+		}
+	}
+}
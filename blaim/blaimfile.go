@@ -0,0 +1,42 @@
+package blaim
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// ReadBlaimFile reads the contents of a .blaim file, and groups its BlaimLines
+// by the name of the source file they describe. A .blaim file may contain
+// several JSON arrays of BlaimLines one after another, as written by
+// WriteBlaimLines for each file in a diff.
+func ReadBlaimFile(r io.Reader) (map[string][]*BlaimLine, error) {
+	dec := json.NewDecoder(r)
+	blaimLines := []*BlaimLine{}
+	for {
+		decoded := []*BlaimLine{}
+		err := dec.Decode(&decoded)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("error decoding BlaimLines: %v", err)
+		}
+		blaimLines = append(blaimLines, decoded...)
+	}
+	blaimLinesByFile := map[string][]*BlaimLine{}
+	for _, blaimLine := range blaimLines {
+		blaimLinesByFile[blaimLine.FileName] = append(blaimLinesByFile[blaimLine.FileName], blaimLine)
+	}
+	return blaimLinesByFile, nil
+}
+
+// WriteBlaimLines writes blaimLines to w as an indented JSON array, in the
+// format ReadBlaimFile reads.
+func WriteBlaimLines(w io.Writer, blaimLines []BlaimLine) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(blaimLines); err != nil {
+		return fmt.Errorf("error marshaling blaimLines: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package blaim
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestReadBlaimFileMultipleArrays(t *testing.T) {
+	text := `[{"fileName": "a.js"}, {"fileName": "b.js"}]
+[{"fileName": "a.js"}]
+`
+	blaimLinesByFile, err := ReadBlaimFile(strings.NewReader(text))
+	if err != nil {
+		t.Errorf("error reading blaim file: %v", err)
+	}
+	if len(blaimLinesByFile["a.js"]) != 2 || len(blaimLinesByFile["b.js"]) != 1 {
+		t.Errorf("expected 2 blaim lines for a.js and 1 for b.js, got %v", blaimLinesByFile)
+	}
+}
+
+func TestWriteBlaimLines(t *testing.T) {
+	out := &bytes.Buffer{}
+	lines := []BlaimLine{
+		{FileName: "a.js", Range: Range{Start: Position{Line: 1}, End: Position{Line: 2}}, Text: "x"},
+		{FileName: "b.js", Text: "y"},
+	}
+	if err := WriteBlaimLines(out, lines[:1]); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteBlaimLines(out, lines[1:]); err != nil {
+		t.Fatal(err)
+	}
+	blaimLinesByFile, err := ReadBlaimFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blaimLinesByFile) != 2 || *blaimLinesByFile["a.js"][0] != lines[0] || *blaimLinesByFile["b.js"][0] != lines[1] {
+		t.Errorf("expected %v, got %v", lines, blaimLinesByFile)
+	}
+
+	if _, err := ReadBlaimFile(strings.NewReader(`[{"fileName": `)); err == nil {
+		t.Errorf("expected an error for truncated input")
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/banksean/me3/blaim"
+
+	"github.com/chzyer/readline"
+)
+
+// annotationPrefixData is what a --prefix-format template is executed with,
+// for the first BlaimLine that covers a line. The fields of its
+// InferenceConfig, such as ModelName and Temperature, are available directly.
+type annotationPrefixData struct {
+	blaim.InferenceConfig
+	FileName string
+	// Start and End are the first and last lines of the generated span.
+	Start  int
+	End    int
+	Signed bool
+}
+
+// newPrefixFormatter returns a function formatting annotation prefixes with
+// the text/template format, e.g. "[{{.ModelName}}] ". The template is tried
+// out on an empty BlaimLine, so that mistakes like unknown fields are
+// reported before any output is written.
+func newPrefixFormatter(format string) (func(*blaim.BlaimLine) string, error) {
+	tmpl, err := template.New("prefix").Parse(format)
+	if err != nil {
+		return nil, fmt.Errorf("invalid prefix format: %v", err)
+	}
+	execute := func(line *blaim.BlaimLine) (string, error) {
+		b := &strings.Builder{}
+		err := tmpl.Execute(b, annotationPrefixData{
+			InferenceConfig: line.InferenceConfig,
+			FileName:        line.FileName,
+			Start:           line.Range.Start.Line,
+			End:             line.Range.End.Line,
+			Signed:          line.Signature != nil,
+		})
+		// Newlines in the prefix would break the alignment of every line after it.
+		return strings.ReplaceAll(b.String(), "\n", " "), err
+	}
+	if _, err := execute(&blaim.BlaimLine{}); err != nil {
+		return nil, fmt.Errorf("invalid prefix format: %v", err)
+	}
+	return func(line *blaim.BlaimLine) string {
+		prefix, _ := execute(line)
+		return prefix
+	}, nil
+}
+
+// Color modes for --color, as git has them.
+const (
+	colorAuto   = "auto"
+	colorAlways = "always"
+	colorNever  = "never"
+)
+
+// useColor reports whether output to out should be colored in the given mode.
+// In auto mode it is if out is a terminal, unless NO_COLOR is set or the
+// terminal is dumb.
+func useColor(mode string, out *os.File) (bool, error) {
+	switch mode {
+	case colorAlways:
+		return true, nil
+	case colorNever:
+		return false, nil
+	case colorAuto, "":
+		if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+			return false, nil
+		}
+		return readline.IsTerminal(int(out.Fd())), nil
+	}
+	return false, fmt.Errorf("invalid color mode %q: expected %s, %s or %s", mode, colorAuto, colorAlways, colorNever)
+}
+
+// modelColorPalette are the foreground colors given to models, in order.
+var modelColorPalette = []string{
+	"\x1b[32m", // green
+	"\x1b[36m", // cyan
+	"\x1b[35m", // magenta
+	"\x1b[33m", // yellow
+	"\x1b[34m", // blue
+	"\x1b[31m", // red
+}
+
+// assignModelColors gives each model that generated any of blaimLinesByFile a
+// color from the palette, in order of model name, reusing colors if there are
+// more models than colors.
+func assignModelColors(blaimLinesByFile map[string][]*blaim.BlaimLine) map[string]string {
+	models := map[string]bool{}
+	for _, lines := range blaimLinesByFile {
+		for _, line := range lines {
+			models[line.InferenceConfig.ModelName] = true
+		}
+	}
+	names := []string{}
+	for model := range models {
+		names = append(names, model)
+	}
+	sort.Strings(names)
+	ret := map[string]string{}
+	for i, model := range names {
+		ret[model] = modelColorPalette[i%len(modelColorPalette)]
+	}
+	return ret
+}
+
+// writeModelLegend writes a line naming each model in its color.
+func writeModelLegend(out io.Writer, colors map[string]string) {
+	models := []string{}
+	for model := range colors {
+		models = append(models, model)
+	}
+	sort.Strings(models)
+	entries := []string{}
+	for _, model := range models {
+		entries = append(entries, colors[model]+"■ "+model+ansiReset)
+	}
+	fmt.Fprintf(out, "%sgenerated by:%s %s\n", ansiDim, ansiReset, strings.Join(entries, "  "))
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/banksean/me3/blaim"
+)
+
+func TestNewPrefixFormatter(t *testing.T) {
+	line := &blaim.BlaimLine{
+		FileName:        "main.go",
+		Range:           blaim.Range{Start: blaim.Position{Line: 3}, End: blaim.Position{Line: 5}},
+		InferenceConfig: blaim.InferenceConfig{ModelName: "codegemma", Temperature: 0.2, MaxTokens: 20},
+	}
+	for _, test := range []struct {
+		format, expected string
+	}{
+		{`[{{.ModelName}}, temp: {{printf "%.1f" .Temperature}}] `, formatAnnotationLinePrefix(line)},
+		{"{{.FileName}}:{{.Start}}-{{.End}} {{.MaxTokens}} {{if .Signed}}signed{{else}}unsigned{{end}} ", "main.go:3-5 20 unsigned "},
+		{"{{.ModelName}}\n", "codegemma "},
+	} {
+		prefix, err := newPrefixFormatter(test.format)
+		if err != nil {
+			t.Errorf("%q: %v", test.format, err)
+			continue
+		}
+		if got := prefix(line); got != test.expected {
+			t.Errorf("%q: expected %q, got %q", test.format, test.expected, got)
+		}
+	}
+	for _, format := range []string{"{{.ModelName", "{{.Model}}"} {
+		if _, err := newPrefixFormatter(format); err == nil {
+			t.Errorf("%q: expected an error", format)
+		}
+	}
+}
+
+func TestUseColor(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "out"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	t.Setenv("NO_COLOR", "")
+	for mode, expected := range map[string]bool{colorAlways: true, colorNever: false, colorAuto: false} {
+		if got, err := useColor(mode, f); err != nil || got != expected {
+			t.Errorf("%s: expected %v, got %v, %v", mode, expected, got, err)
+		}
+	}
+	if _, err := useColor("sometimes", f); err == nil {
+		t.Errorf("expected an error for an invalid mode")
+	}
+}
+
+func TestAnnotateLinesWithColors(t *testing.T) {
+	blaimLinesByFile := map[string][]*blaim.BlaimLine{
+		"main.go": {
+			{FileName: "main.go", Range: blaim.Range{Start: blaim.Position{Line: 2}, End: blaim.Position{Line: 2}}, InferenceConfig: blaim.InferenceConfig{ModelName: "codellama"}},
+			{FileName: "main.go", Range: blaim.Range{Start: blaim.Position{Line: 3}, End: blaim.Position{Line: 3}}, InferenceConfig: blaim.InferenceConfig{ModelName: "codegemma"}},
+		},
+	}
+	colors := assignModelColors(blaimLinesByFile)
+	if colors["codegemma"] != modelColorPalette[0] || colors["codellama"] != modelColorPalette[1] {
+		t.Errorf("expected colors in order of model name, got %q", colors)
+	}
+
+	out := &bytes.Buffer{}
+	prefix := func(line *blaim.BlaimLine) string { return "[" + line.InferenceConfig.ModelName + "] " }
+	annotateLinesWithPrefix([]byte("a\nb\nc"), blaim.NewBlaimRangeSet(blaimLinesByFile["main.go"]), out, prefix, colors)
+	expected := ansiDim + "            a" + ansiReset + "\n" +
+		modelColorPalette[1] + "[codellama] b" + ansiReset + "\n" +
+		modelColorPalette[0] + "[codegemma] c" + ansiReset + "\n"
+	if out.String() != expected {
+		t.Errorf("expected %q, got %q", expected, out.String())
+	}
+
+	out.Reset()
+	writeModelLegend(out, colors)
+	if !strings.Contains(out.String(), modelColorPalette[0]+"■ codegemma"+ansiReset) || !strings.Contains(out.String(), modelColorPalette[1]+"■ codellama"+ansiReset) {
+		t.Errorf("expected each model in its color, got %q", out.String())
+	}
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/banksean/me3/blaim"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// The in-toto attestation framework is described in
+// https://github.com/in-toto/attestation/tree/main/spec/v1, and the DSSE
+// envelopes that sign statements in
+// https://github.com/secure-systems-lab/dsse/blob/master/protocol.md
+const (
+	inTotoStatementType = "https://in-toto.io/Statement/v1"
+	inTotoPayloadType   = "application/vnd.in-toto+json"
+	// attributionPredicateType identifies the predicate that blaim attest writes.
+	attributionPredicateType = "https://github.com/banksean/me3/blaim/attribution/v1"
+)
+
+// inTotoSubject is an artifact that a statement is about, identified by its
+// digests.
+type inTotoSubject struct {
+	Name   string            `json:"name"`
+	Digest map[string]string `json:"digest"`
+}
+
+type inTotoStatement struct {
+	Type          string               `json:"_type"`
+	Subject       []inTotoSubject      `json:"subject"`
+	PredicateType string               `json:"predicateType"`
+	Predicate     attributionPredicate `json:"predicate"`
+}
+
+// attributionPredicate describes the machine-generated parts of a commit: the
+// contents of its .blaim file, and how many lines each model generated.
+type attributionPredicate struct {
+	Commit    string    `json:"commit"`
+	Author    string    `json:"author"`
+	Time      time.Time `json:"time"`
+	BlaimFile string    `json:"blaimFile"`
+	// Spans are the commit's BlaimLines, sorted by file name and position,
+	// with any record signatures they carry.
+	Spans  []*blaim.BlaimLine `json:"spans"`
+	Models []modelAttribution `json:"models"`
+}
+
+// modelAttribution totals the spans generated by one model with one set of
+// inference parameters.
+type modelAttribution struct {
+	InferenceConfig blaim.InferenceConfig `json:"inferenceConfig"`
+	Spans           int                   `json:"spans"`
+	Lines           int                   `json:"lines"`
+}
+
+// newAttributionStatement returns the statement for c. The subjects are the
+// commit itself, and each attributed file's blob at that commit; fileBlobs maps
+// file names to blob hashes, and files without one are left out.
+func newAttributionStatement(c *commitAttribution, blaimFileName string, fileBlobs map[string]string) *inTotoStatement {
+	st := &inTotoStatement{
+		Type:          inTotoStatementType,
+		Subject:       []inTotoSubject{{Name: c.commit, Digest: map[string]string{"gitCommit": c.commit}}},
+		PredicateType: attributionPredicateType,
+		Predicate: attributionPredicate{
+			Commit:    c.commit,
+			Author:    c.author,
+			Time:      c.time.UTC(),
+			BlaimFile: blaimFileName,
+			Spans:     c.lines,
+			Models:    []modelAttribution{},
+		},
+	}
+	byConfig := map[blaim.InferenceConfig]*modelAttribution{}
+	seenFile := map[string]bool{}
+	for _, line := range c.lines {
+		m, ok := byConfig[line.InferenceConfig]
+		if !ok {
+			m = &modelAttribution{InferenceConfig: line.InferenceConfig}
+			byConfig[line.InferenceConfig] = m
+		}
+		m.Spans++
+		m.Lines += lineCount(line)
+		if blob, ok := fileBlobs[line.FileName]; ok && !seenFile[line.FileName] {
+			seenFile[line.FileName] = true
+			st.Subject = append(st.Subject, inTotoSubject{Name: line.FileName, Digest: map[string]string{"gitBlob": blob}})
+		}
+	}
+	for _, m := range byConfig {
+		st.Predicate.Models = append(st.Predicate.Models, *m)
+	}
+	sort.Slice(st.Predicate.Models, func(i, j int) bool {
+		a, b := st.Predicate.Models[i], st.Predicate.Models[j]
+		if a.InferenceConfig.ModelName != b.InferenceConfig.ModelName {
+			return a.InferenceConfig.ModelName < b.InferenceConfig.ModelName
+		}
+		return fmt.Sprintf("%+v", a.InferenceConfig) < fmt.Sprintf("%+v", b.InferenceConfig)
+	})
+	return st
+}
+
+// readFileBlobs returns the blob hash of each of fileNames at commit in the
+// repository at dir. Files that don't exist at commit are left out.
+func readFileBlobs(dir, commit string, fileNames []string) (map[string]string, error) {
+	ret := map[string]string{}
+	if len(fileNames) == 0 {
+		return ret, nil
+	}
+	out, err := gitOutput(dir, append([]string{"ls-tree", "-z", "--full-tree", commit, "--"}, fileNames...)...)
+	if err != nil {
+		return nil, err
+	}
+	// Each entry is "<mode> SP <type> SP <hash> TAB <path>".
+	for _, entry := range strings.Split(out, "\x00") {
+		meta, path, ok := strings.Cut(entry, "\t")
+		if !ok {
+			continue
+		}
+		if fields := strings.Fields(meta); len(fields) == 3 && fields[1] == "blob" {
+			ret[path] = fields[2]
+		}
+	}
+	return ret, nil
+}
+
+// dsseEnvelope is a signed in-toto statement.
+type dsseEnvelope struct {
+	PayloadType string          `json:"payloadType"`
+	Payload     string          `json:"payload"`
+	Signatures  []dsseSignature `json:"signatures"`
+}
+
+type dsseSignature struct {
+	KeyID string `json:"keyid"`
+	Sig   string `json:"sig"`
+}
+
+// dssePAE returns the pre-authentication encoding of a payload, which is what
+// DSSE signatures actually sign.
+func dssePAE(payloadType string, payload []byte) []byte {
+	return []byte(fmt.Sprintf("DSSEv1 %d %s %d %s", len(payloadType), payloadType, len(payload), payload))
+}
+
+// loadEnvelopeSigner reads an ed25519 private key from path, in either of the
+// formats that loadPrivateKey accepts.
+func loadEnvelopeSigner(path string) (ssh.Signer, error) {
+	signer, _, err := loadPrivateKey(path)
+	if err != nil {
+		return nil, err
+	}
+	if signer.PublicKey().Type() != ssh.KeyAlgoED25519 {
+		return nil, fmt.Errorf("%s: expected an ed25519 key, got %s", path, signer.PublicKey().Type())
+	}
+	return signer, nil
+}
+
+// signStatement wraps st in a DSSE envelope signed by signer. The key ID is
+// the SHA256 fingerprint of the public key, as ssh-keygen -l prints it.
+func signStatement(st *inTotoStatement, signer ssh.Signer) (*dsseEnvelope, error) {
+	payload, err := json.Marshal(st)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := signer.Sign(rand.Reader, dssePAE(inTotoPayloadType, payload))
+	if err != nil {
+		return nil, err
+	}
+	return &dsseEnvelope{
+		PayloadType: inTotoPayloadType,
+		Payload:     base64.StdEncoding.EncodeToString(payload),
+		Signatures: []dsseSignature{{
+			KeyID: ssh.FingerprintSHA256(signer.PublicKey()),
+			Sig:   base64.StdEncoding.EncodeToString(sig.Blob),
+		}},
+	}, nil
+}
+
+// verifyEnvelope checks that envelope has a signature by key over its
+// payload, and returns the statement it carries.
+func verifyEnvelope(envelope *dsseEnvelope, key ssh.PublicKey) (*inTotoStatement, error) {
+	if envelope.PayloadType != inTotoPayloadType {
+		return nil, fmt.Errorf("unexpected payload type %q", envelope.PayloadType)
+	}
+	payload, err := base64.StdEncoding.DecodeString(envelope.Payload)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding payload: %v", err)
+	}
+	keyID := ssh.FingerprintSHA256(key)
+	for _, s := range envelope.Signatures {
+		if s.KeyID != keyID {
+			continue
+		}
+		sig, err := base64.StdEncoding.DecodeString(s.Sig)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding signature: %v", err)
+		}
+		if err := key.Verify(dssePAE(envelope.PayloadType, payload), &ssh.Signature{Format: key.Type(), Blob: sig}); err != nil {
+			return nil, fmt.Errorf("invalid signature by %s: %v", keyID, err)
+		}
+		st := &inTotoStatement{}
+		if err := json.Unmarshal(payload, st); err != nil {
+			return nil, fmt.Errorf("error parsing statement: %v", err)
+		}
+		return st, nil
+	}
+	return nil, fmt.Errorf("no signature by %s", keyID)
+}
+
+// writeAttestations writes a statement for each of commits, or a signed
+// envelope of each if signer is non-nil, one JSON document per line.
+func writeAttestations(out io.Writer, dir, blaimFileName string, commits []*commitAttribution, signer ssh.Signer) error {
+	enc := json.NewEncoder(out)
+	for _, c := range commits {
+		fileNames := []string{}
+		for _, line := range c.lines {
+			if len(fileNames) == 0 || fileNames[len(fileNames)-1] != line.FileName {
+				fileNames = append(fileNames, line.FileName)
+			}
+		}
+		fileBlobs, err := readFileBlobs(dir, c.commit, fileNames)
+		if err != nil {
+			return err
+		}
+		st := newAttributionStatement(c, blaimFileName, fileBlobs)
+		if signer == nil {
+			if err := enc.Encode(st); err != nil {
+				return err
+			}
+			continue
+		}
+		envelope, err := signStatement(st, signer)
+		if err != nil {
+			return fmt.Errorf("error signing statement for %s: %v", c.commit, err)
+		}
+		if err := enc.Encode(envelope); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// commitsInRange returns the commits of attributions that are in the git
+// revision range rangeSpec, in their original order.
+func commitsInRange(dir, rangeSpec string, attributions []*commitAttribution) ([]*commitAttribution, error) {
+	out, err := gitOutput(dir, "rev-list", rangeSpec)
+	if err != nil {
+		return nil, err
+	}
+	inRange := map[string]bool{}
+	for _, commit := range strings.Fields(out) {
+		inRange[commit] = true
+	}
+	ret := []*commitAttribution{}
+	for _, c := range attributions {
+		if inRange[c.commit] {
+			ret = append(ret, c)
+		}
+	}
+	return ret, nil
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/banksean/me3/blaim"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestNewAttributionStatement(t *testing.T) {
+	c := &commitAttribution{
+		commit: "0123abcd",
+		author: "Test",
+		time:   time.Unix(1718034000, 0),
+		lines: []*blaim.BlaimLine{
+			{FileName: "a.go", Range: blaim.Range{Start: blaim.Position{Line: 1}, End: blaim.Position{Line: 3}}, InferenceConfig: blaim.InferenceConfig{ModelName: "codellama"}},
+			{FileName: "a.go", Range: blaim.Range{Start: blaim.Position{Line: 10}, End: blaim.Position{Line: 10}}, InferenceConfig: blaim.InferenceConfig{ModelName: "codegemma"}},
+			{FileName: "deleted.go", Range: blaim.Range{Start: blaim.Position{Line: 1}, End: blaim.Position{Line: 1}}, InferenceConfig: blaim.InferenceConfig{ModelName: "codellama"}},
+		},
+	}
+	st := newAttributionStatement(c, ".blaim", map[string]string{"a.go": "b10b"})
+	b, err := json.Marshal(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		`"_type":"https://in-toto.io/Statement/v1"`,
+		`"subject":[{"name":"0123abcd","digest":{"gitCommit":"0123abcd"}},{"name":"a.go","digest":{"gitBlob":"b10b"}}]`,
+		`"predicateType":"` + attributionPredicateType + `"`,
+		`"time":"2024-06-10T15:40:00Z"`,
+	} {
+		if !strings.Contains(string(b), expected) {
+			t.Errorf("expected %s in %s", expected, b)
+		}
+	}
+	models := st.Predicate.Models
+	if len(models) != 2 || models[0].InferenceConfig.ModelName != "codegemma" || models[1].Spans != 2 || models[1].Lines != 4 {
+		t.Errorf("unexpected models %+v", models)
+	}
+}
+
+func TestWriteAttestations(t *testing.T) {
+	dir, commits := newTestRepo(t, blaimFile(expectedBlaimText), blaimFile("[]\n"))
+	if err := os.WriteFile(filepath.Join(dir, "playground.js"), []byte(playgroundJS), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, args := range [][]string{{"add", "playground.js"}, {"-c", "user.name=Test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "add playground.js"}} {
+		if _, err := gitOutput(dir, args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	attributions, err := readCommitAttributions(dir, ".blaim")
+	if err != nil {
+		t.Fatal(err)
+	}
+	attributions, err = commitsInRange(dir, commits[0], attributions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(attributions) != 1 || attributions[0].commit != commits[0] {
+		t.Fatalf("expected only %s in range, got %v", commits[0], attributions)
+	}
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPath := filepath.Join(t.TempDir(), "key.pem")
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	signer, err := loadEnvelopeSigner(keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := &bytes.Buffer{}
+	// playground.js didn't exist yet at commits[0], so only the commit is a subject.
+	if err := writeAttestations(out, dir, ".blaim", attributions, signer); err != nil {
+		t.Fatal(err)
+	}
+	envelope := &dsseEnvelope{}
+	if err := json.Unmarshal(out.Bytes(), envelope); err != nil {
+		t.Fatalf("error parsing %s: %v", out.String(), err)
+	}
+	if !strings.HasPrefix(envelope.Signatures[0].KeyID, "SHA256:") {
+		t.Errorf("unexpected key ID %q", envelope.Signatures[0].KeyID)
+	}
+	st, err := verifyEnvelope(envelope, signer.PublicKey())
+	if err != nil {
+		t.Fatalf("signature doesn't verify: %v", err)
+	}
+	// The signature is over the payload's pre-authentication encoding, with the plain ed25519 key.
+	payload, err := base64.StdEncoding.DecodeString(envelope.Payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := base64.StdEncoding.DecodeString(envelope.Signatures[0].Sig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ed25519.Verify(key.Public().(ed25519.PublicKey), dssePAE(envelope.PayloadType, payload), sig) {
+		t.Errorf("signature doesn't verify with the ed25519 public key")
+	}
+	tampered := *envelope
+	tampered.Payload = base64.StdEncoding.EncodeToString(bytes.Replace(payload, []byte(commits[0]), []byte(commits[1]), 1))
+	if _, err := verifyEnvelope(&tampered, signer.PublicKey()); err == nil {
+		t.Errorf("expected a tampered payload not to verify")
+	}
+	otherSigner, err := ssh.NewSignerFromKey(ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := verifyEnvelope(envelope, otherSigner.PublicKey()); err == nil {
+		t.Errorf("expected no signature by another key")
+	}
+	if len(st.Subject) != 1 || st.Predicate.Commit != commits[0] || len(st.Predicate.Spans) != 1 {
+		t.Errorf("unexpected statement %+v", st)
+	}
+
+	// At HEAD, playground.js has a blob to point at.
+	head, err := gitOutput(dir, "rev-parse", "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	blobs, err := readFileBlobs(dir, strings.TrimSpace(head), []string{"playground.js", "missing.js"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blobs) != 1 || len(blobs["playground.js"]) != 40 {
+		t.Errorf("expected the blob of playground.js, got %v", blobs)
+	}
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/banksean/me3/blaim"
+)
+
+// blameLine is a line of a file as described by git blame's porcelain output.
+type blameLine struct {
+	commit    string
+	author    string
+	fileName  string
+	origLine  int
+	finalLine int
+	// headers are the porcelain lines that git wrote for this line, including
+	// the "<commit> <orig> <final>" line and excluding the line's contents.
+	headers []string
+	text    string
+}
+
+// isBlameHeader reports whether fields are those of the first line of a
+// porcelain entry: a commit hash, the line's original and final line numbers,
+// and optionally the number of lines in the group.
+func isBlameHeader(fields []string) bool {
+	if len(fields) != 3 && len(fields) != 4 {
+		return false
+	}
+	if len(fields[0]) != 40 && len(fields[0]) != 64 {
+		return false
+	}
+	for _, c := range fields[0] {
+		if !strings.ContainsRune("0123456789abcdef", c) {
+			return false
+		}
+	}
+	for _, f := range fields[1:] {
+		if _, err := strconv.Atoi(f); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// parseBlamePorcelain reads the output of "git blame --porcelain" or
+// "git blame --line-porcelain", calling fn for each line of the blamed file.
+// Commit details that --porcelain only writes the first time a commit appears
+// are remembered, so every blameLine has its author and file name.
+func parseBlamePorcelain(in io.Reader, fn func(*blameLine) error) error {
+	r := bufio.NewReader(in)
+	authors := map[string]string{}
+	fileNames := map[string]string{}
+	var current *blameLine
+	for lineNumber := 1; ; lineNumber++ {
+		line, err := r.ReadString('\n')
+		if err == io.EOF && line == "" {
+			break
+		}
+		if err != nil && err != io.EOF {
+			return err
+		}
+		line = strings.TrimSuffix(line, "\n")
+
+		if text, ok := strings.CutPrefix(line, "\t"); ok {
+			if current == nil {
+				return fmt.Errorf("line %d: contents without a commit header", lineNumber)
+			}
+			current.author = authors[current.commit]
+			current.fileName = fileNames[current.commit]
+			current.text = text
+			if err := fn(current); err != nil {
+				return err
+			}
+			current = nil
+			continue
+		}
+
+		if current == nil {
+			fields := strings.Fields(line)
+			if !isBlameHeader(fields) {
+				return fmt.Errorf("line %d: expected a commit header, got %q", lineNumber, line)
+			}
+			current = &blameLine{commit: fields[0]}
+			current.origLine, _ = strconv.Atoi(fields[1])
+			current.finalLine, _ = strconv.Atoi(fields[2])
+			current.headers = append(current.headers, line)
+			continue
+		}
+		current.headers = append(current.headers, line)
+		key, value, _ := strings.Cut(line, " ")
+		switch key {
+		case "author":
+			authors[current.commit] = value
+		case "filename":
+			fileNames[current.commit] = value
+		}
+	}
+	if current != nil {
+		return fmt.Errorf("missing contents for line %d", current.finalLine)
+	}
+	return nil
+}
+
+// commitBlaimFiles looks up the attributions recorded in the .blaim file of
+// the commits that changed it. Commits that didn't change the .blaim file have
+// no attributions, because the file they inherited describes an earlier commit.
+type commitBlaimFiles struct {
+	dir           string
+	blaimFileName string
+	// changed is the set of commits that added or modified the .blaim file.
+	changed map[string]bool
+	cache   map[string]map[string]*blaim.BlaimRangeSet
+}
+
+// newCommitBlaimFiles reads which commits reachable from rev changed the .blaim
+// file in the repository at dir.
+func newCommitBlaimFiles(dir, rev, blaimFileName string) (*commitBlaimFiles, error) {
+	out, err := gitOutput(dir, "log", "--format=%H", "--diff-filter=AM", rev, "--", blaimFileName)
+	if err != nil {
+		return nil, err
+	}
+	changed := map[string]bool{}
+	for _, commit := range strings.Fields(out) {
+		changed[commit] = true
+	}
+	return &commitBlaimFiles{
+		dir:           dir,
+		blaimFileName: blaimFileName,
+		changed:       changed,
+		cache:         map[string]map[string]*blaim.BlaimRangeSet{},
+	}, nil
+}
+
+// rangeSets returns the attributions recorded at commit, by file name.
+func (c *commitBlaimFiles) rangeSets(commit string) (map[string]*blaim.BlaimRangeSet, error) {
+	if byFile, ok := c.cache[commit]; ok {
+		return byFile, nil
+	}
+	lines, err := readBlaimFileAtCommit(c.dir, commit, c.blaimFileName)
+	if err != nil {
+		return nil, err
+	}
+	linesByFile := map[string][]*blaim.BlaimLine{}
+	for _, b := range lines {
+		linesByFile[b.FileName] = append(linesByFile[b.FileName], b)
+	}
+	byFile := map[string]*blaim.BlaimRangeSet{}
+	for fileName, fileLines := range linesByFile {
+		byFile[fileName] = blaim.NewBlaimRangeSet(fileLines)
+	}
+	c.cache[commit] = byFile
+	return byFile, nil
+}
+
+// forLine returns the BlaimLines recorded at commit for line of fileName, as
+// numbered in that commit's version of the file.
+func (c *commitBlaimFiles) forLine(commit, fileName string, line int) ([]*blaim.BlaimLine, error) {
+	if !c.changed[commit] {
+		return nil, nil
+	}
+	byFile, err := c.rangeSets(commit)
+	if err != nil {
+		return nil, err
+	}
+	rangeSet, ok := byFile[fileName]
+	if !ok {
+		return nil, nil
+	}
+	return rangeSet.ForSourceLine(line), nil
+}
+
+// fileNames returns the name of every file that any of the commits attributed
+// lines in, sorted.
+func (c *commitBlaimFiles) fileNames() ([]string, error) {
+	seen := map[string]bool{}
+	for commit := range c.changed {
+		byFile, err := c.rangeSets(commit)
+		if err != nil {
+			return nil, err
+		}
+		for fileName := range byFile {
+			seen[fileName] = true
+		}
+	}
+	ret := []string{}
+	for fileName := range seen {
+		ret = append(ret, fileName)
+	}
+	sort.Strings(ret)
+	return ret, nil
+}
+
+// attributedLine is a line of a file, with the attribution recorded for it by
+// the commit that last changed it, if there is one.
+type attributedLine struct {
+	*blameLine
+	attribution *blaim.BlaimLine
+}
+
+// blameAttributedFiles blames each file at rev that some commit reachable from
+// rev attributed lines in, in file name order, and calls fn with its lines.
+// Files that no longer exist at rev are skipped.
+func blameAttributedFiles(dir, rev, blaimFileName string, fn func(fileName string, lines []attributedLine) error) error {
+	attributions, err := newCommitBlaimFiles(dir, rev, blaimFileName)
+	if err != nil {
+		return err
+	}
+	candidates, err := attributions.fileNames()
+	if err != nil || len(candidates) == 0 {
+		return err
+	}
+	out, err := gitOutput(dir, append([]string{"ls-tree", "-r", "-z", "--name-only", "--full-tree", rev, "--"}, candidates...)...)
+	if err != nil {
+		return err
+	}
+	existing := map[string]bool{}
+	for _, fileName := range strings.Split(out, "\x00") {
+		existing[fileName] = true
+	}
+	for _, fileName := range candidates {
+		if !existing[fileName] {
+			continue
+		}
+		porcelain, err := gitOutput(dir, "blame", "--porcelain", rev, "--", fileName)
+		if err != nil {
+			return err
+		}
+		lines := []attributedLine{}
+		err = parseBlamePorcelain(strings.NewReader(porcelain), func(l *blameLine) error {
+			matches, err := attributions.forLine(l.commit, l.fileName, l.origLine)
+			if err != nil {
+				return err
+			}
+			line := attributedLine{blameLine: l}
+			if len(matches) > 0 {
+				line.attribution = matches[0]
+			}
+			lines = append(lines, line)
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("error reading blame of %s: %v", fileName, err)
+		}
+		if err := fn(fileName, lines); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// blaimPorcelainHeaders returns the extra porcelain headers describing how a
+// line was generated. Like git's own headers, each is a key, a space and a
+// value; parsers that don't know them can skip them.
+func blaimPorcelainHeaders(b *blaim.BlaimLine) []string {
+	return []string{
+		"blaim-model " + b.InferenceConfig.ModelName,
+		"blaim-model-format " + b.InferenceConfig.ModelFormat,
+		"blaim-temperature " + strconv.FormatFloat(float64(b.InferenceConfig.Temperature), 'g', -1, 32),
+		"blaim-endpoint " + b.InferenceConfig.Endpoint,
+	}
+}
+
+// blamePorcelain copies git blame porcelain output from in to out, adding
+// blaimPorcelainHeaders before the contents of each generated line. Human
+// written lines are copied unchanged.
+func blamePorcelain(in io.Reader, out io.Writer, attributions *commitBlaimFiles) error {
+	w := bufio.NewWriter(out)
+	err := parseBlamePorcelain(in, func(l *blameLine) error {
+		matches, err := attributions.forLine(l.commit, l.fileName, l.origLine)
+		if err != nil {
+			return err
+		}
+		for _, h := range l.headers {
+			fmt.Fprintln(w, h)
+		}
+		if len(matches) > 0 {
+			for _, h := range blaimPorcelainHeaders(matches[0]) {
+				fmt.Fprintln(w, h)
+			}
+		}
+		fmt.Fprintf(w, "\t%s\n", l.text)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// blameLines writes a human-readable blame of each line in git blame porcelain
+// output: the commit, its author, and the model that generated the line, if any.
+func blameLines(in io.Reader, out io.Writer, attributions *commitBlaimFiles) error {
+	type row struct {
+		line  *blameLine
+		model string
+	}
+	rows := []row{}
+	authorWidth, modelWidth := 0, 0
+	err := parseBlamePorcelain(in, func(l *blameLine) error {
+		matches, err := attributions.forLine(l.commit, l.fileName, l.origLine)
+		if err != nil {
+			return err
+		}
+		model := "-"
+		if len(matches) > 0 {
+			model = matches[0].InferenceConfig.ModelName
+		}
+		authorWidth = max(authorWidth, len(l.author))
+		modelWidth = max(modelWidth, len(model))
+		rows = append(rows, row{line: l, model: model})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	// Not a tabwriter, since the file's contents may contain tabs.
+	w := bufio.NewWriter(out)
+	for _, r := range rows {
+		fmt.Fprintf(w, "%.8s (%-*s  %-*s %d) %s\n", r.line.commit, authorWidth, r.line.author, modelWidth, r.model, r.line.finalLine, r.line.text)
+	}
+	return w.Flush()
+}
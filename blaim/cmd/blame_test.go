@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const blameTestBlaim = `[{"fileName":"main.go","range":{"start":{"line":2,"character":0},"end":{"line":3,"character":0}},"text":"x\ny","inferenceConfig":{"endpoint":"http://localhost:11434","temperature":0.2,"modelName":"codegemma","modelFormat":"codegemma"}}]
+`
+
+// blameTestCommits make a repository where the first commit adds main.go with
+// generated lines 2 and 3, and the second commit inserts a human-written line
+// at the top, so the generated lines are 3 and 4 at HEAD.
+var blameTestCommits = []map[string]string{
+	{"main.go": "a\nx\ny\nb\n", ".blaim": blameTestBlaim},
+	{"main.go": "h\na\nx\ny\nb\n"},
+}
+
+func TestBlamePorcelain(t *testing.T) {
+	dir, _ := newTestRepo(t, blameTestCommits...)
+	porcelain, err := gitOutput(dir, "blame", "--porcelain", "--", "main.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	attributions, err := newCommitBlaimFiles(dir, "HEAD", ".blaim")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := &bytes.Buffer{}
+	if err := blamePorcelain(strings.NewReader(porcelain), out, attributions); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every line of git's output is kept, in order.
+	gitLines := strings.Split(porcelain, "\n")
+	i := 0
+	for _, line := range strings.Split(out.String(), "\n") {
+		if strings.HasPrefix(line, "blaim-") {
+			continue
+		}
+		if i >= len(gitLines) {
+			t.Fatalf("unexpected line %q after git's output", line)
+		}
+		if line != gitLines[i] {
+			t.Fatalf("expected git's line %q, got %q", gitLines[i], line)
+		}
+		i++
+	}
+	// The headers come right before the contents of the generated lines.
+	if !strings.Contains(out.String(), "blaim-temperature 0.2\nblaim-endpoint http://localhost:11434\n\tx\n") ||
+		!strings.Contains(out.String(), "blaim-endpoint http://localhost:11434\n\ty\n") {
+		t.Errorf("expected blaim headers for the generated lines, got:\n%s", out.String())
+	}
+	if strings.Count(out.String(), "blaim-model ") != 2 {
+		t.Errorf("expected 2 generated lines, got:\n%s", out.String())
+	}
+}
+
+func TestBlameLines(t *testing.T) {
+	dir, _ := newTestRepo(t, blameTestCommits...)
+	porcelain, err := gitOutput(dir, "blame", "--porcelain", "--", "main.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	attributions, err := newCommitBlaimFiles(dir, "HEAD", ".blaim")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := &bytes.Buffer{}
+	if err := blameLines(strings.NewReader(porcelain), out, attributions); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("expected 5 lines, got:\n%s", out.String())
+	}
+	for i, model := range []string{"-", "-", "codegemma", "codegemma", "-"} {
+		if !strings.Contains(lines[i], "(Test  "+model) {
+			t.Errorf("line %d: expected model %s, got %q", i+1, model, lines[i])
+		}
+	}
+}
+
+func TestParseBlamePorcelainErrors(t *testing.T) {
+	noop := func(*blameLine) error { return nil }
+	for _, in := range []string{
+		"\tcontents\n",
+		"not a header\n",
+		strings.Repeat("a", 40) + " 1 1 1\nauthor Test\n",
+	} {
+		if err := parseBlamePorcelain(strings.NewReader(in), noop); err == nil {
+			t.Errorf("expected an error parsing %q", in)
+		}
+	}
+}
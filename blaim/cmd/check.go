@@ -0,0 +1,249 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/banksean/me3/blaim"
+
+	"gopkg.in/yaml.v3"
+)
+
+// policy is a set of rules that attribution data must satisfy, read from a
+// YAML file. Rules that are left unset aren't checked.
+type policy struct {
+	// ForbiddenPaths are glob patterns for files that must not contain any
+	// generated code. "*" matches within a path segment, "**" matches across
+	// segments, and a trailing "/" matches everything under a directory.
+	ForbiddenPaths []string `yaml:"forbiddenPaths"`
+	// AllowedModels, if set, lists the only models that may have generated code.
+	AllowedModels []string `yaml:"allowedModels"`
+	// MaxGeneratedPercent is the largest share of added lines that may be
+	// generated. With no added lines to measure it against, it's violated.
+	MaxGeneratedPercent *float64 `yaml:"maxGeneratedPercent"`
+	// MaxGeneratedLines is the largest number of generated lines allowed.
+	MaxGeneratedLines *int `yaml:"maxGeneratedLines"`
+}
+
+func loadPolicy(r io.Reader) (*policy, error) {
+	p := &policy{}
+	dec := yaml.NewDecoder(r)
+	dec.KnownFields(true)
+	if err := dec.Decode(p); err != nil && err != io.EOF {
+		return nil, err
+	}
+	for _, pattern := range p.ForbiddenPaths {
+		if _, err := globToRegexp(pattern); err != nil {
+			return nil, fmt.Errorf("invalid forbidden path %q: %v", pattern, err)
+		}
+	}
+	return p, nil
+}
+
+// globToRegexp converts a glob pattern, as described for policy.ForbiddenPaths,
+// to a regular expression that matches slash-separated paths relative to the repo root.
+func globToRegexp(pattern string) (*regexp.Regexp, error) {
+	if strings.HasSuffix(pattern, "/") {
+		pattern += "**"
+	}
+	re := &strings.Builder{}
+	re.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				i++
+				// "**/" also matches no directories at all.
+				if i+1 < len(pattern) && pattern[i+1] == '/' {
+					i++
+					re.WriteString("(.*/)?")
+				} else {
+					re.WriteString(".*")
+				}
+			} else {
+				re.WriteString("[^/]*")
+			}
+		case '?':
+			re.WriteString("[^/]")
+		default:
+			re.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	re.WriteString("$")
+	return regexp.Compile(re.String())
+}
+
+// attributedChange is the attribution data for one commit (or for the working
+// tree, if commit is empty).
+type attributedChange struct {
+	commit           string
+	blaimLinesByFile map[string][]*blaim.BlaimLine
+}
+
+// checkInput is what a policy is evaluated against.
+type checkInput struct {
+	changes []attributedChange
+	// addedLines is the number of lines added by the changes, from git diff.
+	addedLines int
+}
+
+// violation describes how a checkInput broke a policy rule.
+type violation struct {
+	rule   string
+	detail string
+}
+
+func (v violation) String() string {
+	return fmt.Sprintf("%s: %s", v.rule, v.detail)
+}
+
+func changeLocation(commit, fileName string, b *blaim.BlaimLine) string {
+	loc := fmt.Sprintf("%s:%d-%d", fileName, b.Range.Start.Line, b.Range.End.Line)
+	if commit != "" {
+		loc = commit[:min(len(commit), 12)] + " " + loc
+	}
+	return loc
+}
+
+// checkPolicy returns every violation of p by in, along with the total number
+// of generated lines found.
+func checkPolicy(p *policy, in checkInput) ([]violation, int) {
+	violations := []violation{}
+	forbidden := []*regexp.Regexp{}
+	for _, pattern := range p.ForbiddenPaths {
+		// Patterns were validated by loadPolicy.
+		re, _ := globToRegexp(pattern)
+		forbidden = append(forbidden, re)
+	}
+
+	generatedLines := 0
+	for _, change := range in.changes {
+		fileNames := []string{}
+		for fileName := range change.blaimLinesByFile {
+			fileNames = append(fileNames, fileName)
+		}
+		sort.Strings(fileNames)
+		for _, fileName := range fileNames {
+			blaimLines := change.blaimLinesByFile[fileName]
+			generatedLines += blaim.NewBlaimRangeSet(blaimLines).LineCount()
+			for i, pattern := range p.ForbiddenPaths {
+				if forbidden[i].MatchString(fileName) {
+					violations = append(violations, violation{
+						rule:   "forbiddenPaths",
+						detail: fmt.Sprintf("%s contains generated code, but matches %q", changeLocation(change.commit, fileName, blaimLines[0]), pattern),
+					})
+					break
+				}
+			}
+			if len(p.AllowedModels) == 0 {
+				continue
+			}
+			for _, b := range blaimLines {
+				if !containsString(p.AllowedModels, b.InferenceConfig.ModelName) {
+					violations = append(violations, violation{
+						rule:   "allowedModels",
+						detail: fmt.Sprintf("%s was generated by %q, which is not an allowed model", changeLocation(change.commit, fileName, b), b.InferenceConfig.ModelName),
+					})
+				}
+			}
+		}
+	}
+
+	if p.MaxGeneratedLines != nil && generatedLines > *p.MaxGeneratedLines {
+		violations = append(violations, violation{
+			rule:   "maxGeneratedLines",
+			detail: fmt.Sprintf("%d generated lines, more than the maximum of %d", generatedLines, *p.MaxGeneratedLines),
+		})
+	}
+	if p.MaxGeneratedPercent != nil && in.addedLines == 0 && generatedLines > 0 {
+		// e.g. checking the working tree of a clean checkout in CI, which
+		// would otherwise pass however much of the change was generated. A
+		// change that adds nothing and generates nothing passes.
+		violations = append(violations, violation{
+			rule:   "maxGeneratedPercent",
+			detail: fmt.Sprintf("not evaluated: no added lines to measure %d generated lines against; pass --range to check the commits in a revision range", generatedLines),
+		})
+	} else if p.MaxGeneratedPercent != nil && in.addedLines > 0 {
+		percent := 100 * float64(generatedLines) / float64(in.addedLines)
+		if percent > *p.MaxGeneratedPercent {
+			violations = append(violations, violation{
+				rule:   "maxGeneratedPercent",
+				detail: fmt.Sprintf("%d of %d added lines (%.1f%%) are generated, more than the maximum of %.1f%%", generatedLines, in.addedLines, percent, *p.MaxGeneratedPercent),
+			})
+		}
+	}
+	return violations, generatedLines
+}
+
+// countAddedLines returns the number of lines added in the output of "git diff --numstat".
+// Binary files, which numstat reports as "-", are skipped.
+func countAddedLines(numstat string) int {
+	total := 0
+	for _, line := range strings.Split(numstat, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			continue
+		}
+		if n, err := strconv.Atoi(fields[0]); err == nil {
+			total += n
+		}
+	}
+	return total
+}
+
+// readCheckInput gathers the attribution data for a policy check from the git
+// repository at dir. If revRange (e.g. "main..HEAD") is set, it uses the
+// blaimFileName of every commit in the range and the lines added across the
+// range. Otherwise, it uses the blaimFileName in the working tree and the lines
+// added relative to HEAD.
+func readCheckInput(dir, blaimFileName, revRange string) (checkInput, error) {
+	in := checkInput{}
+	if revRange == "" {
+		f, err := os.Open(filepath.Join(dir, blaimFileName))
+		if err != nil {
+			return in, err
+		}
+		defer f.Close()
+		blaimLinesByFile, err := blaim.ReadBlaimFile(f)
+		if err != nil {
+			return in, err
+		}
+		in.changes = append(in.changes, attributedChange{blaimLinesByFile: blaimLinesByFile})
+		numstat, err := gitOutput(dir, "diff", "--numstat", "HEAD", "--", ".", ":(exclude)"+blaimFileName)
+		if err != nil {
+			return in, err
+		}
+		in.addedLines = countAddedLines(numstat)
+		return in, nil
+	}
+
+	out, err := gitOutput(dir, "log", "--format=%H", "--diff-filter=AM", revRange, "--", blaimFileName)
+	if err != nil {
+		return in, err
+	}
+	for _, commit := range strings.Fields(out) {
+		lines, err := readBlaimFileAtCommit(dir, commit, blaimFileName)
+		if err != nil {
+			return in, err
+		}
+		blaimLinesByFile := map[string][]*blaim.BlaimLine{}
+		for _, b := range lines {
+			blaimLinesByFile[b.FileName] = append(blaimLinesByFile[b.FileName], b)
+		}
+		in.changes = append(in.changes, attributedChange{commit: commit, blaimLinesByFile: blaimLinesByFile})
+	}
+	// Count lines added by each commit, rather than the net diff across the
+	// range, to match how .blaim records attribute each commit separately.
+	numstat, err := gitOutput(dir, "log", "--format=", "--numstat", revRange, "--", ".", ":(exclude)"+blaimFileName)
+	if err != nil {
+		return in, err
+	}
+	in.addedLines = countAddedLines(numstat)
+	return in, nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/banksean/me3/blaim"
+)
+
+func TestGlobToRegexp(t *testing.T) {
+	for _, test := range []struct {
+		pattern string
+		path    string
+		matches bool
+	}{
+		{"crypto/", "crypto/aes.go", true},
+		{"crypto/", "crypto/internal/aes.go", true},
+		{"crypto/", "notcrypto/aes.go", false},
+		{"crypto/**", "crypto/internal/aes.go", true},
+		{"**/crypto/*.go", "crypto/aes.go", true},
+		{"**/crypto/*.go", "lib/crypto/aes.go", true},
+		{"**/crypto/*.go", "lib/crypto/internal/aes.go", false},
+		{"*.pem", "key.pem", true},
+		{"*.pem", "certs/key.pem", false},
+		{"file?.js", "file1.js", true},
+		{"a.b", "axb", false},
+	} {
+		re, err := globToRegexp(test.pattern)
+		if err != nil {
+			t.Errorf("%q: %v", test.pattern, err)
+			continue
+		}
+		if got := re.MatchString(test.path); got != test.matches {
+			t.Errorf("%q matching %q: expected %v, got %v", test.pattern, test.path, test.matches, got)
+		}
+	}
+}
+
+func TestCheckPolicy(t *testing.T) {
+	p, err := loadPolicy(strings.NewReader(`
+forbiddenPaths: ["crypto/"]
+allowedModels: [codegemma]
+maxGeneratedPercent: 40
+maxGeneratedLines: 10
+`))
+	if err != nil {
+		t.Fatalf("error loading policy: %v", err)
+	}
+	line := func(fileName string, start, end int, model string) *blaim.BlaimLine {
+		return &blaim.BlaimLine{
+			FileName:        fileName,
+			Range:           blaim.Range{Start: blaim.Position{Line: start}, End: blaim.Position{Line: end}},
+			InferenceConfig: blaim.InferenceConfig{ModelName: model},
+		}
+	}
+	in := checkInput{
+		changes: []attributedChange{
+			{commit: "0123456789abcdef", blaimLinesByFile: map[string][]*blaim.BlaimLine{
+				"crypto/aes.go": {line("crypto/aes.go", 1, 4, "codegemma")},
+				"main.go":       {line("main.go", 10, 19, "gpt-4")},
+			}},
+		},
+		addedLines: 20,
+	}
+	violations, generatedLines := checkPolicy(p, in)
+	if generatedLines != 14 {
+		t.Errorf("expected 14 generated lines, got %d", generatedLines)
+	}
+	expected := []string{
+		`forbiddenPaths: 0123456789ab crypto/aes.go:1-4 contains generated code, but matches "crypto/"`,
+		`allowedModels: 0123456789ab main.go:10-19 was generated by "gpt-4", which is not an allowed model`,
+		`maxGeneratedLines: 14 generated lines, more than the maximum of 10`,
+		`maxGeneratedPercent: 14 of 20 added lines (70.0%) are generated, more than the maximum of 40.0%`,
+	}
+	if fmt.Sprint(violations) != fmt.Sprint(expected) {
+		t.Errorf("expected:\n%s\ngot:\n%s", strings.Join(expected, "\n"), violations)
+	}
+
+	if violations, _ := checkPolicy(&policy{}, in); len(violations) != 0 {
+		t.Errorf("expected an empty policy to allow everything, got %v", violations)
+	}
+
+	// With nothing added, e.g. in a clean checkout, the percentage can't be measured.
+	in.addedLines = 0
+	violations, _ = checkPolicy(&policy{MaxGeneratedPercent: p.MaxGeneratedPercent}, in)
+	if len(violations) != 1 || violations[0].rule != "maxGeneratedPercent" || !strings.HasPrefix(violations[0].detail, "not evaluated") {
+		t.Errorf("expected maxGeneratedPercent not to be evaluated, got %v", violations)
+	}
+}
+
+func TestLoadPolicyUnknownField(t *testing.T) {
+	if _, err := loadPolicy(strings.NewReader("maxGeneratedPrecent: 40\n")); err == nil {
+		t.Errorf("expected an error for a misspelled rule")
+	}
+}
+
+func TestReadCheckInputRange(t *testing.T) {
+	dir, commits := newTestRepo(t, blaimFile("[]\n"), blaimFile(expectedBlaimText))
+	if err := os.WriteFile(filepath.Join(dir, "playground.js"), []byte(playgroundJS), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gitOutput(dir, "add", "playground.js"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gitOutput(dir, "-c", "user.name=Test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "add playground.js"); err != nil {
+		t.Fatal(err)
+	}
+	in, err := readCheckInput(dir, ".blaim", commits[0]+"..HEAD")
+	if err != nil {
+		t.Fatalf("error reading check input: %v", err)
+	}
+	if len(in.changes) != 1 || in.changes[0].commit != commits[1] {
+		t.Errorf("expected attributions from %s only, got %+v", commits[1], in.changes)
+	}
+	if expected := strings.Count(playgroundJS, "\n") + 1; in.addedLines != expected {
+		t.Errorf("expected %d added lines, got %d", expected, in.addedLines)
+	}
+}
+
+func TestCheckDeletionOnlyRange(t *testing.T) {
+	dir, commits := newTestRepo(t, map[string]string{".blaim": expectedBlaimText, "playground.js": playgroundJS}, map[string]string{"playground.js": ""})
+	in, err := readCheckInput(dir, ".blaim", commits[0]+"..HEAD")
+	if err != nil {
+		t.Fatalf("error reading check input: %v", err)
+	}
+	maxPercent := 10.0
+	if violations, generatedLines := checkPolicy(&policy{MaxGeneratedPercent: &maxPercent}, in); len(violations) != 0 || generatedLines != 0 || in.addedLines != 0 {
+		t.Errorf("expected a range that only deletes lines to pass, got %v with %d of %d lines generated", violations, generatedLines, in.addedLines)
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/banksean/me3/blaim"
+)
+
+// attributionKey identifies an accepted suggestion independently of where it
+// ended up in the file, so accept log entries can be matched against the
+// BlaimLines that were generated from them.
+type attributionKey struct {
+	fileName        string
+	text            string
+	inferenceConfig blaim.InferenceConfig
+}
+
+// compactStats summarizes what compactAcceptLog did to an accept log.
+type compactStats struct {
+	kept       int
+	attributed int
+	expired    int
+}
+
+// compactAcceptLog copies the accept log from in to out, dropping any entries
+// that have already been attributed by one of the given BlaimLines, and any
+// entries accepted before the given cutoff (if it is non-zero). Entries' file
+// names are compared after normalize, if it is non-nil. Lines that are not
+// accept log entries are copied through unchanged.
+func compactAcceptLog(in io.Reader, out io.Writer, attributed []*blaim.BlaimLine, normalize func(string) string, before time.Time) (compactStats, error) {
+	stats := compactStats{}
+	seen := map[attributionKey]bool{}
+	for _, blaimLine := range attributed {
+		seen[attributionKey{blaimLine.FileName, blaimLine.Text, blaimLine.InferenceConfig}] = true
+		// Entries recorded by blaim proxy don't name a file, and are attributed
+		// to whichever file their text turned up in.
+		seen[attributionKey{"", blaimLine.Text, blaimLine.InferenceConfig}] = true
+	}
+
+	b, err := io.ReadAll(in)
+	if err != nil {
+		return stats, err
+	}
+	lines := strings.Split(string(b), "\n")
+	// Don't turn a trailing newline into an extra empty line.
+	if len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	for _, line := range lines {
+		parsed, err := blaim.ParseAcceptLogLine(line)
+		if err == nil && parsed != nil {
+			if normalize != nil {
+				parsed.FileName = normalize(parsed.FileName)
+			}
+			if seen[attributionKey{parsed.FileName, parsed.AttributedText(), parsed.InferenceConfig}] {
+				stats.attributed++
+				continue
+			}
+			if !before.IsZero() && !parsed.Timestamp.IsZero() && parsed.Timestamp.Before(before) {
+				stats.expired++
+				continue
+			}
+			stats.kept++
+		}
+		if _, err := fmt.Fprintln(out, line); err != nil {
+			return stats, err
+		}
+	}
+	return stats, nil
+}
+
+// compactMinIdle is how long an accept log must have gone unmodified before
+// compact rewrites it, since the editor may still be appending to it.
+const compactMinIdle = time.Minute
+
+// compactAcceptLogFile compacts the accept log at logPath in place, against the
+// attribution history of the git repository at dir. With dryRun set, it only
+// reports what it would have done. Unless force is set, it refuses to compact a
+// log modified in the last compactMinIdle.
+func compactAcceptLogFile(dir, blaimFileName, logPath string, normalize func(string) string, before time.Time, dryRun, force bool) (compactStats, error) {
+	attributed, err := readAttributionHistory(dir, blaimFileName)
+	if err != nil {
+		return compactStats{}, fmt.Errorf("error reading attribution history: %v", err)
+	}
+	logFile, err := os.OpenFile(logPath, os.O_RDWR, 0)
+	if err != nil {
+		return compactStats{}, fmt.Errorf("error opening accept log at %s: %v", logPath, err)
+	}
+	defer logFile.Close()
+
+	if dryRun {
+		return compactAcceptLog(logFile, io.Discard, attributed, normalize, before)
+	}
+	info, err := logFile.Stat()
+	if err != nil {
+		return compactStats{}, err
+	}
+	if idle := time.Since(info.ModTime()); idle < compactMinIdle && !force {
+		return compactStats{}, fmt.Errorf("%s was modified %s ago and may still be being written to; compact it when the editor is idle, or pass --force", logPath, idle.Round(time.Second))
+	}
+
+	original, err := io.ReadAll(logFile)
+	if err != nil {
+		return compactStats{}, err
+	}
+	// Leave a trailing partial line, which is still being written, for
+	// rewriteInPlace to copy as it is.
+	original = original[:bytes.LastIndexByte(original, '\n')+1]
+	compacted := &bytes.Buffer{}
+	stats, err := compactAcceptLog(bytes.NewReader(original), compacted, attributed, normalize, before)
+	if err != nil {
+		return stats, err
+	}
+
+	// Keep a copy of the log until it's been rewritten, so an interrupted
+	// compaction doesn't lose it.
+	backup := logPath + ".compact-backup"
+	if err := os.WriteFile(backup, original, info.Mode().Perm()); err != nil {
+		return stats, err
+	}
+	if err := rewriteInPlace(logFile, int64(len(original)), compacted.Bytes()); err != nil {
+		return stats, fmt.Errorf("error rewriting %s, whose original contents are in %s: %v", logPath, backup, err)
+	}
+	return stats, os.Remove(backup)
+}
+
+// rewritableFile is the part of *os.File that rewriteInPlace uses.
+type rewritableFile interface {
+	io.ReaderAt
+	io.WriterAt
+	Truncate(size int64) error
+}
+
+// rewriteInPlace replaces the contents of f, of which the first n bytes have
+// been read, with contents followed by whatever has been appended to f since.
+// It rewrites f rather than renaming a new file over it, since the editor keeps
+// the log open and would carry on appending to the old file. contents must be
+// no longer than n, so that rewriting never overwrites what hasn't been read.
+//
+// Entries can be appended while contents is written, so it copies them down
+// until a read finds nothing new, and only then truncates f.
+func rewriteInPlace(f rewritableFile, n int64, contents []byte) error {
+	if _, err := f.WriteAt(contents, 0); err != nil {
+		return err
+	}
+	size := int64(len(contents))
+	for {
+		appended, err := io.ReadAll(io.NewSectionReader(f, n, math.MaxInt64-n))
+		if err != nil {
+			return err
+		}
+		if len(appended) == 0 {
+			return f.Truncate(size)
+		}
+		if _, err := f.WriteAt(appended, size); err != nil {
+			return err
+		}
+		n += int64(len(appended))
+		size += int64(len(appended))
+	}
+}
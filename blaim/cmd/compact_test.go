@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/banksean/me3/blaim"
+)
+
+func TestCompactAcceptLog(t *testing.T) {
+	logText := strings.Join([]string{
+		`2024-06-10 15:40:00.000 [info] Extension host started`,
+		`2024-06-10 15:41:00.000 [info] {"fileName":"a.js","text":"old();","inferenceConfig":{"modelName":"codegemma"}}`,
+		`2024-06-10 15:42:00.000 [info] {"fileName":"a.js","text":"attributed();","inferenceConfig":{"modelName":"codegemma"}}`,
+		`2024-06-10 15:43:00.000 [info] {"fileName":"a.js","text":"pending();","inferenceConfig":{"modelName":"codegemma"}}`,
+		``,
+	}, "\n")
+	attributed := []*blaim.BlaimLine{
+		{
+			FileName:        "a.js",
+			Text:            "attributed();",
+			InferenceConfig: blaim.InferenceConfig{ModelName: "codegemma"},
+		},
+		{
+			// Same text, different model, so it shouldn't match anything.
+			FileName:        "a.js",
+			Text:            "pending();",
+			InferenceConfig: blaim.InferenceConfig{ModelName: "codellama"},
+		},
+	}
+	before := time.Date(2024, 6, 10, 15, 41, 30, 0, time.Local)
+
+	out := &bytes.Buffer{}
+	stats, err := compactAcceptLog(strings.NewReader(logText), out, attributed, nil, before)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expectedStats := compactStats{kept: 1, attributed: 1, expired: 1}
+	if stats != expectedStats {
+		t.Errorf("expected %+v, got %+v", expectedStats, stats)
+	}
+	expected := strings.Join([]string{
+		`2024-06-10 15:40:00.000 [info] Extension host started`,
+		`2024-06-10 15:43:00.000 [info] {"fileName":"a.js","text":"pending();","inferenceConfig":{"modelName":"codegemma"}}`,
+		``,
+	}, "\n")
+	if got := out.String(); got != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, got)
+	}
+}
+
+func TestCompactAcceptLogWithoutFileName(t *testing.T) {
+	logText := `2024-06-10 15:42:00.000 [info] {"event":"completed","fileName":"","text":"attributed();","promptHash":"ab12"}` + "\n"
+	attributed := []*blaim.BlaimLine{{FileName: "a.js", Text: "attributed();"}}
+	out := &bytes.Buffer{}
+	stats, err := compactAcceptLog(strings.NewReader(logText), out, attributed, nil, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.attributed != 1 {
+		t.Errorf("expected the entry to be removed, got %+v", stats)
+	}
+}
+
+func TestCompactAcceptLogFile(t *testing.T) {
+	dir, _ := newTestRepo(t, blaimFile(`[{"fileName":"a.js","text":"attributed();","inferenceConfig":{"modelName":"codegemma"}}]`+"\n"))
+	logPath := filepath.Join(t.TempDir(), "accepted.suggestions.log")
+	logText := `2024-06-10 15:42:00.000 [info] {"fileName":"a.js","text":"attributed();","inferenceConfig":{"modelName":"codegemma"}}` + "\n" +
+		`2024-06-10 15:43:00.000 [info] {"fileName":"a.js","text":"pending();","inferenceConfig":{"modelName":"codegemma"}}` + "\n"
+	if err := os.WriteFile(logPath, []byte(logText), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// As the editor does, keep the log open for appending.
+	editor, err := os.OpenFile(logPath, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer editor.Close()
+
+	if _, err := compactAcceptLogFile(dir, ".blaim", logPath, nil, time.Time{}, false, false); err == nil {
+		t.Errorf("expected an error compacting a log that was just modified")
+	}
+	stats, err := compactAcceptLogFile(dir, ".blaim", logPath, nil, time.Time{}, false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.attributed != 1 || stats.kept != 1 {
+		t.Errorf("expected 1 entry removed and 1 kept, got %+v", stats)
+	}
+
+	// Entries the editor appends after compaction still end up in the log.
+	later := `2024-06-10 15:44:00.000 [info] {"fileName":"a.js","text":"later();","inferenceConfig":{"modelName":"codegemma"}}` + "\n"
+	if _, err := editor.WriteString(later); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `2024-06-10 15:43:00.000 [info] {"fileName":"a.js","text":"pending();","inferenceConfig":{"modelName":"codegemma"}}` + "\n" + later
+	if string(got) != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, got)
+	}
+	if _, err := os.Stat(logPath + ".compact-backup"); !os.IsNotExist(err) {
+		t.Errorf("expected the backup to be removed, got %v", err)
+	}
+}
+
+func TestCompactAcceptLogFileRenamed(t *testing.T) {
+	dir, _ := newTestRepo(t, map[string]string{"a.js": "function a() {\n  return 1;\n}\n"})
+	if _, err := gitOutput(dir, "mv", "a.js", "b.js"); err != nil {
+		t.Fatal(err)
+	}
+	blaimText := `[{"fileName":"b.js","text":"attributed();","inferenceConfig":{"modelName":"codegemma"}}]` + "\n"
+	if err := os.WriteFile(filepath.Join(dir, ".blaim"), []byte(blaimText), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gitOutput(dir, "add", ".blaim"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gitOutput(dir, "-c", "user.name=Test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "rename a.js"); err != nil {
+		t.Fatal(err)
+	}
+	// The suggestion was accepted before the rename, so the entry has the old name.
+	logPath := filepath.Join(t.TempDir(), "accepted.suggestions.log")
+	logText := `2024-06-10 15:42:00.000 [info] {"fileName":"a.js","text":"attributed();","inferenceConfig":{"modelName":"codegemma"}}` + "\n"
+	if err := os.WriteFile(logPath, []byte(logText), 0644); err != nil {
+		t.Fatal(err)
+	}
+	stats, err := compactAcceptLogFile(dir, ".blaim", logPath, nil, time.Time{}, true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.attributed != 1 {
+		t.Errorf("expected the entry under the old name to be attributed, got %+v", stats)
+	}
+}
+
+// appendingFile appends to the file it rewrites the first time it's written
+// to, as the editor might while compact runs.
+type appendingFile struct {
+	*os.File
+	editor *os.File
+	append string
+}
+
+func (f *appendingFile) WriteAt(b []byte, off int64) (int, error) {
+	n, err := f.File.WriteAt(b, off)
+	if f.append != "" {
+		if _, err := f.editor.WriteString(f.append); err != nil {
+			return n, err
+		}
+		f.append = ""
+	}
+	return n, err
+}
+
+func TestRewriteInPlaceWhileAppending(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log")
+	if err := os.WriteFile(path, []byte("one\ntwo\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	editor, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer editor.Close()
+	if err := rewriteInPlace(&appendingFile{File: f, editor: editor, append: "three\n"}, 8, []byte("two\n")); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "two\nthree\n" {
+		t.Errorf("expected %q, got %q", "two\nthree\n", got)
+	}
+}
+
+func TestRewriteInPlace(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log")
+	if err := os.WriteFile(path, []byte("one\ntwo\nthree\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	// "three\n" was appended after the first 8 bytes were read.
+	if err := rewriteInPlace(f, 8, []byte("two\n")); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "two\nthree\n" {
+		t.Errorf("expected %q, got %q", "two\nthree\n", got)
+	}
+}
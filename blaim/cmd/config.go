@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/banksean/me3/blaim"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// config holds repository-level settings, read from a .blaimrc file at the
+// root of the repository. Flags override the settings they correspond to.
+type config struct {
+	// AcceptLogs are the accept logs read by commands that aren't given
+	// --accept-log. Relative paths are relative to the repository root.
+	AcceptLogs []string `yaml:"acceptLogs" toml:"acceptLogs"`
+	// IgnorePaths are glob patterns, as in policy.ForbiddenPaths, of files
+	// that generate never attributes.
+	IgnorePaths []string         `yaml:"ignorePaths" toml:"ignorePaths"`
+	Workspaces  workspacesConfig `yaml:"workspaces" toml:"workspaces"`
+	Match       matchConfig      `yaml:"match" toml:"match"`
+	Storage     storageConfig    `yaml:"storage" toml:"storage"`
+	Output      outputConfig     `yaml:"output" toml:"output"`
+
+	// path is the file the config was read from, or empty if there wasn't one.
+	path string
+	// root is the directory relative paths in the config are resolved against.
+	root string
+}
+
+// workspacesConfig says how to resolve file names in the accept log, which
+// the editor records relative to the folder it was opened at, to paths relative
+// to the root of the repository.
+type workspacesConfig struct {
+	// Roots are folders, relative to the repository root, that an editor may
+	// have been opened at. A file name that doesn't exist at the repository root
+	// is looked up in each of them in turn.
+	Roots []string `yaml:"roots" toml:"roots"`
+	// Mappings rewrite file names that start with a prefix, e.g. the name of a
+	// folder in a multi-root workspace, or the absolute path of a checkout on
+	// another machine. The first matching mapping wins.
+	Mappings []pathMapping `yaml:"mappings" toml:"mappings"`
+}
+
+type pathMapping struct {
+	// From is a directory prefix of the file names recorded in the accept log.
+	From string `yaml:"from" toml:"from"`
+	// To is the directory it corresponds to, relative to the repository root.
+	To string `yaml:"to" toml:"to"`
+}
+
+type matchConfig struct {
+	// MinLCS is blaim.Matcher.MinLCS for generate's --min-lcs.
+	MinLCS int `yaml:"minLCS" toml:"minLCS"`
+}
+
+type storageConfig struct {
+	// BlaimFile is the default for --blaim-file: the path of the .blaim file,
+	// relative to the repository root.
+	BlaimFile string `yaml:"blaimFile" toml:"blaimFile"`
+	// SQLite is the default for export's --sqlite.
+	SQLite string `yaml:"sqlite" toml:"sqlite"`
+}
+
+type outputConfig struct {
+	// Format is "table" or "json", for commands that can write either.
+	Format string `yaml:"format" toml:"format"`
+}
+
+// configFileNames are the names a config file may have, in the order they're
+// looked for. .blaimrc itself is YAML.
+var configFileNames = []string{".blaimrc", ".blaimrc.yaml", ".blaimrc.yml", ".blaimrc.toml"}
+
+func defaultConfig() *config {
+	return &config{
+		AcceptLogs:  []string{},
+		IgnorePaths: []string{},
+		Workspaces:  workspacesConfig{Roots: []string{}, Mappings: []pathMapping{}},
+		Match:       matchConfig{MinLCS: blaim.DefaultMinLCS},
+		Storage:     storageConfig{BlaimFile: ".blaim"},
+		Output:      outputConfig{Format: "table"},
+	}
+}
+
+// repoRoot returns the top level of the git checkout containing dir, or dir
+// itself if it isn't in one.
+func repoRoot(dir string) string {
+	out, err := gitOutput(dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return dir
+	}
+	return strings.TrimSpace(out)
+}
+
+// findConfig loads the first of configFileNames in root, or returns the
+// default config if there isn't one.
+func findConfig(root string) (*config, error) {
+	for _, name := range configFileNames {
+		path := filepath.Join(root, name)
+		if _, err := os.Stat(path); err == nil {
+			return loadConfig(path, root)
+		}
+	}
+	c := defaultConfig()
+	c.root = root
+	return c, nil
+}
+
+// loadConfig reads the config file at path, as TOML if its name ends in
+// ".toml" and YAML otherwise. Settings it doesn't mention keep their defaults.
+func loadConfig(path, root string) (*config, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c := defaultConfig()
+	if strings.HasSuffix(path, ".toml") {
+		md, err := toml.Decode(string(b), c)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			return nil, fmt.Errorf("%s: unknown setting %q", path, undecoded[0].String())
+		}
+	} else {
+		dec := yaml.NewDecoder(bytes.NewReader(b))
+		dec.KnownFields(true)
+		if err := dec.Decode(c); err != nil && err != io.EOF {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+	}
+	if err := c.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	c.path = path
+	c.root = root
+	return c, nil
+}
+
+func (c *config) validate() error {
+	if c.Match.MinLCS <= 0 {
+		return fmt.Errorf("match.minLCS must be positive, got %d", c.Match.MinLCS)
+	}
+	if c.Output.Format != "table" && c.Output.Format != "json" {
+		return fmt.Errorf("output.format must be table or json, got %q", c.Output.Format)
+	}
+	for _, pattern := range c.IgnorePaths {
+		if _, err := globToRegexp(pattern); err != nil {
+			return fmt.Errorf("invalid ignorePaths pattern %q: %v", pattern, err)
+		}
+	}
+	for _, root := range c.Workspaces.Roots {
+		if !isRepoRelative(root) {
+			return fmt.Errorf("workspaces.roots must be relative to the repository root, got %q", root)
+		}
+	}
+	for _, m := range c.Workspaces.Mappings {
+		if strings.Trim(m.From, "/") == "" {
+			return fmt.Errorf("workspaces.mappings must have a from prefix")
+		}
+		if !isRepoRelative(m.To) {
+			return fmt.Errorf("workspaces.mappings to must be relative to the repository root, got %q", m.To)
+		}
+	}
+	return nil
+}
+
+// resolve returns path relative to the config's root, expanding a leading "~/"
+// to the user's home directory.
+func (c *config) resolve(path string) string {
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, rest)
+		}
+	}
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(c.root, path)
+}
+
+// acceptLogPaths returns flagValues if any were given, and otherwise the
+// accept logs from the config.
+func (c *config) acceptLogPaths(flagValues ...string) ([]string, error) {
+	ret := []string{}
+	for _, v := range flagValues {
+		if v != "" {
+			ret = append(ret, v)
+		}
+	}
+	if len(ret) > 0 {
+		return ret, nil
+	}
+	for _, p := range c.AcceptLogs {
+		ret = append(ret, c.resolve(p))
+	}
+	if len(ret) == 0 {
+		return nil, fmt.Errorf("no accept log: pass --accept-log, or set acceptLogs in %s", configFileNames[0])
+	}
+	return ret, nil
+}
+
+// ignoreFunc returns a function reporting whether a path matches any of the
+// config's IgnorePaths, or nil if there aren't any.
+func (c *config) ignoreFunc() func(string) bool {
+	if len(c.IgnorePaths) == 0 {
+		return nil
+	}
+	patterns := []*regexp.Regexp{}
+	for _, pattern := range c.IgnorePaths {
+		// validate has already checked the patterns.
+		re, _ := globToRegexp(pattern)
+		patterns = append(patterns, re)
+	}
+	return func(path string) bool {
+		for _, re := range patterns {
+			if re.MatchString(path) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// write prints the config as YAML, or as TOML if asTOML is set, preceded by a
+// comment saying where it came from.
+func (c *config) write(out io.Writer, asTOML bool) error {
+	source := "no config file found; using defaults"
+	if c.path != "" {
+		source = "read from " + c.path
+	}
+	fmt.Fprintf(out, "# %s\n", source)
+	if asTOML {
+		return toml.NewEncoder(out).Encode(c)
+	}
+	enc := yaml.NewEncoder(out)
+	enc.SetIndent(2)
+	if err := enc.Encode(c); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// openAcceptLogs opens the accept logs at paths, and returns a reader of
+// their contents one after another. Line numbers in accept log diagnostics
+// count through the logs in order.
+func openAcceptLogs(paths []string) (io.Reader, func(), error) {
+	files := []*os.File{}
+	closeAll := func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}
+	readers := []io.Reader{}
+	for i, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			closeAll()
+			return nil, nil, fmt.Errorf("error opening accept log at %s: %v", path, err)
+		}
+		files = append(files, f)
+		if i > 0 {
+			// In case the previous log doesn't end with a newline.
+			readers = append(readers, strings.NewReader("\n"))
+		}
+		readers = append(readers, f)
+	}
+	return io.MultiReader(readers...), closeAll, nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/banksean/me3/blaim"
+)
+
+func writeConfigFile(t *testing.T, dir, name, contents string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		contents string
+	}{
+		{".blaimrc", `
+acceptLogs: [logs/accepted.suggestions.log, /var/log/other.log]
+ignorePaths: [vendor/]
+match:
+  minLCS: 30
+storage:
+  sqlite: blaim.db
+output:
+  format: json
+`},
+		{".blaimrc.toml", `
+acceptLogs = ["logs/accepted.suggestions.log", "/var/log/other.log"]
+ignorePaths = ["vendor/"]
+
+[match]
+minLCS = 30
+
+[storage]
+sqlite = "blaim.db"
+
+[output]
+format = "json"
+`},
+	} {
+		dir := t.TempDir()
+		writeConfigFile(t, dir, test.name, test.contents)
+		c, err := findConfig(dir)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if c.path != filepath.Join(dir, test.name) {
+			t.Errorf("%s: expected the config to be read from %s, got %q", test.name, test.name, c.path)
+		}
+		if c.Match.MinLCS != 30 || c.Output.Format != "json" || c.Storage.SQLite != "blaim.db" {
+			t.Errorf("%s: unexpected config %+v", test.name, c)
+		}
+		// Settings that aren't mentioned keep their defaults.
+		if c.Storage.BlaimFile != ".blaim" {
+			t.Errorf("%s: expected the default blaim file, got %q", test.name, c.Storage.BlaimFile)
+		}
+		paths, err := c.acceptLogPaths()
+		expected := []string{filepath.Join(dir, "logs/accepted.suggestions.log"), "/var/log/other.log"}
+		if err != nil || !reflect.DeepEqual(paths, expected) {
+			t.Errorf("%s: expected accept logs %v, got %v (%v)", test.name, expected, paths, err)
+		}
+		if paths, _ := c.acceptLogPaths("flag.log"); !reflect.DeepEqual(paths, []string{"flag.log"}) {
+			t.Errorf("%s: expected --accept-log to override the config, got %v", test.name, paths)
+		}
+		ignore := c.ignoreFunc()
+		if !ignore("vendor/x/y.go") || ignore("main.go") {
+			t.Errorf("%s: expected only vendor/ to be ignored", test.name)
+		}
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	dir := t.TempDir()
+	for name, contents := range map[string]string{
+		".blaimrc":      "acceptLog: a.log\n",
+		".blaimrc.yml":  "output:\n  format: xml\n",
+		".blaimrc.toml": "[match]\nminLCS = 0\n",
+	} {
+		if _, err := loadConfig(writeConfigFile(t, dir, name, contents), dir); err == nil {
+			t.Errorf("%s: expected an error for %q", name, contents)
+		}
+	}
+}
+
+func TestDefaultConfig(t *testing.T) {
+	c, err := findConfig(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.path != "" || c.Match.MinLCS != blaim.DefaultMinLCS || c.ignoreFunc() != nil {
+		t.Errorf("expected the default config, got %+v", c)
+	}
+	if _, err := c.acceptLogPaths(); err == nil {
+		t.Errorf("expected an error with no accept logs configured")
+	}
+
+	out := &bytes.Buffer{}
+	if err := c.write(out, false); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(out.String(), "# no config file found") || !strings.Contains(out.String(), "  minLCS: 20\n") {
+		t.Errorf("unexpected YAML:\n%s", out.String())
+	}
+	out.Reset()
+	if err := c.write(out, true); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "[match]\n  minLCS = 20\n") {
+		t.Errorf("unexpected TOML:\n%s", out.String())
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/banksean/me3/blaim"
+)
+
+// lineCoverage maps the line numbers of a file's statements to whether any of
+// the statements on that line were executed. Lines without statements are absent.
+type lineCoverage map[int]bool
+
+// parseCoverProfile parses a profile written by "go test -coverprofile",
+// returning the coverage of each file it mentions, keyed by the file's name in
+// the profile (i.e. its import path, followed by its base name).
+func parseCoverProfile(r io.Reader) (map[string]lineCoverage, error) {
+	ret := map[string]lineCoverage{}
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "mode:") {
+			continue
+		}
+		// Each line looks like "name.go:startLine.startCol,endLine.endCol numStatements count".
+		colon := strings.LastIndex(line, ":")
+		if colon == -1 {
+			return nil, fmt.Errorf("line %d: malformed coverage block %q", lineNumber, line)
+		}
+		fileName := line[:colon]
+		var startLine, startCol, endLine, endCol, statements, count int
+		if _, err := fmt.Sscanf(line[colon+1:], "%d.%d,%d.%d %d %d", &startLine, &startCol, &endLine, &endCol, &statements, &count); err != nil {
+			return nil, fmt.Errorf("line %d: malformed coverage block %q: %v", lineNumber, line, err)
+		}
+		cov, ok := ret[fileName]
+		if !ok {
+			cov = lineCoverage{}
+			ret[fileName] = cov
+		}
+		for l := startLine; l <= endLine; l++ {
+			cov[l] = cov[l] || count > 0
+		}
+	}
+	return ret, scanner.Err()
+}
+
+// readModulePath returns the module path declared in the go.mod file in dir.
+func readModulePath(dir string) (string, error) {
+	b, err := os.ReadFile(filepath.Join(dir, "go.mod"))
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		if rest, ok := strings.CutPrefix(strings.TrimSpace(line), "module "); ok {
+			rest = strings.TrimSpace(rest)
+			if unquoted, err := strconv.Unquote(rest); err == nil {
+				return unquoted, nil
+			}
+			return rest, nil
+		}
+	}
+	return "", fmt.Errorf("no module directive in %s", filepath.Join(dir, "go.mod"))
+}
+
+// repoRelativeCoverage re-keys coverage by path relative to the repository
+// root, given the path of the module at the root of the repository.
+func repoRelativeCoverage(cov map[string]lineCoverage, modulePath string) map[string]lineCoverage {
+	ret := map[string]lineCoverage{}
+	for name, c := range cov {
+		ret[strings.TrimPrefix(name, modulePath+"/")] = c
+	}
+	return ret
+}
+
+// coverageSummary counts the covered and uncovered generated statement lines
+// in a file that were generated by a model.
+type coverageSummary struct {
+	fileName  string
+	model     string
+	covered   int
+	uncovered int
+}
+
+// summarizeCoverage counts the generated lines in fileName that are covered and
+// uncovered by tests, per model. Generated lines without statements aren't counted.
+func summarizeCoverage(fileName string, blaimRangeSet *blaim.BlaimRangeSet, cov lineCoverage) []*coverageSummary {
+	byModel := map[string]*coverageSummary{}
+	for line, covered := range cov {
+		models := map[string]bool{}
+		for _, b := range blaimRangeSet.ForSourceLine(line) {
+			models[b.InferenceConfig.ModelName] = true
+		}
+		for model := range models {
+			s, ok := byModel[model]
+			if !ok {
+				s = &coverageSummary{fileName: fileName, model: model}
+				byModel[model] = s
+			}
+			if covered {
+				s.covered++
+			} else {
+				s.uncovered++
+			}
+		}
+	}
+	ret := []*coverageSummary{}
+	for _, s := range byModel {
+		ret = append(ret, s)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].model < ret[j].model
+	})
+	return ret
+}
+
+// writeCoverageSummaries prints a table of coverage summaries.
+func writeCoverageSummaries(out io.Writer, summaries []*coverageSummary) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "FILE\tMODEL\tCOVERED\tUNCOVERED\tCOVERAGE")
+	for _, s := range summaries {
+		percent := "n/a"
+		if total := s.covered + s.uncovered; total > 0 {
+			percent = fmt.Sprintf("%.1f%%", 100*float64(s.covered)/float64(total))
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%s\n", s.fileName, s.model, s.covered, s.uncovered, percent)
+	}
+	return w.Flush()
+}
+
+// uncoveredMarker prefixes generated lines that have statements no test executed.
+const uncoveredMarker = "! "
+
+// annotateCoverage writes the lines of a file like annotateLines does, with
+// uncoveredMarker in front of generated lines that aren't covered by tests.
+func annotateCoverage(fileBytes []byte, blaimRangeSet *blaim.BlaimRangeSet, cov lineCoverage, out io.Writer) {
+	annotated := &strings.Builder{}
+	annotateLines(fileBytes, blaimRangeSet, annotated)
+	lines := strings.Split(strings.TrimSuffix(annotated.String(), "\n"), "\n")
+	for i, line := range lines {
+		lineNumber := i + 1
+		marker := strings.Repeat(" ", len(uncoveredMarker))
+		if covered, ok := cov[lineNumber]; ok && !covered && len(blaimRangeSet.ForSourceLine(lineNumber)) > 0 {
+			marker = uncoveredMarker
+		}
+		fmt.Fprintf(out, "%s%s\n", marker, line)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/banksean/me3/blaim"
+)
+
+const coverageTestProfile = `mode: set
+example.com/m/pkg/example.go:3.14,5.2 1 1
+example.com/m/pkg/example.go:7.14,8.10 1 0
+example.com/m/pkg/example.go:8.10,10.3 1 1
+example.com/m/other.go:1.1,2.2 1 0
+`
+
+func TestParseCoverProfile(t *testing.T) {
+	cov, err := parseCoverProfile(strings.NewReader(coverageTestProfile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cov = repoRelativeCoverage(cov, "example.com/m")
+	expected := lineCoverage{3: true, 4: true, 5: true, 7: false, 8: true, 9: true, 10: true}
+	got := cov["pkg/example.go"]
+	if len(got) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+	for line, covered := range expected {
+		if got[line] != covered {
+			t.Errorf("line %d: expected covered=%v, got %v", line, covered, got[line])
+		}
+	}
+	if _, ok := cov["other.go"]; !ok {
+		t.Errorf("expected coverage for other.go, got %v", cov)
+	}
+
+	if _, err := parseCoverProfile(strings.NewReader("mode: set\nexample.go:1.1,2\n")); err == nil {
+		t.Errorf("expected an error for a malformed block")
+	}
+}
+
+func TestReadModulePath(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte("// comment\nmodule example.com/m\n\ngo 1.21\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	got, err := readModulePath(dir)
+	if err != nil || got != "example.com/m" {
+		t.Errorf("expected example.com/m, got %q (%v)", got, err)
+	}
+}
+
+func TestCoverage(t *testing.T) {
+	rangeSet := blaim.NewBlaimRangeSet([]*blaim.BlaimLine{
+		{
+			FileName:        "example.go",
+			Range:           blaim.Range{Start: blaim.Position{Line: 2}, End: blaim.Position{Line: 4}},
+			InferenceConfig: blaim.InferenceConfig{ModelName: "codegemma"},
+		},
+		{
+			FileName:        "example.go",
+			Range:           blaim.Range{Start: blaim.Position{Line: 6}, End: blaim.Position{Line: 7}},
+			InferenceConfig: blaim.InferenceConfig{ModelName: "codellama"},
+		},
+	})
+	cov := lineCoverage{3: true, 4: false, 7: false, 8: false}
+
+	out := &bytes.Buffer{}
+	if err := writeCoverageSummaries(out, summarizeCoverage("example.go", rangeSet, cov)); err != nil {
+		t.Fatal(err)
+	}
+	expected := `FILE        MODEL      COVERED  UNCOVERED  COVERAGE
+example.go  codegemma  1        1          50.0%
+example.go  codellama  0        1          0.0%
+`
+	if out.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, out.String())
+	}
+
+	out.Reset()
+	annotateCoverage([]byte("a\nb\nc\nd\ne\nf\ng\nh\n"), rangeSet, cov, out)
+	lines := strings.Split(out.String(), "\n")
+	for i, marked := range []bool{false, false, false, true, false, false, true, false} {
+		if strings.HasPrefix(lines[i], uncoveredMarker) != marked {
+			t.Errorf("line %d: expected marked=%v, got %q", i+1, marked, lines[i])
+		}
+	}
+}
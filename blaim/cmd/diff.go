@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/banksean/me3/blaim"
+)
+
+// The kinds of attributionChange.
+const (
+	attributionAdded   = "added"
+	attributionRemoved = "removed"
+	attributionMoved   = "moved"
+)
+
+// attributionChange is a difference between two .blaim files.
+type attributionChange struct {
+	Change   string `json:"change"`
+	FileName string `json:"fileName"`
+	// Range is where the attribution is in the new file, or for a removed
+	// attribution, where it was in the old one.
+	Range blaim.Range `json:"range"`
+	// From is where a moved attribution was in the old file.
+	From            *blaim.Range          `json:"from,omitempty"`
+	Text            string                `json:"text"`
+	InferenceConfig blaim.InferenceConfig `json:"inferenceConfig"`
+}
+
+// attributionDiff describes how one .blaim file differs from another.
+type attributionDiff struct {
+	Changes []attributionChange `json:"changes"`
+	// Unchanged counts the attributions that are in both files at the same range.
+	Unchanged int `json:"unchanged"`
+}
+
+// count returns how many of the changes are of the given kind.
+func (d *attributionDiff) count(change string) int {
+	ret := 0
+	for _, c := range d.Changes {
+		if c.Change == change {
+			ret++
+		}
+	}
+	return ret
+}
+
+// diffAttributions compares the attributions of two .blaim files, as read by
+// blaim.ReadBlaimFile. An attribution of the same text by the same model to the
+// same file is unchanged if it's at the same range in both, and moved if it's
+// at a different one; when there are several, those at the same range are
+// paired first, and the rest in order. Signatures are ignored, so re-signing a
+// file doesn't change anything.
+func diffAttributions(a, b map[string][]*blaim.BlaimLine) *attributionDiff {
+	group := func(byFile map[string][]*blaim.BlaimLine) map[attributionKey][]*blaim.BlaimLine {
+		ret := map[attributionKey][]*blaim.BlaimLine{}
+		for _, lines := range byFile {
+			for _, line := range lines {
+				key := attributionKey{line.FileName, line.Text, line.InferenceConfig}
+				ret[key] = append(ret[key], line)
+			}
+		}
+		for _, lines := range ret {
+			sort.SliceStable(lines, func(i, j int) bool { return rangeLess(lines[i].Range, lines[j].Range) })
+		}
+		return ret
+	}
+	before, after := group(a), group(b)
+	keys := map[attributionKey]bool{}
+	for key := range before {
+		keys[key] = true
+	}
+	for key := range after {
+		keys[key] = true
+	}
+
+	ret := &attributionDiff{Changes: []attributionChange{}}
+	change := func(kind string, line *blaim.BlaimLine) attributionChange {
+		return attributionChange{Change: kind, FileName: line.FileName, Range: line.Range, Text: line.Text, InferenceConfig: line.InferenceConfig}
+	}
+	for key := range keys {
+		removed := []*blaim.BlaimLine{}
+		// Pair up the attributions at the same range first.
+		unmatched := append([]*blaim.BlaimLine{}, after[key]...)
+		for _, old := range before[key] {
+			i := 0
+			for i < len(unmatched) && unmatched[i].Range != old.Range {
+				i++
+			}
+			if i == len(unmatched) {
+				removed = append(removed, old)
+				continue
+			}
+			unmatched = append(unmatched[:i], unmatched[i+1:]...)
+			ret.Unchanged++
+		}
+		added := unmatched
+		for len(removed) > 0 && len(added) > 0 {
+			c := change(attributionMoved, added[0])
+			from := removed[0].Range
+			c.From = &from
+			ret.Changes = append(ret.Changes, c)
+			removed, added = removed[1:], added[1:]
+		}
+		for _, line := range removed {
+			ret.Changes = append(ret.Changes, change(attributionRemoved, line))
+		}
+		for _, line := range added {
+			ret.Changes = append(ret.Changes, change(attributionAdded, line))
+		}
+	}
+	sort.Slice(ret.Changes, func(i, j int) bool {
+		a, b := ret.Changes[i], ret.Changes[j]
+		if a.FileName != b.FileName {
+			return a.FileName < b.FileName
+		}
+		if a.Range != b.Range {
+			return rangeLess(a.Range, b.Range)
+		}
+		if a.Change != b.Change {
+			return a.Change < b.Change
+		}
+		return a.InferenceConfig.ModelName < b.InferenceConfig.ModelName
+	})
+	return ret
+}
+
+// rangeLess orders ranges by where they start, and then where they end.
+func rangeLess(a, b blaim.Range) bool {
+	if a.Start != b.Start {
+		return positionLess(a.Start, b.Start)
+	}
+	return positionLess(a.End, b.End)
+}
+
+func positionLess(a, b blaim.Position) bool {
+	if a.Line != b.Line {
+		return a.Line < b.Line
+	}
+	return a.Character < b.Character
+}
+
+// readBlaimFileAt reads the .blaim file at path, or stdin if path is "-".
+func readBlaimFileAt(path string) (map[string][]*blaim.BlaimLine, error) {
+	if path == "-" {
+		return blaim.ReadBlaimFile(os.Stdin)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	ret, err := blaim.ReadBlaimFile(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return ret, nil
+}
+
+// writeAttributionDiff prints a line for each change and a summary, or the
+// diff as JSON if asJSON is set.
+func writeAttributionDiff(out io.Writer, d *attributionDiff, asJSON bool) error {
+	if asJSON {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(d)
+	}
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	for _, c := range d.Changes {
+		from := ""
+		if c.From != nil {
+			from = fmt.Sprintf("from %d-%d", c.From.Start.Line, c.From.End.Line)
+		}
+		fmt.Fprintf(w, "%s\t%s:%d-%d\t%s\t%s\n", c.Change, c.FileName, c.Range.Start.Line, c.Range.End.Line, from, c.InferenceConfig.ModelName)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(out, "%d added, %d removed, %d moved, %d unchanged\n",
+		d.count(attributionAdded), d.count(attributionRemoved), d.count(attributionMoved), d.Unchanged)
+	return err
+}
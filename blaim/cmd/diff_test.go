@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/banksean/me3/blaim"
+	"github.com/google/go-cmp/cmp"
+)
+
+func diffTestLine(fileName string, start, end int, text, model string) *blaim.BlaimLine {
+	return &blaim.BlaimLine{
+		FileName:        fileName,
+		Range:           blaim.Range{Start: blaim.Position{Line: start}, End: blaim.Position{Line: end, Character: 1}},
+		Text:            text,
+		InferenceConfig: blaim.InferenceConfig{ModelName: model},
+	}
+}
+
+func diffTestFile(lines ...*blaim.BlaimLine) map[string][]*blaim.BlaimLine {
+	ret := map[string][]*blaim.BlaimLine{}
+	for _, line := range lines {
+		ret[line.FileName] = append(ret[line.FileName], line)
+	}
+	return ret
+}
+
+func TestDiffAttributions(t *testing.T) {
+	signed := diffTestLine("a.go", 1, 2, "kept", "codegemma")
+	signed.Signature = &blaim.Signature{Format: blaim.SignatureEd25519, Value: "sig"}
+	a := diffTestFile(
+		diffTestLine("a.go", 1, 2, "kept", "codegemma"),
+		diffTestLine("a.go", 5, 6, "moved", "codegemma"),
+		diffTestLine("a.go", 10, 10, "dup", "codegemma"),
+		diffTestLine("a.go", 20, 20, "dup", "codegemma"),
+		diffTestLine("b.go", 3, 3, "removed", "codellama"),
+		// A different model generating the same text is a different attribution.
+		diffTestLine("b.go", 7, 7, "remodeled", "codellama"),
+	)
+	b := diffTestFile(
+		signed,
+		diffTestLine("a.go", 8, 9, "moved", "codegemma"),
+		diffTestLine("a.go", 20, 20, "dup", "codegemma"),
+		diffTestLine("a.go", 30, 30, "dup", "codegemma"),
+		diffTestLine("b.go", 7, 7, "remodeled", "codegemma"),
+		diffTestLine("c.go", 1, 1, "added", "codegemma"),
+	)
+	d := diffAttributions(a, b)
+	if d.Unchanged != 2 {
+		t.Errorf("expected 2 unchanged attributions, got %d", d.Unchanged)
+	}
+	type change struct {
+		change, fileName string
+		start, from      int
+		model            string
+	}
+	got := []change{}
+	for _, c := range d.Changes {
+		from := 0
+		if c.From != nil {
+			from = c.From.Start.Line
+		}
+		got = append(got, change{c.Change, c.FileName, c.Range.Start.Line, from, c.InferenceConfig.ModelName})
+	}
+	expected := []change{
+		{"moved", "a.go", 8, 5, "codegemma"},
+		{"moved", "a.go", 30, 10, "codegemma"},
+		{"removed", "b.go", 3, 0, "codellama"},
+		{"added", "b.go", 7, 0, "codegemma"},
+		{"removed", "b.go", 7, 0, "codellama"},
+		{"added", "c.go", 1, 0, "codegemma"},
+	}
+	if diff := cmp.Diff(expected, got, cmp.AllowUnexported(change{})); diff != "" {
+		t.Errorf("unexpected changes (-expected +got):\n%s", diff)
+	}
+
+	if d := diffAttributions(a, a); len(d.Changes) != 0 || d.Unchanged != 6 {
+		t.Errorf("expected no changes between a file and itself, got %+v", d)
+	}
+}
+
+func TestWriteAttributionDiff(t *testing.T) {
+	d := diffAttributions(
+		diffTestFile(diffTestLine("a.go", 5, 6, "moved", "codegemma"), diffTestLine("a.go", 9, 9, "removed", "codegemma")),
+		diffTestFile(diffTestLine("a.go", 1, 2, "moved", "codegemma"), diffTestLine("b.go", 3, 3, "added", "codellama")),
+	)
+	out := &bytes.Buffer{}
+	if err := writeAttributionDiff(out, d, false); err != nil {
+		t.Fatal(err)
+	}
+	expected := `moved    a.go:1-2  from 5-6  codegemma
+removed  a.go:9-9            codegemma
+added    b.go:3-3            codellama
+1 added, 1 removed, 1 moved, 0 unchanged
+`
+	if out.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, out.String())
+	}
+
+	out.Reset()
+	if err := writeAttributionDiff(out, d, true); err != nil {
+		t.Fatal(err)
+	}
+	decoded := &attributionDiff{}
+	if err := json.Unmarshal(out.Bytes(), decoded); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(d, decoded); diff != "" {
+		t.Errorf("unexpected JSON round trip (-expected +got):\n%s", diff)
+	}
+	if !strings.Contains(out.String(), `"from": {`) || strings.Count(out.String(), `"from"`) != 1 {
+		t.Errorf("expected only the moved attribution to have a from range, got:\n%s", out.String())
+	}
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"path"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/banksean/me3/blaim"
+)
+
+// evalCorpus is the corpus that eval uses unless it's given another. Each
+// directory is a scenario, as read by readEvalCorpus.
+//
+//go:embed evalcorpus
+var evalCorpus embed.FS
+
+const evalCorpusDir = "evalcorpus"
+
+// evalScenario is a labeled example for measuring the matcher: a diff, the
+// accept log of the editing session that produced it, and the attributions that
+// a perfect matcher would generate from them.
+type evalScenario struct {
+	name      string
+	diff      []byte
+	acceptLog []byte
+	expected  []*blaim.BlaimLine
+}
+
+// readEvalCorpus reads the scenarios in the directories of fsys, sorted by
+// name. Each directory has a diff.txt, an accepted.suggestions.log and an
+// expected_blaim.json in the .blaim file format.
+func readEvalCorpus(fsys fs.FS) ([]*evalScenario, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	ret := []*evalScenario{}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		s := &evalScenario{name: entry.Name()}
+		if s.diff, err = fs.ReadFile(fsys, path.Join(s.name, "diff.txt")); err != nil {
+			return nil, err
+		}
+		if s.acceptLog, err = fs.ReadFile(fsys, path.Join(s.name, "accepted.suggestions.log")); err != nil {
+			return nil, err
+		}
+		expected, err := fs.ReadFile(fsys, path.Join(s.name, "expected_blaim.json"))
+		if err != nil {
+			return nil, err
+		}
+		byFile, err := blaim.ReadBlaimFile(bytes.NewReader(expected))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", s.name, err)
+		}
+		for _, lines := range byFile {
+			s.expected = append(s.expected, lines...)
+		}
+		ret = append(ret, s)
+	}
+	return ret, nil
+}
+
+// matcherVariant is a configuration of the matcher to evaluate.
+type matcherVariant struct {
+	name    string
+	matcher blaim.Matcher
+}
+
+// matcherVariants returns a variant that only matches accept log entries
+// exactly, and one for each of minLCS.
+func matcherVariants(minLCS []int) []matcherVariant {
+	ret := []matcherVariant{{name: "exact", matcher: blaim.Matcher{MinLCS: math.MaxInt}}}
+	for _, n := range minLCS {
+		ret = append(ret, matcherVariant{name: fmt.Sprintf("min-lcs=%d", n), matcher: blaim.Matcher{MinLCS: n}})
+	}
+	return ret
+}
+
+// evalResult scores a matcher variant on a scenario, or on the whole corpus.
+// An attribution is a true positive if the matcher attributes the same text,
+// generated with the same inference config, to the same file as expected.
+// True positives whose lines don't overlap the expected ones are also counted
+// as misplaced.
+type evalResult struct {
+	Matcher        string  `json:"matcher"`
+	Scenario       string  `json:"scenario"`
+	TruePositives  int     `json:"truePositives"`
+	FalsePositives int     `json:"falsePositives"`
+	FalseNegatives int     `json:"falseNegatives"`
+	Misplaced      int     `json:"misplaced"`
+	Precision      float64 `json:"precision"`
+	Recall         float64 `json:"recall"`
+}
+
+// evalTotalScenario is the Scenario of the result for the whole corpus.
+const evalTotalScenario = "total"
+
+// score sets r's precision and recall from its counts. With nothing to
+// measure, e.g. when no attributions are expected or made, they're 1.
+func (r *evalResult) score() {
+	r.Precision, r.Recall = 1, 1
+	if n := r.TruePositives + r.FalsePositives; n > 0 {
+		r.Precision = float64(r.TruePositives) / float64(n)
+	}
+	if n := r.TruePositives + r.FalseNegatives; n > 0 {
+		r.Recall = float64(r.TruePositives) / float64(n)
+	}
+}
+
+func (r *evalResult) add(other evalResult) {
+	r.TruePositives += other.TruePositives
+	r.FalsePositives += other.FalsePositives
+	r.FalseNegatives += other.FalseNegatives
+	r.Misplaced += other.Misplaced
+}
+
+// linesOverlap reports whether the lines of a and b overlap.
+func linesOverlap(a, b blaim.Range) bool {
+	return a.Start.Line <= b.End.Line && b.Start.Line <= a.End.Line
+}
+
+// scoreAttributions compares the attributions a matcher made with those
+// expected. Each expected attribution is paired with a predicted one with the
+// same key, preferring one whose lines overlap it.
+func scoreAttributions(predicted, expected []*blaim.BlaimLine) evalResult {
+	unpaired := map[attributionKey][]*blaim.BlaimLine{}
+	for _, line := range predicted {
+		key := attributionKey{line.FileName, line.Text, line.InferenceConfig}
+		unpaired[key] = append(unpaired[key], line)
+	}
+	ret := evalResult{}
+	for _, line := range expected {
+		key := attributionKey{line.FileName, line.Text, line.InferenceConfig}
+		candidates := unpaired[key]
+		if len(candidates) == 0 {
+			ret.FalseNegatives++
+			continue
+		}
+		i := 0
+		for i < len(candidates) && !linesOverlap(candidates[i].Range, line.Range) {
+			i++
+		}
+		if i == len(candidates) {
+			ret.Misplaced++
+			i = 0
+		}
+		unpaired[key] = append(append([]*blaim.BlaimLine{}, candidates[:i]...), candidates[i+1:]...)
+		ret.TruePositives++
+	}
+	for _, lines := range unpaired {
+		ret.FalsePositives += len(lines)
+	}
+	ret.score()
+	return ret
+}
+
+// evaluate runs generate on s with v's matcher, considering every entry in the
+// accept log, and scores the result.
+func evaluate(s *evalScenario, v matcherVariant) (evalResult, error) {
+	out := &bytes.Buffer{}
+	opts := blaim.GenerateOptions{Matcher: v.matcher}
+	if _, err := blaim.Generate(bytes.NewReader(s.diff), bytes.NewReader(s.acceptLog), out, opts); err != nil {
+		return evalResult{}, fmt.Errorf("%s: %v", s.name, err)
+	}
+	byFile, err := blaim.ReadBlaimFile(out)
+	if err != nil {
+		return evalResult{}, fmt.Errorf("%s: %v", s.name, err)
+	}
+	predicted := []*blaim.BlaimLine{}
+	for _, lines := range byFile {
+		predicted = append(predicted, lines...)
+	}
+	ret := scoreAttributions(predicted, s.expected)
+	ret.Matcher, ret.Scenario = v.name, s.name
+	return ret, nil
+}
+
+// runEval scores each variant on each scenario, followed by its total over
+// all of them.
+func runEval(scenarios []*evalScenario, variants []matcherVariant) ([]evalResult, error) {
+	ret := []evalResult{}
+	for _, v := range variants {
+		total := evalResult{Matcher: v.name, Scenario: evalTotalScenario}
+		for _, s := range scenarios {
+			r, err := evaluate(s, v)
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, r)
+			total.add(r)
+		}
+		total.score()
+		ret = append(ret, total)
+	}
+	return ret, nil
+}
+
+// writeEvalResults prints a table of results, or a JSON array of them if
+// asJSON is set.
+func writeEvalResults(out io.Writer, results []evalResult, asJSON bool) error {
+	if asJSON {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(results)
+	}
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "MATCHER\tSCENARIO\tPRECISION\tRECALL\tTP\tFP\tFN\tMISPLACED")
+	for _, r := range results {
+		fmt.Fprintf(w, "%s\t%s\t%.2f\t%.2f\t%d\t%d\t%d\t%d\n", r.Matcher, r.Scenario, r.Precision, r.Recall, r.TruePositives, r.FalsePositives, r.FalseNegatives, r.Misplaced)
+	}
+	return w.Flush()
+}
+
+// selectEvalScenarios returns the scenarios with the given names, or all of
+// them if names is empty.
+func selectEvalScenarios(scenarios []*evalScenario, names []string) ([]*evalScenario, error) {
+	if len(names) == 0 {
+		return scenarios, nil
+	}
+	byName := map[string]*evalScenario{}
+	all := []string{}
+	for _, s := range scenarios {
+		byName[s.name] = s
+		all = append(all, s.name)
+	}
+	ret := []*evalScenario{}
+	for _, name := range names {
+		s, ok := byName[name]
+		if !ok {
+			return nil, fmt.Errorf("no scenario %q in the corpus; it has %s", name, strings.Join(all, ", "))
+		}
+		ret = append(ret, s)
+	}
+	return ret, nil
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/banksean/me3/blaim"
+)
+
+func readTestEvalCorpus(t *testing.T) []*evalScenario {
+	t.Helper()
+	corpus, err := fs.Sub(evalCorpus, evalCorpusDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scenarios, err := readEvalCorpus(corpus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return scenarios
+}
+
+func TestReadEvalCorpus(t *testing.T) {
+	scenarios := readTestEvalCorpus(t)
+	names := []string{}
+	for _, s := range scenarios {
+		names = append(names, s.name)
+		if len(s.diff) == 0 || len(s.acceptLog) == 0 {
+			t.Errorf("%s: expected a diff and an accept log", s.name)
+		}
+		if (s.name == "human-only") != (len(s.expected) == 0) {
+			t.Errorf("%s: unexpected expected attributions %v", s.name, s.expected)
+		}
+	}
+	if got := strings.Join(names, ","); got != "exact,human-only,moved-code,partial-edit,reformatted,renamed-file" {
+		t.Errorf("unexpected scenarios %s", got)
+	}
+
+	if _, err := readEvalCorpus(fstest.MapFS{"broken/diff.txt": {Data: []byte("")}}); err == nil {
+		t.Errorf("expected an error reading a scenario without an accept log")
+	}
+}
+
+func TestScoreAttributions(t *testing.T) {
+	line := func(fileName string, start, end int, text string) *blaim.BlaimLine {
+		return &blaim.BlaimLine{
+			FileName:        fileName,
+			Range:           blaim.Range{Start: blaim.Position{Line: start}, End: blaim.Position{Line: end}},
+			Text:            text,
+			InferenceConfig: blaim.InferenceConfig{ModelName: "codegemma"},
+		}
+	}
+	for _, test := range []struct {
+		name                string
+		predicted, expected []*blaim.BlaimLine
+		tp, fp, fn, moved   int
+		precision, recall   float64
+	}{
+		{"nothing", nil, nil, 0, 0, 0, 0, 1, 1},
+		{"exact", []*blaim.BlaimLine{line("a.go", 1, 3, "x")}, []*blaim.BlaimLine{line("a.go", 1, 3, "x")}, 1, 0, 0, 0, 1, 1},
+		{"overlapping", []*blaim.BlaimLine{line("a.go", 2, 2, "x")}, []*blaim.BlaimLine{line("a.go", 1, 3, "x")}, 1, 0, 0, 0, 1, 1},
+		{"misplaced", []*blaim.BlaimLine{line("a.go", 5, 6, "x")}, []*blaim.BlaimLine{line("a.go", 1, 3, "x")}, 1, 0, 0, 1, 1, 1},
+		{"wrong file", []*blaim.BlaimLine{line("b.go", 1, 3, "x")}, []*blaim.BlaimLine{line("a.go", 1, 3, "x")}, 0, 1, 1, 0, 0, 0},
+		{
+			"duplicates",
+			[]*blaim.BlaimLine{line("a.go", 20, 20, "x"), line("a.go", 1, 1, "x"), line("a.go", 30, 30, "x")},
+			[]*blaim.BlaimLine{line("a.go", 1, 1, "x"), line("a.go", 20, 20, "x")},
+			2, 1, 0, 0, 2.0 / 3, 1,
+		},
+	} {
+		r := scoreAttributions(test.predicted, test.expected)
+		if r.TruePositives != test.tp || r.FalsePositives != test.fp || r.FalseNegatives != test.fn || r.Misplaced != test.moved {
+			t.Errorf("%s: expected %d/%d/%d/%d true/false positives/false negatives/misplaced, got %+v", test.name, test.tp, test.fp, test.fn, test.moved, r)
+		}
+		if r.Precision != test.precision || r.Recall != test.recall {
+			t.Errorf("%s: expected precision %.2f and recall %.2f, got %+v", test.name, test.precision, test.recall, r)
+		}
+	}
+}
+
+func TestRunEval(t *testing.T) {
+	results, err := runEval(readTestEvalCorpus(t), matcherVariants([]int{blaim.DefaultMinLCS, 40}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3*7 {
+		t.Fatalf("expected a result for each scenario and a total for each of 3 matchers, got %d", len(results))
+	}
+	byName := map[string]evalResult{}
+	for _, r := range results {
+		byName[r.Matcher+" "+r.Scenario] = r
+	}
+	for name, expected := range map[string][3]int{
+		// Exact matching misses suggestions that were edited after they were accepted.
+		"exact partial-edit": {0, 0, 1},
+		"exact reformatted":  {0, 0, 1},
+		// Matching shorter common substrings finds them, but also short
+		// idioms that a suggestion and human-written code share.
+		"min-lcs=20 partial-edit": {1, 0, 0},
+		"min-lcs=20 reformatted":  {1, 0, 0},
+		"min-lcs=20 human-only":   {0, 1, 0},
+		"min-lcs=20 moved-code":   {1, 1, 0},
+		"min-lcs=40 human-only":   {0, 0, 0},
+		"min-lcs=40 moved-code":   {1, 0, 0},
+		// Suggestions accepted before a rename are attributed to the new name.
+		"exact renamed-file":      {1, 0, 0},
+		"min-lcs=40 renamed-file": {1, 0, 0},
+		"min-lcs=40 total":        {4, 0, 1},
+	} {
+		r, ok := byName[name]
+		if !ok {
+			t.Errorf("no result for %s", name)
+			continue
+		}
+		if got := [3]int{r.TruePositives, r.FalsePositives, r.FalseNegatives}; got != expected {
+			t.Errorf("%s: expected true positives, false positives and false negatives %v, got %v", name, expected, got)
+		}
+	}
+
+	out := &bytes.Buffer{}
+	if err := writeEvalResults(out, results[:1], false); err != nil {
+		t.Fatal(err)
+	}
+	expected := "MATCHER  SCENARIO  PRECISION  RECALL  TP  FP  FN  MISPLACED\nexact    exact     1.00       1.00    1   0   0   0\n"
+	if out.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, out.String())
+	}
+}
+
+func TestSelectEvalScenarios(t *testing.T) {
+	scenarios := readTestEvalCorpus(t)
+	selected, err := selectEvalScenarios(scenarios, []string{"reformatted", "exact"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(selected) != 2 || selected[0].name != "reformatted" || selected[1].name != "exact" {
+		t.Errorf("unexpected scenarios %v", selected)
+	}
+	if _, err := selectEvalScenarios(scenarios, []string{"nonexistent"}); err == nil || !strings.Contains(err.Error(), "renamed-file") {
+		t.Errorf("expected an error listing the scenarios, got %v", err)
+	}
+}
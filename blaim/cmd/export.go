@@ -0,0 +1,228 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/banksean/me3/blaim"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// sqliteSchema is the normalized schema written by exportSQLite. Times are
+// stored as RFC 3339 strings, which sort chronologically and work with
+// SQLite's date and time functions.
+const sqliteSchema = `
+CREATE TABLE commits (
+	sha TEXT PRIMARY KEY,
+	author TEXT NOT NULL,
+	time TEXT NOT NULL
+);
+
+CREATE TABLE files (
+	id INTEGER PRIMARY KEY,
+	path TEXT NOT NULL UNIQUE
+);
+
+CREATE TABLE models (
+	id INTEGER PRIMARY KEY,
+	name TEXT NOT NULL UNIQUE
+);
+
+CREATE TABLE inference_configs (
+	id INTEGER PRIMARY KEY,
+	model_id INTEGER NOT NULL REFERENCES models(id),
+	endpoint TEXT NOT NULL,
+	max_lines INTEGER NOT NULL,
+	max_tokens INTEGER NOT NULL,
+	temperature REAL NOT NULL,
+	model_format TEXT NOT NULL,
+	delay INTEGER NOT NULL
+);
+
+-- spans are the generated text ranges recorded in .blaim at each commit.
+CREATE TABLE spans (
+	id INTEGER PRIMARY KEY,
+	commit_sha TEXT NOT NULL REFERENCES commits(sha),
+	file_id INTEGER NOT NULL REFERENCES files(id),
+	inference_config_id INTEGER NOT NULL REFERENCES inference_configs(id),
+	start_line INTEGER NOT NULL,
+	start_character INTEGER NOT NULL,
+	end_line INTEGER NOT NULL,
+	end_character INTEGER NOT NULL,
+	line_count INTEGER NOT NULL,
+	text TEXT NOT NULL
+);
+CREATE INDEX spans_commit ON spans(commit_sha);
+CREATE INDEX spans_file ON spans(file_id);
+
+-- accept_events are the entries of the accept logs.
+CREATE TABLE accept_events (
+	id INTEGER PRIMARY KEY,
+	time TEXT,
+	event TEXT NOT NULL,
+	suggestion_id TEXT,
+	file_id INTEGER NOT NULL REFERENCES files(id),
+	inference_config_id INTEGER NOT NULL REFERENCES inference_configs(id),
+	position_line INTEGER NOT NULL,
+	position_character INTEGER NOT NULL,
+	text TEXT NOT NULL,
+	attributed_text TEXT NOT NULL,
+	partial_accept_kind TEXT,
+	head_commit TEXT,
+	head_branch TEXT
+);
+CREATE INDEX accept_events_time ON accept_events(time);
+`
+
+// sqliteExporter writes rows to the tables in sqliteSchema, assigning ids to
+// files, models and inference configs as they are first seen.
+type sqliteExporter struct {
+	tx        *sql.Tx
+	fileIDs   map[string]int64
+	modelIDs  map[string]int64
+	configIDs map[blaim.InferenceConfig]int64
+}
+
+func (e *sqliteExporter) insert(query string, args ...any) (int64, error) {
+	res, err := e.tx.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+func (e *sqliteExporter) fileID(path string) (int64, error) {
+	if id, ok := e.fileIDs[path]; ok {
+		return id, nil
+	}
+	id, err := e.insert(`INSERT INTO files (path) VALUES (?)`, path)
+	if err != nil {
+		return 0, err
+	}
+	e.fileIDs[path] = id
+	return id, nil
+}
+
+func (e *sqliteExporter) modelID(name string) (int64, error) {
+	if id, ok := e.modelIDs[name]; ok {
+		return id, nil
+	}
+	id, err := e.insert(`INSERT INTO models (name) VALUES (?)`, name)
+	if err != nil {
+		return 0, err
+	}
+	e.modelIDs[name] = id
+	return id, nil
+}
+
+func (e *sqliteExporter) inferenceConfigID(c blaim.InferenceConfig) (int64, error) {
+	if id, ok := e.configIDs[c]; ok {
+		return id, nil
+	}
+	modelID, err := e.modelID(c.ModelName)
+	if err != nil {
+		return 0, err
+	}
+	id, err := e.insert(`INSERT INTO inference_configs (model_id, endpoint, max_lines, max_tokens, temperature, model_format, delay) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		modelID, c.Endpoint, c.MaxLines, c.MaxTokens, c.Temperature, c.ModelFormat, c.Delay)
+	if err != nil {
+		return 0, err
+	}
+	e.configIDs[c] = id
+	return id, nil
+}
+
+func (e *sqliteExporter) addCommit(c *commitAttribution) error {
+	if _, err := e.insert(`INSERT INTO commits (sha, author, time) VALUES (?, ?, ?)`, c.commit, c.author, c.time.UTC().Format(time.RFC3339)); err != nil {
+		return err
+	}
+	for _, line := range c.lines {
+		fileID, err := e.fileID(line.FileName)
+		if err != nil {
+			return err
+		}
+		configID, err := e.inferenceConfigID(line.InferenceConfig)
+		if err != nil {
+			return err
+		}
+		if _, err := e.insert(`INSERT INTO spans (commit_sha, file_id, inference_config_id, start_line, start_character, end_line, end_character, line_count, text) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			c.commit, fileID, configID, line.Range.Start.Line, line.Range.Start.Character, line.Range.End.Line, line.Range.End.Character, lineCount(line), line.Text); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *sqliteExporter) addAcceptEvent(entry *blaim.AcceptLogLine) error {
+	fileID, err := e.fileID(entry.FileName)
+	if err != nil {
+		return err
+	}
+	configID, err := e.inferenceConfigID(entry.InferenceConfig)
+	if err != nil {
+		return err
+	}
+	_, err = e.insert(`INSERT INTO accept_events (time, event, suggestion_id, file_id, inference_config_id, position_line, position_character, text, attributed_text, partial_accept_kind, head_commit, head_branch) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		nullTime(entry.Timestamp), string(entry.EventType()), nullString(entry.SuggestionID), fileID, configID,
+		entry.Position.Line, entry.Position.Character, entry.Text, entry.AttributedText(),
+		nullString(string(entry.PartialAcceptKind)), nullString(entry.HeadGitCommit.Commit), nullString(entry.HeadGitCommit.Name))
+	return err
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+func nullTime(t time.Time) sql.NullString {
+	if t.IsZero() {
+		return sql.NullString{}
+	}
+	return nullString(t.UTC().Format(time.RFC3339Nano))
+}
+
+// exportSQLite writes commits and accept log entries to a new SQLite database at path.
+// It fails if path already exists, unless overwrite is set.
+func exportSQLite(path string, overwrite bool, commits []*commitAttribution, acceptEntries []*blaim.AcceptLogLine) error {
+	if _, err := os.Stat(path); err == nil {
+		if !overwrite {
+			return fmt.Errorf("%s already exists", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	}
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(sqliteSchema); err != nil {
+		return fmt.Errorf("error creating schema: %v", err)
+	}
+	e := &sqliteExporter{
+		tx:        tx,
+		fileIDs:   map[string]int64{},
+		modelIDs:  map[string]int64{},
+		configIDs: map[blaim.InferenceConfig]int64{},
+	}
+	for _, c := range commits {
+		if err := e.addCommit(c); err != nil {
+			return fmt.Errorf("error exporting commit %s: %v", c.commit, err)
+		}
+	}
+	for _, entry := range acceptEntries {
+		if err := e.addAcceptEvent(entry); err != nil {
+			return fmt.Errorf("error exporting accept event: %v", err)
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/banksean/me3/blaim"
+)
+
+func TestExportSQLite(t *testing.T) {
+	commitTime := time.Date(2024, 6, 10, 16, 0, 0, 0, time.UTC)
+	gemma := blaim.InferenceConfig{ModelName: "codegemma", Temperature: 0.2}
+	commits := []*commitAttribution{
+		{commit: "aaaa", author: "Ann", time: commitTime, lines: []*blaim.BlaimLine{
+			{FileName: "a.js", Range: blaim.Range{Start: blaim.Position{Line: 3}, End: blaim.Position{Line: 5}}, Text: "x", InferenceConfig: gemma},
+			{FileName: "b.js", Range: blaim.Range{Start: blaim.Position{Line: 1}, End: blaim.Position{Line: 1}}, Text: "y", InferenceConfig: gemma},
+		}},
+	}
+	acceptEntries, _, err := blaim.ReadAcceptLog(strings.NewReader(eventsAcceptLogText), blaim.AcceptLogOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "out.db")
+	if err := exportSQLite(path, false, commits, acceptEntries); err != nil {
+		t.Fatalf("error exporting: %v", err)
+	}
+	if err := exportSQLite(path, false, commits, acceptEntries); err == nil {
+		t.Errorf("expected an error exporting over an existing database")
+	}
+	if err := exportSQLite(path, true, commits, acceptEntries); err != nil {
+		t.Fatalf("error overwriting: %v", err)
+	}
+
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, test := range []struct {
+		query    string
+		expected string
+	}{
+		{`SELECT COUNT(*) FROM commits`, "1"},
+		{`SELECT COUNT(*) FROM models`, "3"},
+		{`SELECT SUM(line_count) FROM spans JOIN files ON files.id = file_id WHERE path = 'a.js'`, "3"},
+		{`SELECT COUNT(*) FROM spans JOIN inference_configs c ON c.id = inference_config_id JOIN models m ON m.id = c.model_id WHERE m.name = 'codegemma'`, "2"},
+		{`SELECT COUNT(*) FROM accept_events WHERE event = 'shown'`, "3"},
+		{`SELECT attributed_text FROM accept_events WHERE event = 'editedAfterAccept'`, "baz(1);"},
+		{`SELECT time FROM commits`, "2024-06-10T16:00:00Z"},
+	} {
+		var got string
+		if err := db.QueryRow(test.query).Scan(&got); err != nil {
+			t.Errorf("%s: %v", test.query, err)
+			continue
+		}
+		if got != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.query, test.expected, got)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// gitOutput runs git with the given arguments in dir and returns its stdout.
+func gitOutput(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = os.Environ()
+	out, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return "", fmt.Errorf("git %s: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", fmt.Errorf("git %s: %v", strings.Join(args, " "), err)
+	}
+	return string(out), nil
+}
+
+// gitCommitTime returns the committer time of rev in the repository at dir.
+func gitCommitTime(dir, rev string) (time.Time, error) {
+	return gitTime(dir, rev, "%ct")
+}
+
+// gitAuthorTime returns the author time of rev in the repository at dir. Unlike
+// the committer time, it's kept when a commit is amended or rebased.
+func gitAuthorTime(dir, rev string) (time.Time, error) {
+	return gitTime(dir, rev, "%at")
+}
+
+func gitTime(dir, rev, format string) (time.Time, error) {
+	out, err := gitOutput(dir, "log", "-1", "--format="+format, rev)
+	if err != nil {
+		return time.Time{}, err
+	}
+	secs, err := strconv.ParseInt(strings.TrimSpace(out), 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("parsing commit time for %s: %v", rev, err)
+	}
+	return time.Unix(secs, 0), nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/banksean/me3/blaim"
+)
+
+// commitAttribution is the contents of the .blaim file at a single commit,
+// which describes the machine-generated parts of that commit's changes.
+type commitAttribution struct {
+	commit string
+	author string
+	time   time.Time
+	// lines are sorted by file name, then by start position.
+	lines []*blaim.BlaimLine
+}
+
+// readCommitAttributions returns the attributions recorded in blaimFileName for
+// every commit of the git repository at dir that added or modified it, newest first.
+func readCommitAttributions(dir, blaimFileName string) ([]*commitAttribution, error) {
+	out, err := gitOutput(dir, "log", "--format=%H%x00%ct%x00%an", "--diff-filter=AM", "--", blaimFileName)
+	if err != nil {
+		return nil, err
+	}
+	ret := []*commitAttribution{}
+	for _, logLine := range strings.Split(strings.TrimSpace(out), "\n") {
+		if logLine == "" {
+			continue
+		}
+		fields := strings.SplitN(logLine, "\x00", 3)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("unexpected git log output: %q", logLine)
+		}
+		secs, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("parsing commit time for %s: %v", fields[0], err)
+		}
+		lines, err := readBlaimFileAtCommit(dir, fields[0], blaimFileName)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, &commitAttribution{
+			commit: fields[0],
+			author: fields[2],
+			time:   time.Unix(secs, 0),
+			lines:  lines,
+		})
+	}
+	return ret, nil
+}
+
+// readBlaimFileAtCommit returns the BlaimLines in blaimFileName at commit,
+// sorted by file name and then by start position.
+func readBlaimFileAtCommit(dir, commit, blaimFileName string) ([]*blaim.BlaimLine, error) {
+	contents, err := gitOutput(dir, "show", commit+":"+blaimFileName)
+	if err != nil {
+		return nil, err
+	}
+	blaimLinesByFile, err := blaim.ReadBlaimFile(strings.NewReader(contents))
+	if err != nil {
+		return nil, fmt.Errorf("reading %s at %s: %v", blaimFileName, commit, err)
+	}
+	ret := []*blaim.BlaimLine{}
+	for _, blaimLines := range blaimLinesByFile {
+		ret = append(ret, blaimLines...)
+	}
+	sort.SliceStable(ret, func(i, j int) bool {
+		if ret[i].FileName != ret[j].FileName {
+			return ret[i].FileName < ret[j].FileName
+		}
+		if ret[i].Range.Start.Line != ret[j].Range.Start.Line {
+			return ret[i].Range.Start.Line < ret[j].Range.Start.Line
+		}
+		return ret[i].Range.Start.Character < ret[j].Range.Start.Character
+	})
+	return ret, nil
+}
+
+// readAttributionHistory returns every BlaimLine recorded in blaimFileName in
+// any commit of the git repository at dir. generate attributes suggestions
+// accepted before a rename to the file's new name, so for each BlaimLine in a
+// commit that renamed its file, there's also a copy under the old name, as the
+// accept log entry has it.
+func readAttributionHistory(dir, blaimFileName string) ([]*blaim.BlaimLine, error) {
+	commits, err := readCommitAttributions(dir, blaimFileName)
+	if err != nil {
+		return nil, err
+	}
+	renames, err := readRenames(dir)
+	if err != nil {
+		return nil, err
+	}
+	ret := []*blaim.BlaimLine{}
+	for _, c := range commits {
+		for _, line := range c.lines {
+			ret = append(ret, line)
+			if oldName, ok := renames[c.commit][line.FileName]; ok {
+				renamed := *line
+				renamed.FileName = oldName
+				ret = append(ret, &renamed)
+			}
+		}
+	}
+	return ret, nil
+}
+
+// readRenames returns, for each commit of the git repository at dir that
+// renamed files, a map from each renamed file's new name to its old one.
+func readRenames(dir string) (map[string]map[string]string, error) {
+	out, err := gitOutput(dir, "log", "-M", "--diff-filter=R", "--name-status", "--format=commit %H")
+	if err != nil {
+		return nil, err
+	}
+	ret := map[string]map[string]string{}
+	commit := ""
+	for _, line := range strings.Split(out, "\n") {
+		if hash, ok := strings.CutPrefix(line, "commit "); ok {
+			commit = hash
+			continue
+		}
+		// Each rename is "R<similarity> TAB <old name> TAB <new name>".
+		fields := strings.Split(line, "\t")
+		if len(fields) != 3 || !strings.HasPrefix(fields[0], "R") {
+			continue
+		}
+		if ret[commit] == nil {
+			ret[commit] = map[string]string{}
+		}
+		ret[commit][fields[2]] = fields[1]
+	}
+	return ret, nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// newTestRepo creates a git repository in a temporary directory and makes one
+// commit for each of the given sets of files, which map file names to their
+// contents. It returns the repository directory and the commit hashes in the
+// order they were made.
+func newTestRepo(t *testing.T, commits ...map[string]string) (string, []string) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	dir := t.TempDir()
+	run := func(args ...string) string {
+		t.Helper()
+		out, err := gitOutput(dir, args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+	run("init", "-q")
+	hashes := []string{}
+	for i, files := range commits {
+		for name, contents := range files {
+			path := filepath.Join(dir, filepath.FromSlash(name))
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+				t.Fatal(err)
+			}
+			run("add", name)
+		}
+		run("-c", "user.name=Test", "-c", "user.email=test@example.com", "commit", "-q", "--allow-empty", "-m", fmt.Sprintf("commit %d", i))
+		head := run("rev-parse", "HEAD")
+		hashes = append(hashes, head[:len(head)-1])
+	}
+	return dir, hashes
+}
+
+// blaimFile returns the files of a commit that just changes the .blaim file.
+func blaimFile(contents string) map[string]string {
+	return map[string]string{".blaim": contents}
+}
+
+func TestReadCommitAttributions(t *testing.T) {
+	dir, commits := newTestRepo(t, blaimFile(expectedBlaimText), blaimFile("[]\n"))
+	got, err := readCommitAttributions(dir, ".blaim")
+	if err != nil {
+		t.Fatalf("error reading attributions: %v", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("expected 2 commits, got %d", len(got))
+	}
+	// Newest first.
+	if got[0].commit != commits[1] || len(got[0].lines) != 0 {
+		t.Errorf("expected no attributions at %s, got %+v", commits[1], got[0])
+	}
+	if got[1].commit != commits[0] || got[1].author != "Test" || len(got[1].lines) != 1 {
+		t.Errorf("expected 1 attribution by Test at %s, got %+v", commits[0], got[1])
+	}
+	if got[1].lines[0].InferenceConfig.ModelName != "codegemma" {
+		t.Errorf("expected codegemma, got %+v", got[1].lines[0])
+	}
+}
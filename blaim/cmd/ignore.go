@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// ignoreFileName is the name of the file, at the root of the repository, that
+// lists paths blaim should never attribute, in gitignore syntax.
+const ignoreFileName = ".blaimignore"
+
+// ignoreRule is a single pattern from an ignore file.
+type ignoreRule struct {
+	re *regexp.Regexp
+	// negate is set for "!" patterns, which re-include paths that an earlier
+	// pattern excluded.
+	negate bool
+	// dirOnly is set for patterns ending in "/", which only match directories.
+	dirOnly bool
+}
+
+// ignoreRules are the patterns of an ignore file, in order. As in gitignore,
+// the last pattern that matches a path decides whether it's ignored.
+type ignoreRules []ignoreRule
+
+// parseIgnoreRules reads patterns in gitignore syntax: blank lines and lines
+// starting with "#" are skipped, "!" negates a pattern, a trailing "/" matches
+// only directories, a "/" anywhere else anchors the pattern to the root, and
+// "*", "?", "[...]" and "**" match as they do in gitignore.
+func parseIgnoreRules(r io.Reader) (ignoreRules, error) {
+	ret := ignoreRules{}
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimRight(scanner.Text(), " \t")
+		if strings.HasSuffix(line, `\`) {
+			// A trailing "\ " escapes a space that would otherwise be trimmed.
+			line += " "
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule := ignoreRule{}
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimSuffix(line, "/")
+		}
+		anchored := strings.Contains(line, "/")
+		line = strings.TrimPrefix(line, "/")
+		expr, err := ignorePatternToRegexp(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNumber, err)
+		}
+		if !anchored {
+			expr = "(?:.*/)?" + expr
+		}
+		if rule.re, err = regexp.Compile("^" + expr + "$"); err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNumber, err)
+		}
+		ret = append(ret, rule)
+	}
+	return ret, scanner.Err()
+}
+
+// ignorePatternToRegexp converts the body of a gitignore pattern, without
+// its "!" prefix, leading "/" or trailing "/", to a regular expression.
+func ignorePatternToRegexp(pattern string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case c == '\\' && i+1 < len(pattern):
+			i++
+			b.WriteString(regexp.QuoteMeta(string(pattern[i])))
+		case strings.HasPrefix(pattern[i:], "**/"):
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case pattern[i:] == "**" && (i == 0 || pattern[i-1] == '/'):
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end == -1 {
+				return "", fmt.Errorf("unterminated character class in %q", pattern)
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i += end + 1
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return b.String(), nil
+}
+
+// match returns whether the last rule matching path ignores it, and whether
+// any rule matched at all.
+func (rules ignoreRules) match(path string, isDir bool) (ignored, matched bool) {
+	for _, rule := range rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		if rule.re.MatchString(path) {
+			ignored, matched = !rule.negate, true
+		}
+	}
+	return ignored, matched
+}
+
+// ignored reports whether path, relative to the root of the repository, is
+// ignored by rules. As in gitignore, a file in an ignored directory is ignored
+// even if a later pattern would re-include the file itself.
+func (rules ignoreRules) ignored(path string) bool {
+	parts := strings.Split(path, "/")
+	for i := 1; i < len(parts); i++ {
+		if ignored, _ := rules.match(strings.Join(parts[:i], "/"), true); ignored {
+			return true
+		}
+	}
+	ignored, _ := rules.match(path, false)
+	return ignored
+}
+
+// linguistAttributes are the gitattributes that GitHub linguist uses to mark
+// files as generated or vendored, which blaim skips too.
+var linguistAttributes = []string{"linguist-generated", "linguist-vendored"}
+
+// hasLinguistAttribute reports whether either of linguistAttributes is set
+// for path in the repository at root.
+func hasLinguistAttribute(root, path string) (bool, error) {
+	args := append([]string{"check-attr", "-z"}, linguistAttributes...)
+	out, err := gitOutput(root, append(args, "--", path)...)
+	if err != nil {
+		return false, err
+	}
+	// The output is a sequence of NUL-terminated "path, attribute, value" triples.
+	fields := strings.Split(out, "\x00")
+	for i := 0; i+2 < len(fields); i += 3 {
+		if value := fields[i+2]; value == "set" || value == "true" {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// pathFilter decides which files blaim skips: those matching ignorePaths in
+// the config or a pattern in .blaimignore, and those with a linguist-generated
+// or linguist-vendored gitattribute.
+type pathFilter struct {
+	root   string
+	config func(string) bool
+	rules  ignoreRules
+	// checkAttributes is false outside a git checkout, where there are no gitattributes.
+	checkAttributes bool
+	cache           map[string]bool
+}
+
+// newPathFilter reads the .blaimignore file at the root of the repository at
+// root, if there is one.
+func newPathFilter(root string, c *config) (*pathFilter, error) {
+	f := &pathFilter{root: root, config: c.ignoreFunc(), cache: map[string]bool{}}
+	ignoreFile, err := os.Open(filepath.Join(root, ignoreFileName))
+	if err == nil {
+		f.rules, err = parseIgnoreRules(ignoreFile)
+		ignoreFile.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", ignoreFileName, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	_, err = gitOutput(root, "rev-parse", "--git-dir")
+	f.checkAttributes = err == nil
+	return f, nil
+}
+
+// ignored reports whether blaim should skip path, relative to the root of the
+// repository. Errors looking up gitattributes are logged and the file is kept.
+func (f *pathFilter) ignored(path string) bool {
+	if path == "" {
+		return false
+	}
+	if ignored, ok := f.cache[path]; ok {
+		return ignored
+	}
+	ignored := (f.config != nil && f.config(path)) || f.rules.ignored(path)
+	if !ignored && f.checkAttributes {
+		var err error
+		if ignored, err = hasLinguistAttribute(f.root, path); err != nil {
+			fmt.Fprintf(os.Stderr, "not checking gitattributes of %s: %v\n", path, err)
+		}
+	}
+	f.cache[path] = ignored
+	return ignored
+}
+
+var noIgnoreFlag = &cli.BoolFlag{
+	Name:  "no-ignore",
+	Usage: "include files matched by .blaimignore, ignorePaths in .blaimrc, or linguist-generated and linguist-vendored gitattributes",
+}
+
+// ignoreFromFlags returns the filter for the repository at the root of the
+// config, or nil if --no-ignore is set.
+func ignoreFromFlags(cCtx *cli.Context) (func(string) bool, error) {
+	if cCtx.Bool("no-ignore") {
+		return nil, nil
+	}
+	f, err := newPathFilter(cfg.root, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return f.ignored, nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIgnoreRules(t *testing.T) {
+	rules, err := parseIgnoreRules(strings.NewReader(`
+# lockfiles
+*.lock
+package-lock.json
+
+/build/
+vendor/
+!vendor/keep.go
+docs/**/*.gen.md
+gen/*
+!gen/hand_written.go
+\#notes
+file[0-9].txt
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for path, expected := range map[string]bool{
+		"Cargo.lock":                    true,
+		"web/yarn.lock":                 true,
+		"web/package-lock.json":         true,
+		"build/out.go":                  true,
+		"cmd/build/main.go":             false,
+		"build":                         false,
+		"vendor/x/y.go":                 true,
+		"third_party/vendor/x.go":       true,
+		"vendor/keep.go":                true, // its directory is ignored
+		"docs/a.gen.md":                 true,
+		"docs/a/b/c.gen.md":             true,
+		"other/docs/a.gen.md":           false,
+		"gen/types.go":                  true,
+		"gen/hand_written.go":           false,
+		"#notes":                        true,
+		"file1.txt":                     true,
+		"fileA.txt":                     false,
+		"main.go":                       false,
+		"internal/lockfile/lockfile.go": false,
+	} {
+		if got := rules.ignored(path); got != expected {
+			t.Errorf("%s: expected ignored %v, got %v", path, expected, got)
+		}
+	}
+
+	if _, err := parseIgnoreRules(strings.NewReader("ok\nfile[0-9.txt\n")); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("expected an error on line 2, got %v", err)
+	}
+}
+
+func TestPathFilter(t *testing.T) {
+	dir, _ := newTestRepo(t)
+	writeConfigFile(t, dir, ignoreFileName, "*.lock\n")
+	writeConfigFile(t, dir, ".gitattributes", "api/*.pb.go linguist-generated\nthird_party/** linguist-vendored=true\nsrc/*.go linguist-generated=false\n")
+	c := defaultConfig()
+	c.IgnorePaths = []string{"testdata/**"}
+	f, err := newPathFilter(dir, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for path, expected := range map[string]bool{
+		"go.lock":          true,
+		"api/api.pb.go":    true,
+		"third_party/x.go": true,
+		"testdata/a.txt":   true,
+		"src/main.go":      false,
+		"api/api.go":       false,
+	} {
+		if got := f.ignored(path); got != expected {
+			t.Errorf("%s: expected ignored %v, got %v", path, expected, got)
+		}
+	}
+}
+
+func TestPathFilterOutsideGit(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, ignoreFileName), []byte("*.lock\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := newPathFilter(dir, defaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !f.ignored("a.lock") || f.ignored("a.go") {
+		t.Errorf("expected only a.lock to be ignored")
+	}
+}
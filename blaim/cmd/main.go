@@ -2,251 +2,96 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
 	"io"
+	"io/fs"
 	"log"
+	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/banksean/me3/blaim"
 
-	"github.com/lithammer/fuzzysearch/fuzzy"
-	"github.com/sourcegraph/go-diff/diff"
 	"github.com/urfave/cli/v2"
-	"gopkg.in/vmarkovtsev/go-lcss.v1"
+	"golang.org/x/crypto/ssh"
 )
 
-const (
-	minEditDistanceSimilarity = 0.8
-	minLCS                    = 20
-)
-
-// processAcceptedSuggestionsLog parses the contents of a "accepted.suggestions.log" file
-// which the VS Code extension has been writing entries to as the user has edited
-// code and accepted AI-generated suggestions.
-func processAcceptedSuggestionsLog(in io.Reader) (map[string][]*blaim.AcceptLogLine, error) {
-	ret := map[string][]*blaim.AcceptLogLine{}
-
-	b, err := io.ReadAll(in)
-	if err != nil {
-		return nil, err
-	}
-	lines := strings.Split(string(b), "\n")
-	for _, line := range lines {
-		parsed, err := blaim.ParseAcceptLogLine(line)
-		if err != nil {
-			return nil, fmt.Errorf("error: %v", err)
-		}
-		if parsed == nil {
-			continue
-		}
-		if _, ok := ret[parsed.FileName]; !ok {
-			ret[parsed.FileName] = []*blaim.AcceptLogLine{}
-		}
-		ret[parsed.FileName] = append(ret[parsed.FileName], parsed)
-	}
-	return ret, nil
-}
-
-// Diff hunks contain both additions and deletions, but we only
-// care about the additions here. Returns the text of just the added
-// lines, if any, and the offset for the line within the hunk where
-// the additions start.
-func getAdditions(body string) string {
-	ret := []string{}
-	for _, line := range strings.Split(body, "\n") {
-		if strings.HasPrefix(line, "+") {
-			ret = append(ret, line[1:])
-		}
-	}
-	return strings.Join(ret, "\n")
-}
-
-// Parses the accept logs, compares their contents to the current git diff results
-// and produces a json-formatted array of BlaimLine objects, one for each git diff hunk
-// that contains text that appears in the accept logs.
-func generate(diffStream, logReader io.Reader, out io.Writer) error {
-	diffReader := diff.NewMultiFileDiffReader(diffStream)
-
-	acceptsForFile, err := processAcceptedSuggestionsLog(logReader)
-	if err != nil {
-		return fmt.Errorf("error processing accept log: %v", err)
-	}
-
-	// Read the git diff output and check for blaim entries for each file mentioned
-	// in the diff.
-	for {
-		fdiff, err := diffReader.ReadFile()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return fmt.Errorf("err reading diff: %s", err)
-		}
-		// Strip the "a/" and "b/" prefixes from the diff file names.
-		origName := fdiff.OrigName[2:]
-		newName := fdiff.NewName[2:]
-		accepts := acceptsForFile[origName]
-		// If the filename changed in this diff, group the accept logs for the
-		// old name and the new name together.
-		if newName != origName {
-			accepts = append(accepts, acceptsForFile[newName]...)
-		}
-		blaimLines := []blaim.BlaimLine{}
-		// Now check each "hunk" in the diff'd file to see if there are any
-		// entries in the .blaim file about it.
-		for _, hunk := range fdiff.Hunks {
-			addedInDiffHunk := getAdditions(string(hunk.Body))
-			// Now find any acceptLog entriesd that match the added text.
-			matchingBlaimLines := getMatchingAcceptLogsForHunk(accepts, addedInDiffHunk)
-			// Offset the line numbers in the blaim entries by the start line of the hunk
-			// so they line up with the full file contents.
-			for _, match := range matchingBlaimLines {
-				match.Range.Start.Line += int(hunk.NewStartLine) + 1
-				match.Range.End.Line += int(hunk.NewStartLine) + 1
-				blaimLines = append(blaimLines, match)
-			}
-		}
-		if len(blaimLines) == 0 {
-			continue
-		}
-		m := json.NewEncoder(out)
-		m.SetIndent("", "  ")
-		err = m.Encode(blaimLines)
-		if err != nil {
-			return fmt.Errorf("error marshaling blaimLines: %v", err)
-		}
-	}
-	return nil
-}
-
-func indexToPos(s string, i int) blaim.Position {
-	prefixLines := strings.Split(s[:i], "\n")
-	startLine := len(prefixLines) + 1
-	startChar := i - len(strings.Join(prefixLines[:len(prefixLines)-1], "\n"))
-	return blaim.Position{
-		Line:      startLine,
-		Character: startChar,
-	}
-}
-
-// Things to watch out for:
-// - The accept log text may not exactly match the diff text, so we need to do some fuzzy matching.
-// - The accept log text may span multiple lines, so we need to handle that.
-// - The line numbers in the accept log may not match the line numbers in the diff
-// - The user may have accepted suggstions in a different order than they appear in the diff
-func getMatchingAcceptLogsForHunk(accepts []*blaim.AcceptLogLine, addedInDiffHunk string) []blaim.BlaimLine {
-	blaimLines := []blaim.BlaimLine{}
-	for _, accept := range accepts {
-		targetString := accept.Text
-		startIdx := strings.Index(addedInDiffHunk, targetString)
-		endIdx := -1
-		if startIdx >= 0 { // exact match
-			// the accepted text starts at lineOffset within the diff hunk, so count the newlines preceding the accepted text
-			endIdx = startIdx + len(targetString)
-		} else { // check for a fuzzy match
-			// This edit distance check skips too many true positives, so we're not using it for now.
-			if false {
-				ld := fuzzy.LevenshteinDistance(addedInDiffHunk, targetString)
-				similarity := float32(len(addedInDiffHunk)-ld) / float32(len(addedInDiffHunk))
-
-				fmt.Printf("similarity: %f\n", similarity)
-				if similarity < minEditDistanceSimilarity {
-					continue
-				}
-			}
-
-			// Find the longest common substring between the diff hunk and the accept log text
-			targetString = string(lcss.LongestCommonSubstring([]byte(addedInDiffHunk), []byte(targetString)))
-			if len(targetString) < minLCS {
-				continue
-			}
-			startIdx = strings.Index(addedInDiffHunk, targetString)
-			endIdx = startIdx + len(targetString)
-		}
-		if endIdx == -1 { // no match
-			continue
-		}
-
-		startPos, endPos := indexToPos(addedInDiffHunk, startIdx), indexToPos(addedInDiffHunk, endIdx)
-		blaimLine := blaim.BlaimLine{
-			FileName: accept.FileName,
-			Range: blaim.Range{
-				Start: startPos,
-				End:   endPos,
-			},
-			Text:            accept.Text,
-			InferenceConfig: accept.InferenceConfig,
-		}
-		blaimLines = append(blaimLines, blaimLine)
-	}
-	return blaimLines
-}
-
-// Represents the set of blaim lines and ranges for a particular source file.
-type BlaimRangeSet struct {
-	blaimLines []*blaim.BlaimLine
-}
-
-// ForSourceLine returns the BlaimLines that cover that line of the source file.
-func (s *BlaimRangeSet) ForSourceLine(lineNumber int) []*blaim.BlaimLine {
-	ret := []*blaim.BlaimLine{}
-	for _, blaimLine := range s.blaimLines {
-		if lineNumber >= blaimLine.Range.Start.Line &&
-			lineNumber <= blaimLine.Range.End.Line {
-			ret = append(ret, blaimLine)
-		}
-	}
-	return ret
-}
-
 func formatAnnotationLinePrefix(line *blaim.BlaimLine) string {
 	return fmt.Sprintf("[%s, temp: %.1f] ", line.InferenceConfig.ModelName, line.InferenceConfig.Temperature)
 }
 
+// annotateOptions controls how annotate writes each line.
+type annotateOptions struct {
+	// prefix formats the annotation in front of each generated line.
+	prefix func(*blaim.BlaimLine) string
+	// color, if set, colors generated lines by the model that generated them,
+	// after a legend of the models' colors, and dims the other lines.
+	color bool
+}
+
 // parses a json-formatted list of BlaimLine objects from stdin,
 // and produces a line-by-line annotation of AI-generated code for
 // each file mentioned in the BlaimLine input list.
-func annotate(blaimReader io.Reader, out io.Writer) error {
+func annotate(blaimReader io.Reader, out io.Writer, opts annotateOptions) error {
 	// Group the blaim lines by the source file path they refer to.
-	blaimLinesByFile, err := readBlaimFile(blaimReader)
+	blaimLinesByFile, err := blaim.ReadBlaimFile(blaimReader)
 	if err != nil {
 		return err
 	}
+	var colors map[string]string
+	if opts.color {
+		colors = assignModelColors(blaimLinesByFile)
+		writeModelLegend(out, colors)
+	}
+	fileNames := []string{}
+	for fileName := range blaimLinesByFile {
+		fileNames = append(fileNames, fileName)
+	}
+	sort.Strings(fileNames)
 
 	// Read the contents of each file in the diff
-	for fileName, fileBlaimLines := range blaimLinesByFile {
-		blaimRangeSet := &BlaimRangeSet{
-			blaimLines: fileBlaimLines,
-		}
+	for _, fileName := range fileNames {
+		blaimRangeSet := blaim.NewBlaimRangeSet(blaimLinesByFile[fileName])
 		fileBytes, err := os.ReadFile(filepath.Join(baseDir, fileName))
 		if err != nil {
 			return err
 		}
 
-		annotateLines(fileBytes, blaimRangeSet, out)
+		annotateLinesWithPrefix(fileBytes, blaimRangeSet, out, opts.prefix, colors)
 	}
 	return nil
 }
 
-func annotateLines(fileBytes []byte, blaimRangeSet *BlaimRangeSet, out io.Writer) {
+func annotateLines(fileBytes []byte, blaimRangeSet *blaim.BlaimRangeSet, out io.Writer) {
+	annotateLinesWithPrefix(fileBytes, blaimRangeSet, out, formatAnnotationLinePrefix, nil)
+}
+
+// annotateLinesWithPrefix writes each line of a file with prefix's annotation
+// in front of generated lines. If colors is non-nil, generated lines are
+// colored by model, and the others dimmed.
+func annotateLinesWithPrefix(fileBytes []byte, blaimRangeSet *blaim.BlaimRangeSet, out io.Writer, prefix func(*blaim.BlaimLine) string, colors map[string]string) {
 	fileLines := strings.Split(string(fileBytes), "\n")
 	prefixLines := []string{}
+	lineColors := []string{}
 
 	longestLinePrefixLen := 0
 
 	for lineNumber := range fileLines {
 		blaimLineMatches := blaimRangeSet.ForSourceLine(lineNumber + 1)
 		if len(blaimLineMatches) > 0 {
-			linePrefix := formatAnnotationLinePrefix(blaimLineMatches[0])
+			linePrefix := prefix(blaimLineMatches[0])
 			prefixLines = append(prefixLines, linePrefix)
+			lineColors = append(lineColors, colors[blaimLineMatches[0].InferenceConfig.ModelName])
 			if len(linePrefix) > longestLinePrefixLen {
 				longestLinePrefixLen = len(linePrefix)
 			}
 		} else {
 			prefixLines = append(prefixLines, "")
+			lineColors = append(lineColors, ansiDim)
 		}
 	}
 
@@ -255,39 +100,162 @@ func annotateLines(fileBytes []byte, blaimRangeSet *BlaimRangeSet, out io.Writer
 		linePrefix := prefixLines[lineNumber]
 		if linePrefix == "" {
 			linePrefix = defaultPrefix
+		} else {
+			linePrefix += strings.Repeat(" ", longestLinePrefixLen-len(linePrefix))
+		}
+		if colors != nil {
+			fmt.Fprintf(out, "%s%s%s%s\n", lineColors[lineNumber], linePrefix, lineText, ansiReset)
+			continue
 		}
 		fmt.Fprintf(out, "%s%s\n", linePrefix, lineText)
 	}
 }
 
-func readBlaimFile(blaimReader io.Reader) (map[string][]*blaim.BlaimLine, error) {
-	um := json.NewDecoder(blaimReader)
-	blaimLines := []*blaim.BlaimLine{}
-	for {
-		err := um.Decode(&blaimLines)
-		if err == io.EOF {
-			break
-		} else if err != nil {
-			fmt.Printf("error decoding BlaimLines: %v", err)
-			return nil, err
+// windowFromFlags returns the blaim.TimeWindow selected by the --since and --until flags.
+func windowFromFlags(cCtx *cli.Context) (blaim.TimeWindow, error) {
+	now := time.Now()
+	since, err := parseTimeFlag(cCtx.String("since"), now)
+	if err != nil {
+		return blaim.TimeWindow{}, fmt.Errorf("invalid --since: %v", err)
+	}
+	until, err := parseTimeFlag(cCtx.String("until"), now)
+	if err != nil {
+		return blaim.TimeWindow{}, fmt.Errorf("invalid --until: %v", err)
+	}
+	return blaim.TimeWindow{Since: since, Until: until}, nil
+}
+
+// generateWindow works out which accept log entries generate should consider,
+// from the --since and --until flags. Unless --since is given or --all-history
+// is set, entries are scoped to those accepted after the parent of the commit
+// being attributed, since anything older can only falsely match new code.
+func generateWindow(cCtx *cli.Context) (blaim.TimeWindow, error) {
+	window, err := windowFromFlags(cCtx)
+	if err != nil {
+		return window, err
+	}
+	if window.Since.IsZero() && !cCtx.Bool("all-history") {
+		parentTime, err := parentCommitTime(baseDir, cCtx.Bool("amend"))
+		if err != nil {
+			// Probably a repository with no commits yet, so there's nothing to scope to.
+			log.Printf("not scoping accept log to the parent commit's time: %v", err)
+		} else {
+			window.Since = parentTime
 		}
 	}
-	blaimLinesByFile := map[string][]*blaim.BlaimLine{}
+	return window, nil
+}
+
+// parentCommitTime returns the author time of the parent of the commit being
+// attributed in the repository at dir: HEAD, or HEAD~1 when amending HEAD. The
+// author time is used because rebasing or amending the parent changes its
+// committer time, which could then be after suggestions for the commit being
+// written were accepted.
+func parentCommitTime(dir string, amend bool) (time.Time, error) {
+	if amend {
+		return gitAuthorTime(dir, "HEAD~1")
+	}
+	return gitAuthorTime(dir, "HEAD")
+}
+
+// acceptLogFlags returns the flags shared by commands that read the accept log.
+// sinceUsage describes the default for --since, which differs between commands.
+func acceptLogFlags(sinceUsage string) []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:        "accept-log",
+			Value:       "",
+			Usage:       "path to the accepted.suggestions.log file",
+			Destination: &acceptedSuggestionsLogPath,
+		},
+		&cli.StringFlag{
+			Name:  "since",
+			Usage: sinceUsage,
+		},
+		&cli.StringFlag{
+			Name:  "until",
+			Usage: "only consider suggestions logged before this time (e.g. 2024-06-10 15:04:05, or a duration like 24h)",
+		},
+		&cli.BoolFlag{
+			Name:  "strict",
+			Usage: "fail if any non-empty line of the accept log is not a valid entry",
+		},
+		&cli.BoolFlag{
+			Name:  "lenient",
+			Usage: "skip accept log entries that can't be parsed, instead of failing",
+		},
+	}
+}
+
+// includeProxyCompletionsFlag makes generate and watch attribute completions recorded by blaim proxy.
+var includeProxyCompletionsFlag = &cli.BoolFlag{
+	Name:  "include-proxy-completions",
+	Usage: "attribute completions recorded by blaim proxy where their text appears exactly in the diff, though they may never have been accepted",
+}
+
+// parsePolicyFromFlags returns the blaim.ParsePolicy selected by the --strict and --lenient flags.
+func parsePolicyFromFlags(cCtx *cli.Context) (blaim.ParsePolicy, error) {
+	switch {
+	case cCtx.Bool("strict") && cCtx.Bool("lenient"):
+		return blaim.ParseDefault, fmt.Errorf("--strict and --lenient are mutually exclusive")
+	case cCtx.Bool("strict"):
+		return blaim.ParseStrict, nil
+	case cCtx.Bool("lenient"):
+		return blaim.ParseLenient, nil
+	}
+	return blaim.ParseDefault, nil
+}
 
-	for _, blaimLine := range blaimLines {
-		if _, ok := blaimLinesByFile[blaimLine.FileName]; !ok {
-			blaimLinesByFile[blaimLine.FileName] = []*blaim.BlaimLine{}
+// generateOptionsFromFlags returns the options for generating a .blaim file
+// from the accept log entries in window, from the flags shared by generate and
+// watch.
+func generateOptionsFromFlags(cCtx *cli.Context, window blaim.TimeWindow) (blaim.GenerateOptions, error) {
+	policy, err := parsePolicyFromFlags(cCtx)
+	if err != nil {
+		return blaim.GenerateOptions{}, err
+	}
+	ignore, err := ignoreFromFlags(cCtx)
+	if err != nil {
+		return blaim.GenerateOptions{}, err
+	}
+	opts := blaim.GenerateOptions{
+		AcceptLog: blaim.AcceptLogOptions{
+			Window:             window,
+			Policy:             policy,
+			NormalizeFileName:  acceptLogFileNames(),
+			IncludeCompletions: cCtx.Bool(includeProxyCompletionsFlag.Name),
+		},
+		Matcher: blaim.Matcher{MinLCS: cfg.Match.MinLCS},
+		Ignore:  ignore,
+	}
+	if cCtx.IsSet("min-lcs") {
+		opts.Matcher.MinLCS = cCtx.Int("min-lcs")
+	}
+	if keyPath := cCtx.String("signing-key"); keyPath != "" {
+		if opts.Signer, err = loadRecordSigner(keyPath); err != nil {
+			return opts, fmt.Errorf("error loading signing key: %v", err)
 		}
-		blaimLinesByFile[blaimLine.FileName] = append(blaimLinesByFile[blaimLine.FileName], blaimLine)
 	}
-	return blaimLinesByFile, nil
+	return opts, nil
 }
 
 var (
 	baseDir                    string
 	acceptedSuggestionsLogPath string
+	configPath                 string
+	// cfg is the repository's .blaimrc, or the --config file, loaded before any command runs.
+	cfg *config
 )
 
+// blaimFileName returns the --blaim-file flag if it was given, and otherwise
+// the .blaim file named in the config.
+func blaimFileName(cCtx *cli.Context) string {
+	if cCtx.IsSet("blaim-file") {
+		return cCtx.String("blaim-file")
+	}
+	return cfg.Storage.BlaimFile
+}
+
 func main() {
 	app := &cli.App{
 		Flags: []cli.Flag{
@@ -297,12 +265,694 @@ func main() {
 				Usage:       "path to the root of the git checkout",
 				Destination: &baseDir,
 			},
+			&cli.StringFlag{
+				Name:        "config",
+				Usage:       "read settings from this file instead of the .blaimrc at the root of the git checkout",
+				Destination: &configPath,
+			},
+		},
+		Before: func(cCtx *cli.Context) error {
+			var err error
+			if configPath != "" {
+				cfg, err = loadConfig(configPath, filepath.Dir(configPath))
+			} else {
+				cfg, err = findConfig(repoRoot(baseDir))
+			}
+			if err != nil {
+				return fmt.Errorf("error reading config: %v", err)
+			}
+			return nil
 		},
 		Commands: []*cli.Command{
 			{
 				Name:    "generate",
 				Aliases: []string{"g"},
 				Usage:   "generate a .blaim file from git diff output at stdin, and the contents of accepted.suggestions.log",
+				Flags: append(acceptLogFlags("only consider suggestions accepted at or after this time (e.g. 2024-06-10 15:04:05, or a duration like 24h); defaults to the HEAD commit's author time (HEAD~1's with --amend)"),
+					&cli.BoolFlag{
+						Name:  "all-history",
+						Usage: "consider every suggestion in the accept log, not just those accepted since the HEAD commit was authored",
+					},
+					&cli.BoolFlag{
+						Name:  "amend",
+						Usage: "scope the accept log to HEAD~1 rather than HEAD, for attributing a commit that amends HEAD",
+					},
+					&cli.BoolFlag{
+						Name:  "diagnostics",
+						Usage: "print a summary of used, skipped and failed accept log entries, with the line number of each problem, to stderr",
+					},
+					&cli.StringFlag{
+						Name:  "signing-key",
+						Usage: "sign each record with this private key: a PKCS #8 ed25519 key, or an unencrypted OpenSSH key",
+					},
+					&cli.IntFlag{
+						Name:  "min-lcs",
+						Usage: "minimum length of text shared by an accept log entry and a diff hunk for an inexact match; defaults to match.minLCS in .blaimrc",
+					},
+					noIgnoreFlag,
+					includeProxyCompletionsFlag,
+				),
+				Action: func(cCtx *cli.Context) error {
+					window, err := generateWindow(cCtx)
+					if err != nil {
+						return err
+					}
+					opts, err := generateOptionsFromFlags(cCtx, window)
+					if err != nil {
+						return err
+					}
+					logPaths, err := cfg.acceptLogPaths(acceptedSuggestionsLogPath)
+					if err != nil {
+						return err
+					}
+					logReader, closeLogs, err := openAcceptLogs(logPaths)
+					if err != nil {
+						return err
+					}
+					defer closeLogs()
+
+					report, err := blaim.Generate(os.Stdin, logReader, os.Stdout, opts)
+					if report != nil && cCtx.Bool("diagnostics") {
+						report.Write(os.Stderr)
+					}
+					return err
+				},
+			},
+			{
+				Name:  "watch",
+				Usage: "keep a .blaim file up to date with the uncommitted changes in the git checkout, as files and the accept log change",
+				Flags: append(acceptLogFlags("only consider suggestions accepted at or after this time (e.g. 2024-06-10 15:04:05, or a duration like 24h); defaults to the HEAD commit's author time, following new commits"),
+					&cli.BoolFlag{
+						Name:  "all-history",
+						Usage: "consider every suggestion in the accept log, not just those accepted since the HEAD commit was authored",
+					},
+					&cli.StringFlag{
+						Name:  "blaim-file",
+						Usage: "path of the .blaim file to keep up to date, relative to the root of the git checkout; defaults to storage.blaimFile in .blaimrc, or .blaim",
+					},
+					&cli.StringFlag{
+						Name:  "signing-key",
+						Usage: "sign each record with this private key: a PKCS #8 ed25519 key, or an unencrypted OpenSSH key",
+					},
+					&cli.IntFlag{
+						Name:  "min-lcs",
+						Usage: "minimum length of text shared by an accept log entry and a diff hunk for an inexact match; defaults to match.minLCS in .blaimrc",
+					},
+					noIgnoreFlag,
+					includeProxyCompletionsFlag,
+				),
+				Action: func(cCtx *cli.Context) error {
+					window, err := windowFromFlags(cCtx)
+					if err != nil {
+						return err
+					}
+					opts, err := generateOptionsFromFlags(cCtx, window)
+					if err != nil {
+						return err
+					}
+					logPaths, err := cfg.acceptLogPaths(acceptedSuggestionsLogPath)
+					if err != nil {
+						return err
+					}
+					root, err := filepath.Abs(repoRoot(baseDir))
+					if err != nil {
+						return err
+					}
+					outPath := filepath.Join(root, blaimFileName(cCtx))
+					sinceHEAD := window.Since.IsZero() && !cCtx.Bool("all-history")
+					w, err := newWorkingTreeWatcher(root, newWorkingAttribution(root, outPath, logPaths, opts, sinceHEAD))
+					if err != nil {
+						return fmt.Errorf("error watching %s: %v", root, err)
+					}
+					defer w.Close()
+					log.Printf("watching %s and %s, writing %s", root, strings.Join(logPaths, ", "), outPath)
+					return w.run(nil, func(changed bool) {
+						if changed {
+							log.Printf("updated %s", outPath)
+						}
+					})
+				},
+			},
+			{
+				Name:  "symbols",
+				Usage: "report how much of each function, method and type was generated, for files mentioned in a .blaim file at stdin",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "all",
+						Usage: "include symbols with no generated lines",
+					},
+					&cli.BoolFlag{
+						Name:  "json",
+						Usage: "write JSON instead of a table; defaults to output.format in .blaimrc",
+					},
+				},
+				Action: func(cCtx *cli.Context) error {
+					blaimLinesByFile, err := blaim.ReadBlaimFile(os.Stdin)
+					if err != nil {
+						return err
+					}
+					fileNames := []string{}
+					for fileName := range blaimLinesByFile {
+						fileNames = append(fileNames, fileName)
+					}
+					sort.Strings(fileNames)
+
+					attrs := []symbolAttribution{}
+					for _, fileName := range fileNames {
+						src, err := os.ReadFile(filepath.Join(baseDir, fileName))
+						if err != nil {
+							return err
+						}
+						fileAttrs, ok, err := attributeSymbols(fileName, src, blaim.NewBlaimRangeSet(blaimLinesByFile[fileName]))
+						if err != nil {
+							return err
+						}
+						if !ok {
+							log.Printf("skipping %s: no symbol extractor for %q files", fileName, filepath.Ext(fileName))
+							continue
+						}
+						for _, a := range fileAttrs {
+							if a.GeneratedLines > 0 || cCtx.Bool("all") {
+								attrs = append(attrs, a)
+							}
+						}
+					}
+					asJSON := cfg.Output.Format == "json"
+					if cCtx.IsSet("json") {
+						asJSON = cCtx.Bool("json")
+					}
+					return writeSymbolAttributions(os.Stdout, attrs, asJSON)
+				},
+			},
+			{
+				Name:  "coverage",
+				Usage: "report how many generated lines, for files mentioned in a .blaim file at stdin, are covered by tests",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "coverprofile",
+						Usage:    "coverage profile written by go test -coverprofile",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:  "module",
+						Usage: "module path of the files in the coverage profile; defaults to the module in go.mod at the repository root",
+					},
+					&cli.BoolFlag{
+						Name:  "annotate",
+						Usage: "annotate each file like the annotate command, marking uncovered generated lines with \"!\"",
+					},
+				},
+				Action: func(cCtx *cli.Context) error {
+					blaimLinesByFile, err := blaim.ReadBlaimFile(os.Stdin)
+					if err != nil {
+						return err
+					}
+					profile, err := os.Open(cCtx.String("coverprofile"))
+					if err != nil {
+						return err
+					}
+					defer profile.Close()
+					profileCoverage, err := parseCoverProfile(profile)
+					if err != nil {
+						return fmt.Errorf("error parsing coverage profile: %v", err)
+					}
+					modulePath := cCtx.String("module")
+					if modulePath == "" {
+						if modulePath, err = readModulePath(baseDir); err != nil {
+							return fmt.Errorf("error reading module path: %v", err)
+						}
+					}
+					coverageByFile := repoRelativeCoverage(profileCoverage, modulePath)
+
+					fileNames := []string{}
+					for fileName := range blaimLinesByFile {
+						fileNames = append(fileNames, fileName)
+					}
+					sort.Strings(fileNames)
+
+					summaries := []*coverageSummary{}
+					for _, fileName := range fileNames {
+						blaimRangeSet := blaim.NewBlaimRangeSet(blaimLinesByFile[fileName])
+						cov := coverageByFile[fileName]
+						if cCtx.Bool("annotate") {
+							fileBytes, err := os.ReadFile(filepath.Join(baseDir, fileName))
+							if err != nil {
+								return err
+							}
+							annotateCoverage(fileBytes, blaimRangeSet, cov, os.Stdout)
+							continue
+						}
+						summaries = append(summaries, summarizeCoverage(fileName, blaimRangeSet, cov)...)
+					}
+					if cCtx.Bool("annotate") {
+						return nil
+					}
+					return writeCoverageSummaries(os.Stdout, summaries)
+				},
+			},
+			{
+				Name:      "verify",
+				Usage:     "check the signatures of the records in .blaim files (or stdin) against allowed signers, and report tampered, untrusted or unsigned records",
+				ArgsUsage: "[.blaim files...]",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "allowed-signers",
+						Usage: "only trust keys listed in this allowed signers file (as used by ssh-keygen -Y verify); defaults to git's gpg.ssh.allowedSignersFile setting",
+					},
+					&cli.BoolFlag{
+						Name:  "allow-unsigned",
+						Usage: "don't fail if some records are unsigned",
+					},
+				},
+				Action: func(cCtx *cli.Context) error {
+					signersPath := cCtx.String("allowed-signers")
+					if signersPath == "" {
+						// An unset config value isn't an error here, but every signed
+						// record will then be reported as self-signed.
+						out, _ := gitOutput(baseDir, "config", "--path", "gpg.ssh.allowedSignersFile")
+						signersPath = strings.TrimSpace(out)
+					}
+					var signers []allowedSigner
+					if signersPath != "" {
+						f, err := os.Open(signersPath)
+						if err != nil {
+							return err
+						}
+						signers, err = parseAllowedSigners(f)
+						f.Close()
+						if err != nil {
+							return fmt.Errorf("error reading allowed signers from %s: %v", signersPath, err)
+						}
+					}
+
+					readers := []io.Reader{}
+					for _, path := range cCtx.Args().Slice() {
+						f, err := os.Open(path)
+						if err != nil {
+							return err
+						}
+						defer f.Close()
+						readers = append(readers, f)
+					}
+					if len(readers) == 0 {
+						readers = append(readers, os.Stdin)
+					}
+					results := []verifyResult{}
+					for _, r := range readers {
+						blaimLinesByFile, err := blaim.ReadBlaimFile(r)
+						if err != nil {
+							return err
+						}
+						fileNames := []string{}
+						for fileName := range blaimLinesByFile {
+							fileNames = append(fileNames, fileName)
+						}
+						sort.Strings(fileNames)
+						for _, fileName := range fileNames {
+							for _, blaimLine := range blaimLinesByFile[fileName] {
+								results = append(results, verifyBlaimLine(blaimLine, signers))
+							}
+						}
+					}
+					return writeVerifyResults(os.Stdout, results, cCtx.Bool("allow-unsigned"))
+				},
+			},
+			{
+				Name:      "diff",
+				Usage:     "report the attributions added, removed and moved between two .blaim files, e.g. before and after regenerating one",
+				ArgsUsage: "<old .blaim file> <new .blaim file>",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "json",
+						Usage: "write JSON instead of a table; defaults to output.format in .blaimrc",
+					},
+					&cli.BoolFlag{
+						Name:  "exit-code",
+						Usage: "exit with an error if the files' attributions differ",
+					},
+				},
+				Action: func(cCtx *cli.Context) error {
+					if cCtx.NArg() != 2 {
+						return fmt.Errorf("expected two .blaim files, or - for stdin, got %d arguments", cCtx.NArg())
+					}
+					a, err := readBlaimFileAt(cCtx.Args().Get(0))
+					if err != nil {
+						return err
+					}
+					b, err := readBlaimFileAt(cCtx.Args().Get(1))
+					if err != nil {
+						return err
+					}
+					d := diffAttributions(a, b)
+					asJSON := cfg.Output.Format == "json"
+					if cCtx.IsSet("json") {
+						asJSON = cCtx.Bool("json")
+					}
+					if err := writeAttributionDiff(os.Stdout, d, asJSON); err != nil {
+						return err
+					}
+					if cCtx.Bool("exit-code") && len(d.Changes) > 0 {
+						return fmt.Errorf("%d attributions changed", len(d.Changes))
+					}
+					return nil
+				},
+			},
+			{
+				Name:  "eval",
+				Usage: "measure the precision and recall of matcher settings on a corpus of labeled diffs and accept logs",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "corpus",
+						Usage: "directory of scenarios, each with a diff.txt, an accepted.suggestions.log and an expected_blaim.json; defaults to the built-in corpus",
+					},
+					&cli.IntSliceFlag{
+						Name:  "min-lcs",
+						Value: cli.NewIntSlice(10, blaim.DefaultMinLCS, 40),
+						Usage: "evaluate a matcher with each of these minimum lengths of text shared by an accept log entry and a diff hunk, as well as exact matching",
+					},
+					&cli.StringSliceFlag{
+						Name:  "scenario",
+						Usage: "only evaluate these scenarios",
+					},
+					&cli.BoolFlag{
+						Name:  "json",
+						Usage: "write JSON instead of a table; defaults to output.format in .blaimrc",
+					},
+				},
+				Action: func(cCtx *cli.Context) error {
+					corpus, err := fs.Sub(evalCorpus, evalCorpusDir)
+					if err != nil {
+						return err
+					}
+					if dir := cCtx.String("corpus"); dir != "" {
+						corpus = os.DirFS(dir)
+					}
+					scenarios, err := readEvalCorpus(corpus)
+					if err != nil {
+						return fmt.Errorf("error reading corpus: %v", err)
+					}
+					if scenarios, err = selectEvalScenarios(scenarios, cCtx.StringSlice("scenario")); err != nil {
+						return err
+					}
+					results, err := runEval(scenarios, matcherVariants(cCtx.IntSlice("min-lcs")))
+					if err != nil {
+						return err
+					}
+					asJSON := cfg.Output.Format == "json"
+					if cCtx.IsSet("json") {
+						asJSON = cCtx.Bool("json")
+					}
+					return writeEvalResults(os.Stdout, results, asJSON)
+				},
+			},
+			{
+				Name:      "attest",
+				Usage:     "write an in-toto statement of the attributions in each commit that changed the .blaim file, one per line",
+				ArgsUsage: "[revision range]",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "blaim-file",
+						Usage: "path of the .blaim file, relative to the root of the git checkout; defaults to storage.blaimFile in .blaimrc, or .blaim",
+					},
+					&cli.StringFlag{
+						Name:  "signing-key",
+						Usage: "wrap each statement in a DSSE envelope signed with this ed25519 private key: PKCS #8, or an unencrypted OpenSSH key",
+					},
+				},
+				Action: func(cCtx *cli.Context) error {
+					if cCtx.NArg() > 1 {
+						return fmt.Errorf("expected at most one revision range, got %d arguments", cCtx.NArg())
+					}
+					commits, err := readCommitAttributions(baseDir, blaimFileName(cCtx))
+					if err != nil {
+						return fmt.Errorf("error reading attribution history: %v", err)
+					}
+					if rangeSpec := cCtx.Args().First(); rangeSpec != "" {
+						if commits, err = commitsInRange(baseDir, rangeSpec, commits); err != nil {
+							return err
+						}
+					}
+					var signer ssh.Signer
+					if keyPath := cCtx.String("signing-key"); keyPath != "" {
+						if signer, err = loadEnvelopeSigner(keyPath); err != nil {
+							return fmt.Errorf("error loading signing key: %v", err)
+						}
+					}
+					return writeAttestations(os.Stdout, baseDir, blaimFileName(cCtx), commits, signer)
+				},
+			},
+			{
+				Name:      "sbom",
+				Usage:     "list the files with AI-generated content at a release tag, with the percentage generated and the models used, as SPDX or CycloneDX",
+				ArgsUsage: "[tag]",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "format",
+						Value: "spdx",
+						Usage: "spdx, for an SPDX 2.3 document with an annotation on each file, or cyclonedx, for a CycloneDX 1.5 BOM",
+					},
+					&cli.StringFlag{
+						Name:  "blaim-file",
+						Usage: "path of the .blaim file, relative to the root of the git checkout; defaults to storage.blaimFile in .blaimrc, or .blaim",
+					},
+				},
+				Action: func(cCtx *cli.Context) error {
+					if cCtx.NArg() > 1 {
+						return fmt.Errorf("expected at most one tag, got %d arguments", cCtx.NArg())
+					}
+					write := map[string]func(io.Writer, *sbomSource, []*fileAttribution) error{
+						"spdx":      writeSPDX,
+						"cyclonedx": writeCycloneDX,
+					}[cCtx.String("format")]
+					if write == nil {
+						return fmt.Errorf("invalid --format %q: expected spdx or cyclonedx", cCtx.String("format"))
+					}
+					rev := "HEAD"
+					if cCtx.NArg() == 1 {
+						rev = cCtx.Args().First()
+					}
+					src, err := readSBOMSource(baseDir, rev)
+					if err != nil {
+						return err
+					}
+					files, err := attributeFilesAt(baseDir, src.commit, blaimFileName(cCtx))
+					if err != nil {
+						return err
+					}
+					return write(os.Stdout, src, files)
+				},
+			},
+			{
+				Name:  "check",
+				Usage: "check attribution data against a policy file, and exit non-zero if it is violated",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "policy",
+						Usage:    "path to the YAML policy file",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:  "range",
+						Usage: "check the commits in this revision range (e.g. origin/main..HEAD) instead of the working tree",
+					},
+					&cli.StringFlag{
+						Name:  "blaim-file",
+						Usage: "path of the .blaim file, relative to the root of the git checkout; defaults to storage.blaimFile in .blaimrc, or .blaim",
+					},
+				},
+				Action: func(cCtx *cli.Context) error {
+					f, err := os.Open(cCtx.String("policy"))
+					if err != nil {
+						return err
+					}
+					p, err := loadPolicy(f)
+					f.Close()
+					if err != nil {
+						return fmt.Errorf("error reading policy %s: %v", cCtx.String("policy"), err)
+					}
+					in, err := readCheckInput(baseDir, blaimFileName(cCtx), cCtx.String("range"))
+					if err != nil {
+						return fmt.Errorf("error reading attribution data: %v", err)
+					}
+					violations, generatedLines := checkPolicy(p, in)
+					for _, v := range violations {
+						fmt.Println(v)
+					}
+					fmt.Printf("%d generated lines of %d added\n", generatedLines, in.addedLines)
+					if len(violations) > 0 {
+						return fmt.Errorf("%d policy violations", len(violations))
+					}
+					return nil
+				},
+			},
+			{
+				Name:  "stats",
+				Usage: "report how often suggestions from each model were shown, accepted, partially accepted, rejected and edited",
+				Flags: append(acceptLogFlags("only consider suggestions logged at or after this time (e.g. 2024-06-10 15:04:05, or a duration like 24h)"), noIgnoreFlag),
+				Action: func(cCtx *cli.Context) error {
+					window, err := windowFromFlags(cCtx)
+					if err != nil {
+						return err
+					}
+					policy, err := parsePolicyFromFlags(cCtx)
+					if err != nil {
+						return err
+					}
+					ignore, err := ignoreFromFlags(cCtx)
+					if err != nil {
+						return err
+					}
+					logPaths, err := cfg.acceptLogPaths(acceptedSuggestionsLogPath)
+					if err != nil {
+						return err
+					}
+					logReader, closeLogs, err := openAcceptLogs(logPaths)
+					if err != nil {
+						return err
+					}
+					defer closeLogs()
+
+					entries, _, err := blaim.ReadAcceptLog(logReader, blaim.AcceptLogOptions{Window: window, Policy: policy, NormalizeFileName: acceptLogFileNames()})
+					if err != nil {
+						return err
+					}
+					if ignore != nil {
+						entries = withoutIgnored(entries, ignore)
+					}
+					return writeModelStats(os.Stdout, computeModelStats(entries))
+				},
+			},
+			{
+				Name:  "serve",
+				Usage: "serve a JSON API and web UI over the attributions in the .blaim history of the git checkout",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "addr",
+						Value: "localhost:8080",
+						Usage: "address to listen on",
+					},
+					&cli.StringFlag{
+						Name:  "blaim-file",
+						Usage: "path of the .blaim file, relative to the root of the git checkout; defaults to storage.blaimFile in .blaimrc, or .blaim",
+					},
+				},
+				Action: func(cCtx *cli.Context) error {
+					s := newAttributionServer(baseDir, blaimFileName(cCtx))
+					if _, err := s.currentIndex(); err != nil {
+						return fmt.Errorf("error indexing attributions: %v", err)
+					}
+					log.Printf("serving attributions for %s at http://%s/", baseDir, cCtx.String("addr"))
+					return http.ListenAndServe(cCtx.String("addr"), s.handler())
+				},
+			},
+			{
+				Name:  "proxy",
+				Usage: "proxy an Ollama or OpenAI-compatible model server, recording every completion it returns in the accept log",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "addr",
+						Value: "localhost:11435",
+						Usage: "address to listen on; point the editor plugin here instead of at the model server",
+					},
+					&cli.StringFlag{
+						Name:  "upstream",
+						Value: "http://localhost:11434",
+						Usage: "URL of the model server",
+					},
+					&cli.StringFlag{
+						Name:        "accept-log",
+						Usage:       "path of the accept log to append completions to; defaults to the first of acceptLogs in .blaimrc",
+						Destination: &acceptedSuggestionsLogPath,
+					},
+				},
+				Action: func(cCtx *cli.Context) error {
+					upstream, err := url.Parse(cCtx.String("upstream"))
+					if err != nil || upstream.Scheme == "" || upstream.Host == "" {
+						return fmt.Errorf("invalid --upstream %q", cCtx.String("upstream"))
+					}
+					logPaths, err := cfg.acceptLogPaths(acceptedSuggestionsLogPath)
+					if err != nil {
+						return err
+					}
+					logFile, err := os.OpenFile(logPaths[0], os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+					if err != nil {
+						return fmt.Errorf("error opening accept log at %s: %v", logPaths[0], err)
+					}
+					defer logFile.Close()
+					log.Printf("proxying %s at http://%s/, recording completions in %s", upstream, cCtx.String("addr"), logPaths[0])
+					return http.ListenAndServe(cCtx.String("addr"), newCompletionProxy(upstream, logFile))
+				},
+			},
+			{
+				Name:  "export",
+				Usage: "export the attribution history of the git checkout, and the contents of accept logs, to a SQLite database",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "sqlite",
+						Usage: "path of the SQLite database to write; defaults to storage.sqlite in .blaimrc",
+					},
+					&cli.BoolFlag{
+						Name:  "overwrite",
+						Usage: "replace the database if it already exists",
+					},
+					&cli.StringFlag{
+						Name:  "blaim-file",
+						Usage: "path of the .blaim file, relative to the root of the git checkout; defaults to storage.blaimFile in .blaimrc, or .blaim",
+					},
+					&cli.StringSliceFlag{
+						Name:  "accept-log",
+						Usage: "path to an accepted.suggestions.log file to export (may be repeated)",
+					},
+					&cli.BoolFlag{
+						Name:  "strict",
+						Usage: "fail if any non-empty line of an accept log is not a valid entry",
+					},
+					&cli.BoolFlag{
+						Name:  "lenient",
+						Usage: "skip accept log entries that can't be parsed, instead of failing",
+					},
+				},
+				Action: func(cCtx *cli.Context) error {
+					policy, err := parsePolicyFromFlags(cCtx)
+					if err != nil {
+						return err
+					}
+					commits, err := readCommitAttributions(baseDir, blaimFileName(cCtx))
+					if err != nil {
+						return fmt.Errorf("error reading attribution history: %v", err)
+					}
+					dbPath := cCtx.String("sqlite")
+					if dbPath == "" && cfg.Storage.SQLite != "" {
+						dbPath = cfg.resolve(cfg.Storage.SQLite)
+					}
+					if dbPath == "" {
+						return fmt.Errorf("no database: pass --sqlite, or set storage.sqlite in %s", configFileNames[0])
+					}
+					logPaths := cCtx.StringSlice("accept-log")
+					if len(logPaths) == 0 {
+						// Exporting just the attribution history is fine too.
+						logPaths, _ = cfg.acceptLogPaths()
+					}
+					acceptEntries := []*blaim.AcceptLogLine{}
+					normalize := acceptLogFileNames()
+					for _, logPath := range logPaths {
+						logFile, err := os.Open(logPath)
+						if err != nil {
+							return fmt.Errorf("error opening accept log at %s: %v", logPath, err)
+						}
+						entries, _, err := blaim.ReadAcceptLog(logFile, blaim.AcceptLogOptions{Policy: policy, NormalizeFileName: normalize})
+						logFile.Close()
+						if err != nil {
+							return fmt.Errorf("error reading accept log at %s: %v", logPath, err)
+						}
+						acceptEntries = append(acceptEntries, entries...)
+					}
+					return exportSQLite(dbPath, cCtx.Bool("overwrite"), commits, acceptEntries)
+				},
+			},
+			{
+				Name:  "compact",
+				Usage: "remove entries from accepted.suggestions.log that are already attributed in the .blaim history of the git checkout",
 				Flags: []cli.Flag{
 					&cli.StringFlag{
 						Name:        "accept-log",
@@ -310,22 +960,166 @@ func main() {
 						Usage:       "path to the accepted.suggestions.log file",
 						Destination: &acceptedSuggestionsLogPath,
 					},
+					&cli.StringFlag{
+						Name:  "blaim-file",
+						Usage: "path of the .blaim file, relative to the root of the git checkout; defaults to storage.blaimFile in .blaimrc, or .blaim",
+					},
+					&cli.StringFlag{
+						Name:  "before",
+						Usage: "also remove entries accepted before this time (e.g. 2024-06-10 15:04:05, or a duration like 720h)",
+					},
+					&cli.BoolFlag{
+						Name:  "dry-run",
+						Usage: "report what would be removed without modifying the accept log",
+					},
+					&cli.BoolFlag{
+						Name:  "force",
+						Usage: "compact the accept log even if it was modified in the last minute, and may still be being written to",
+					},
 				},
 				Action: func(cCtx *cli.Context) error {
-					logFile, err := os.Open(acceptedSuggestionsLogPath)
+					before, err := parseTimeFlag(cCtx.String("before"), time.Now())
 					if err != nil {
-						return fmt.Errorf("error opening accept log at %s: %v", acceptedSuggestionsLogPath, err)
+						return fmt.Errorf("invalid --before: %v", err)
 					}
-
-					return generate(os.Stdin, logFile, os.Stdout)
+					logPaths, err := cfg.acceptLogPaths(acceptedSuggestionsLogPath)
+					if err != nil {
+						return err
+					}
+					normalize := acceptLogFileNames()
+					for _, logPath := range logPaths {
+						stats, err := compactAcceptLogFile(baseDir, blaimFileName(cCtx), logPath, normalize, before, cCtx.Bool("dry-run"), cCtx.Bool("force"))
+						if err != nil {
+							return err
+						}
+						fmt.Fprintf(os.Stderr, "%s: kept %d entries, removed %d already attributed and %d expired entries\n", logPath, stats.kept, stats.attributed, stats.expired)
+					}
+					return nil
+				},
+			},
+			{
+				Name:  "config",
+				Usage: "print the effective configuration, from .blaimrc and defaults",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "toml",
+						Usage: "print TOML instead of YAML",
+					},
+				},
+				Action: func(cCtx *cli.Context) error {
+					return cfg.write(os.Stdout, cCtx.Bool("toml"))
 				},
 			},
 			{
 				Name:    "annotate",
 				Aliases: []string{"a"},
 				Usage:   "produce a line-by-line annotation of source files that contain machine-generated code changes",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "color",
+						Value: colorAuto,
+						Usage: "color generated lines by model and dim the rest: auto (if stdout is a terminal), always or never",
+					},
+					&cli.StringFlag{
+						Name:  "prefix-format",
+						Usage: "text/template for the annotation in front of generated lines, with the fields of the inference config (e.g. {{.ModelName}}, {{.Temperature}}), FileName, Start, End and Signed; defaults to [model, temp: temperature]",
+					},
+				},
+				Action: func(cCtx *cli.Context) error {
+					opts := annotateOptions{prefix: formatAnnotationLinePrefix}
+					if format := cCtx.String("prefix-format"); format != "" {
+						prefix, err := newPrefixFormatter(format)
+						if err != nil {
+							return err
+						}
+						opts.prefix = prefix
+					}
+					color, err := useColor(cCtx.String("color"), os.Stdout)
+					if err != nil {
+						return err
+					}
+					opts.color = color
+					return annotate(os.Stdin, os.Stdout, opts)
+				},
+			},
+			{
+				Name:      "tui",
+				Usage:     "browse the generated code in the git checkout in a full-screen terminal UI",
+				ArgsUsage: "[revision]",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "blaim-file",
+						Usage: "path of the .blaim file, relative to the root of the git checkout; defaults to storage.blaimFile in .blaimrc, or .blaim",
+					},
+					&cli.StringFlag{
+						Name:  "model",
+						Usage: "only show code generated by this model; press m to change the filter",
+					},
+				},
+				Action: func(cCtx *cli.Context) error {
+					if cCtx.NArg() > 1 {
+						return fmt.Errorf("expected at most one revision, got %d arguments", cCtx.NArg())
+					}
+					rev := "HEAD"
+					if cCtx.NArg() == 1 {
+						rev = cCtx.Args().First()
+					}
+					files, err := loadTUIFiles(baseDir, rev, blaimFileName(cCtx))
+					if err != nil {
+						return fmt.Errorf("error reading attribution history: %v", err)
+					}
+					m := newTUIModel(files)
+					if model := cCtx.String("model"); model != "" {
+						m.filter = model
+						m.scrollToSpan()
+					}
+					return runTUI(os.Stdin, os.Stdout, m)
+				},
+			},
+			{
+				Name:      "blame",
+				Usage:     "show git blame for a file, with the model that generated each line",
+				ArgsUsage: "[revision] file",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "porcelain",
+						Usage: "write git blame --porcelain output, with blaim-* headers for generated lines",
+					},
+					&cli.BoolFlag{
+						Name:  "line-porcelain",
+						Usage: "like --porcelain, but with commit headers for every line, as git blame --line-porcelain",
+					},
+					&cli.StringFlag{
+						Name:  "blaim-file",
+						Usage: "path of the .blaim file, relative to the root of the git checkout; defaults to storage.blaimFile in .blaimrc, or .blaim",
+					},
+				},
 				Action: func(cCtx *cli.Context) error {
-					return annotate(os.Stdin, os.Stdout)
+					if cCtx.NArg() < 1 || cCtx.NArg() > 2 {
+						return fmt.Errorf("expected [revision] file, got %d arguments", cCtx.NArg())
+					}
+					args := []string{"blame", "--porcelain"}
+					if cCtx.Bool("line-porcelain") {
+						args = []string{"blame", "--line-porcelain"}
+					}
+					rev := "HEAD"
+					if cCtx.NArg() == 2 {
+						rev = cCtx.Args().First()
+						args = append(args, rev)
+					}
+					args = append(args, "--", cCtx.Args().Get(cCtx.NArg()-1))
+					porcelain, err := gitOutput(baseDir, args...)
+					if err != nil {
+						return err
+					}
+					attributions, err := newCommitBlaimFiles(baseDir, rev, blaimFileName(cCtx))
+					if err != nil {
+						return fmt.Errorf("error reading attribution history: %v", err)
+					}
+					if cCtx.Bool("porcelain") || cCtx.Bool("line-porcelain") {
+						return blamePorcelain(strings.NewReader(porcelain), os.Stdout, attributions)
+					}
+					return blameLines(strings.NewReader(porcelain), os.Stdout, attributions)
 				},
 			},
 		},
@@ -6,6 +6,8 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/banksean/me3/blaim"
+
 	"github.com/google/go-cmp/cmp"
 	"github.com/sourcegraph/go-diff/diff"
 
@@ -35,7 +37,7 @@ var (
 // and make sure that generate produces the correct condensted blaim list.
 func TestGenerate(t *testing.T) {
 	out := &bytes.Buffer{}
-	generate(strings.NewReader(diffText), strings.NewReader(acceptedSuggestionsLogText), out)
+	blaim.Generate(strings.NewReader(diffText), strings.NewReader(acceptedSuggestionsLogText), out, blaim.GenerateOptions{})
 	got := out.String()
 	diff := cmp.Diff(expectedBlaimText, got)
 	if diff != "" {
@@ -45,16 +47,6 @@ func TestGenerate(t *testing.T) {
 	}
 }
 
-func TestProcessAcceptedSuggestionsLog(t *testing.T) {
-	acceptsForFile, err := processAcceptedSuggestionsLog(strings.NewReader(acceptedSuggestionsLogText))
-	if err != nil {
-		t.Errorf("error processing accept log: %v", err)
-	}
-	if len(acceptsForFile["playground.js"]) != 1 {
-		t.Errorf("expected 1 accept, got %d", len(acceptsForFile["playground.js"]))
-	}
-}
-
 func TestGetAdditions(t *testing.T) {
 	diffReader := diff.NewMultiFileDiffReader(strings.NewReader(diffText))
 	fdiff, err := diffReader.ReadFile()
@@ -65,7 +57,7 @@ func TestGetAdditions(t *testing.T) {
 		t.Errorf("expected 2 hunks, got %d", len(fdiff.Hunks))
 	}
 	for _, hunk := range fdiff.Hunks {
-		additions := getAdditions(string(hunk.Body))
+		additions := blaim.HunkAdditions(string(hunk.Body))
 		if len(additions) == 0 {
 			t.Errorf("expected some additions, got none")
 		}
@@ -73,7 +65,7 @@ func TestGetAdditions(t *testing.T) {
 }
 
 func TestReadBlaimFile(t *testing.T) {
-	blaimLinesByFile, err := readBlaimFile(strings.NewReader(expectedBlaimText))
+	blaimLinesByFile, err := blaim.ReadBlaimFile(strings.NewReader(expectedBlaimText))
 	if err != nil {
 		t.Errorf("error reading blaim file: %v", err)
 	}
@@ -86,13 +78,11 @@ func TestReadBlaimFile(t *testing.T) {
 }
 
 func TestAnnotateLines(t *testing.T) {
-	blaimLinesByFile, err := readBlaimFile(strings.NewReader(expectedBlaimText))
+	blaimLinesByFile, err := blaim.ReadBlaimFile(strings.NewReader(expectedBlaimText))
 	if err != nil {
 		t.Errorf("error reading blaim file: %v", err)
 	}
-	blaimRangeSet := BlaimRangeSet{
-		blaimLinesByFile["playground.js"],
-	}
+	blaimRangeSet := blaim.NewBlaimRangeSet(blaimLinesByFile["playground.js"])
 	lineNumber := 26
 	blaimLineMatches := blaimRangeSet.ForSourceLine(lineNumber)
 	if len(blaimLineMatches) != 1 {
@@ -106,7 +96,7 @@ func TestAnnotateLines(t *testing.T) {
 	}
 
 	out := &bytes.Buffer{}
-	annotateLines([]byte(playgroundJS), &blaimRangeSet, out)
+	annotateLines([]byte(playgroundJS), blaimRangeSet, out)
 	got := out.String()
 	diff := cmp.Diff(expectedAnnotateText, got)
 	if diff != "" {
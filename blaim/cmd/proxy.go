@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/banksean/me3/blaim"
+)
+
+// completionAPI identifies the request and response format of a completion endpoint.
+type completionAPI string
+
+const (
+	apiOllamaGenerate   completionAPI = "ollama-generate"
+	apiOllamaChat       completionAPI = "ollama-chat"
+	apiOpenAICompletion completionAPI = "openai-completion"
+	apiOpenAIChat       completionAPI = "openai-chat"
+)
+
+// completionAPIs maps the paths of the endpoints the proxy records completions
+// from to their formats. Requests to any other path are passed through as-is.
+var completionAPIs = map[string]completionAPI{
+	"/api/generate":        apiOllamaGenerate,
+	"/api/chat":            apiOllamaChat,
+	"/v1/completions":      apiOpenAICompletion,
+	"/v1/chat/completions": apiOpenAIChat,
+}
+
+// completionRequest holds the fields of Ollama and OpenAI-compatible
+// completion requests that the proxy records.
+type completionRequest struct {
+	Model  string `json:"model"`
+	System any    `json:"system"`
+	// Prompt is a string, or for OpenAI, possibly an array of them.
+	Prompt   any `json:"prompt"`
+	Suffix   any `json:"suffix"`
+	Messages any `json:"messages"`
+	// Temperature and MaxTokens are OpenAI's sampling parameters.
+	Temperature         *float32 `json:"temperature"`
+	MaxTokens           int      `json:"max_tokens"`
+	MaxCompletionTokens int      `json:"max_completion_tokens"`
+	// Options holds Ollama's sampling parameters.
+	Options struct {
+		Temperature *float32 `json:"temperature"`
+		NumPredict  int      `json:"num_predict"`
+	} `json:"options"`
+}
+
+// promptHash returns the hex SHA-256 hash of the parts of the request that
+// make up the prompt. The parts are re-encoded first, so that requests that
+// differ only in whitespace or key order hash the same.
+func (r *completionRequest) promptHash() string {
+	b, _ := json.Marshal(map[string]any{
+		"system":   r.System,
+		"prompt":   r.Prompt,
+		"suffix":   r.Suffix,
+		"messages": r.Messages,
+	})
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// inferenceConfig describes the request the way the editor extension would have.
+func (r *completionRequest) inferenceConfig(endpoint string) blaim.InferenceConfig {
+	ret := blaim.InferenceConfig{Endpoint: endpoint, ModelName: r.Model, MaxTokens: r.MaxTokens}
+	if r.MaxCompletionTokens != 0 {
+		ret.MaxTokens = r.MaxCompletionTokens
+	}
+	if r.Options.NumPredict != 0 {
+		ret.MaxTokens = r.Options.NumPredict
+	}
+	if r.Temperature != nil {
+		ret.Temperature = *r.Temperature
+	}
+	if r.Options.Temperature != nil {
+		ret.Temperature = *r.Options.Temperature
+	}
+	return ret
+}
+
+type chatMessage struct {
+	Content string `json:"content"`
+}
+
+// completionChunk holds the fields of a completion response, or of one chunk
+// of a streamed response, that carry the completion text.
+type completionChunk struct {
+	// Response is set by Ollama's generate endpoint.
+	Response string `json:"response"`
+	// Message is set by Ollama's chat endpoint.
+	Message *chatMessage `json:"message"`
+	// Choices is set by OpenAI endpoints. Streamed chat responses set Delta
+	// rather than Message.
+	Choices []struct {
+		Index   int          `json:"index"`
+		Text    string       `json:"text"`
+		Message *chatMessage `json:"message"`
+		Delta   *chatMessage `json:"delta"`
+	} `json:"choices"`
+}
+
+// parseCompletions returns the completions in a response body, in choice
+// order. body may be a single JSON object, newline-delimited JSON objects as
+// Ollama streams them, or server-sent events as OpenAI streams them.
+func parseCompletions(body []byte) ([]string, error) {
+	if bytes.HasPrefix(bytes.TrimSpace(body), []byte("data:")) {
+		body = sseData(body)
+	}
+	texts := map[int]*strings.Builder{}
+	text := func(index int) *strings.Builder {
+		if texts[index] == nil {
+			texts[index] = &strings.Builder{}
+		}
+		return texts[index]
+	}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	for {
+		chunk := completionChunk{}
+		if err := dec.Decode(&chunk); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		text(0).WriteString(chunk.Response)
+		if chunk.Message != nil {
+			text(0).WriteString(chunk.Message.Content)
+		}
+		for _, choice := range chunk.Choices {
+			text(choice.Index).WriteString(choice.Text)
+			if choice.Message != nil {
+				text(choice.Index).WriteString(choice.Message.Content)
+			}
+			if choice.Delta != nil {
+				text(choice.Index).WriteString(choice.Delta.Content)
+			}
+		}
+	}
+	indexes := []int{}
+	for index := range texts {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+	ret := []string{}
+	for _, index := range indexes {
+		if s := texts[index].String(); s != "" {
+			ret = append(ret, s)
+		}
+	}
+	return ret, nil
+}
+
+// sseData returns the data of each server-sent event in body, one per line,
+// without the "[DONE]" event that ends OpenAI streams.
+func sseData(body []byte) []byte {
+	ret := &bytes.Buffer{}
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(nil, len(body)+1)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+		data = strings.TrimSpace(data)
+		if data == "[DONE]" {
+			continue
+		}
+		ret.WriteString(data + "\n")
+	}
+	return ret.Bytes()
+}
+
+// acceptLogWriter appends entries to an accept log in the format the VS Code
+// extension writes.
+type acceptLogWriter struct {
+	mu  sync.Mutex
+	out io.Writer
+	now func() time.Time
+}
+
+func (w *acceptLogWriter) write(entry *blaim.AcceptLogLine) error {
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_, err = fmt.Fprintf(w.out, "%s [info] %s\n", w.now().Format(blaim.AcceptLogTimestampLayout), b)
+	return err
+}
+
+// captureWriter passes a response through to the client, keeping a copy of
+// its body.
+type captureWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *captureWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *captureWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush lets the reverse proxy stream responses through as they arrive.
+func (w *captureWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// completionProxy forwards requests to a model server, and records every
+// completion it returns in an accept log.
+type completionProxy struct {
+	upstream *url.URL
+	proxy    *httputil.ReverseProxy
+	log      *acceptLogWriter
+}
+
+func newCompletionProxy(upstream *url.URL, acceptLog io.Writer) *completionProxy {
+	proxy := httputil.NewSingleHostReverseProxy(upstream)
+	director := proxy.Director
+	proxy.Director = func(r *http.Request) {
+		director(r)
+		// The recorded copy of the response has to be readable.
+		r.Header.Del("Accept-Encoding")
+	}
+	// Stream chunks to the editor as soon as the model produces them.
+	proxy.FlushInterval = -1
+	return &completionProxy{
+		upstream: upstream,
+		proxy:    proxy,
+		log:      &acceptLogWriter{out: acceptLog, now: time.Now},
+	}
+}
+
+func (p *completionProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	api, ok := completionAPIs[r.URL.Path]
+	if !ok || r.Method != http.MethodPost {
+		p.proxy.ServeHTTP(w, r)
+		return
+	}
+	reqBody, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	r.Body = io.NopCloser(bytes.NewReader(reqBody))
+
+	capture := &captureWriter{ResponseWriter: w, status: http.StatusOK}
+	p.proxy.ServeHTTP(capture, r)
+	if capture.status != http.StatusOK {
+		return
+	}
+	if err := p.record(reqBody, capture.body.Bytes()); err != nil {
+		log.Printf("not recording %s completion: %v", api, err)
+	}
+}
+
+// record writes an accept log entry for each completion in a response. The
+// endpoint is the upstream server's URL, as the editor extension logs it, so
+// that the same model on the same server has one InferenceConfig whichever
+// API it was called through.
+func (p *completionProxy) record(reqBody, respBody []byte) error {
+	req := &completionRequest{}
+	if err := json.Unmarshal(reqBody, req); err != nil {
+		return fmt.Errorf("error parsing request: %v", err)
+	}
+	completions, err := parseCompletions(respBody)
+	if err != nil {
+		return fmt.Errorf("error parsing response: %v", err)
+	}
+	endpoint := p.upstream.String()
+	for _, text := range completions {
+		entry := &blaim.AcceptLogLine{
+			Event:           blaim.EventCompleted,
+			Text:            text,
+			InferenceConfig: req.inferenceConfig(endpoint),
+			PromptHash:      req.promptHash(),
+		}
+		if err := p.log.write(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
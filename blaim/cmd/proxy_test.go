@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/banksean/me3/blaim"
+)
+
+func TestParseCompletions(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		body     string
+		expected []string
+	}{
+		{"ollama generate", `{"model":"codegemma","response":"return 1","done":true}`, []string{"return 1"}},
+		{"ollama generate stream", "{\"response\":\"return\"}\n{\"response\":\" 1\"}\n{\"response\":\"\",\"done\":true}\n", []string{"return 1"}},
+		{"ollama chat stream", "{\"message\":{\"role\":\"assistant\",\"content\":\"a\"}}\n{\"message\":{\"content\":\"b\"},\"done\":true}\n", []string{"ab"}},
+		{"openai completion", `{
+  "choices": [
+    {"index": 1, "text": "second"},
+    {"index": 0, "text": "first"}
+  ]
+}`, []string{"first", "second"}},
+		{"openai chat", `{"choices":[{"index":0,"message":{"role":"assistant","content":"x := 1"}}]}`, []string{"x := 1"}},
+		{"openai chat stream", "data: {\"choices\":[{\"index\":0,\"delta\":{\"role\":\"assistant\"}}]}\n\ndata: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"x :=\"}}]}\n\ndata: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\" 1\"}}]}\n\ndata: [DONE]\n\n", []string{"x := 1"}},
+		{"empty", `{"response":"","done":true}`, []string{}},
+	} {
+		got, err := parseCompletions([]byte(test.body))
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("%s: expected %q, got %q", test.name, test.expected, got)
+		}
+	}
+	if _, err := parseCompletions([]byte("not json")); err == nil {
+		t.Errorf("expected an error for a body that isn't JSON")
+	}
+}
+
+func TestPromptHash(t *testing.T) {
+	a, b := &completionRequest{}, &completionRequest{}
+	if err := json.Unmarshal([]byte(`{"model":"a","prompt":"<PRE> x <SUF>","options":{"temperature":0.2}}`), a); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(`{"prompt": "<PRE> x <SUF>", "model": "b"}`), b); err != nil {
+		t.Fatal(err)
+	}
+	if a.promptHash() != b.promptHash() || len(a.promptHash()) != 64 {
+		t.Errorf("expected equal prompts to hash the same, got %s and %s", a.promptHash(), b.promptHash())
+	}
+	b.Suffix = "}"
+	if a.promptHash() == b.promptHash() {
+		t.Errorf("expected a different suffix to change the hash")
+	}
+}
+
+func TestCompletionProxy(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/generate":
+			io.WriteString(w, "{\"response\":\"func b() {\"}\n{\"response\":\" return }\",\"done\":true}\n")
+		case "/api/tags":
+			io.WriteString(w, `{"models":[]}`)
+		default:
+			http.Error(w, "model not found", http.StatusNotFound)
+		}
+	}))
+	defer upstream.Close()
+	upstreamURL, _ := url.Parse(upstream.URL)
+
+	acceptLog := &bytes.Buffer{}
+	p := newCompletionProxy(upstreamURL, acceptLog)
+	p.log.now = func() time.Time { return time.Date(2024, 6, 10, 15, 40, 0, 0, time.Local) }
+	proxy := httptest.NewServer(p)
+	defer proxy.Close()
+
+	post := func(path, body string) string {
+		t.Helper()
+		resp, err := http.Post(proxy.URL+path, "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		return string(b)
+	}
+	got := post("/api/generate", `{"model":"codegemma:2b","prompt":"func a() {}\n","options":{"temperature":0.2,"num_predict":64}}`)
+	if !strings.Contains(got, `" return }"`) {
+		t.Errorf("expected the response to be passed through, got %q", got)
+	}
+	// Failed requests and other endpoints aren't recorded.
+	post("/api/chat", `{"model":"missing"}`)
+	if resp, err := http.Get(proxy.URL + "/api/tags"); err == nil {
+		resp.Body.Close()
+	}
+
+	// Close waits for the handlers, and so the recording, to finish.
+	proxy.Close()
+	entries, _, err := blaim.ReadAcceptLog(acceptLog, blaim.AcceptLogOptions{Policy: blaim.ParseStrict})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 entry, got %d:\n%s", len(entries), acceptLog.String())
+	}
+	entry := entries[0]
+	expectedConfig := blaim.InferenceConfig{Endpoint: upstream.URL, ModelName: "codegemma:2b", MaxTokens: 64, Temperature: 0.2}
+	if entry.EventType() != blaim.EventCompleted || entry.AttributedText() != "func b() { return }" || entry.InferenceConfig != expectedConfig || entry.PromptHash == "" {
+		t.Errorf("unexpected entry %+v", entry)
+	}
+	if !entry.Timestamp.Equal(time.Date(2024, 6, 10, 15, 40, 0, 0, time.Local)) {
+		t.Errorf("unexpected timestamp %v", entry.Timestamp)
+	}
+}
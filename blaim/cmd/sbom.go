@@ -0,0 +1,330 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// fileAttribution describes how much of a file's contents at a revision was
+// generated, according to git blame and the .blaim files of the commits that
+// last changed each line.
+type fileAttribution struct {
+	fileName string
+	// sha1 is the hex SHA-1 hash of the file's contents.
+	sha1      string
+	lines     int
+	generated int
+	// modelLines counts the generated lines by model name.
+	modelLines map[string]int
+}
+
+func (f *fileAttribution) percent() float64 {
+	if f.lines == 0 {
+		return 0
+	}
+	return 100 * float64(f.generated) / float64(f.lines)
+}
+
+// models returns the names of the models that generated lines of the file, sorted.
+func (f *fileAttribution) models() []string {
+	ret := []string{}
+	for model := range f.modelLines {
+		ret = append(ret, model)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// sbomSource identifies the revision an SBOM describes.
+type sbomSource struct {
+	// name is the name of the repository, i.e. the base name of its checkout.
+	name string
+	// rev is the revision as given, e.g. a tag, and commit is what it resolves to.
+	rev    string
+	commit string
+	// time is the commit time, which is used as the creation time of the SBOM
+	// so that it is reproducible.
+	time time.Time
+}
+
+// readSBOMSource resolves rev in the repository at dir.
+func readSBOMSource(dir, rev string) (*sbomSource, error) {
+	out, err := gitOutput(dir, "rev-parse", "--verify", rev+"^{commit}")
+	if err != nil {
+		return nil, err
+	}
+	t, err := gitCommitTime(dir, rev)
+	if err != nil {
+		return nil, err
+	}
+	return &sbomSource{
+		name:   filepath.Base(repoRoot(dir)),
+		rev:    rev,
+		commit: strings.TrimSpace(out),
+		time:   t.UTC(),
+	}, nil
+}
+
+// attributeFilesAt returns the attribution of each file at rev that has
+// generated lines, sorted by file name.
+func attributeFilesAt(dir, rev, blaimFileName string) ([]*fileAttribution, error) {
+	ret := []*fileAttribution{}
+	err := blameAttributedFiles(dir, rev, blaimFileName, func(fileName string, lines []attributedLine) error {
+		f := &fileAttribution{fileName: fileName, lines: len(lines), modelLines: map[string]int{}}
+		for _, l := range lines {
+			if l.attribution != nil {
+				f.generated++
+				f.modelLines[l.attribution.InferenceConfig.ModelName]++
+			}
+		}
+		if f.generated == 0 {
+			return nil
+		}
+		contents, err := gitOutput(dir, "show", rev+":"+fileName)
+		if err != nil {
+			return err
+		}
+		sum := sha1.Sum([]byte(contents))
+		f.sha1 = hex.EncodeToString(sum[:])
+		ret = append(ret, f)
+		return nil
+	})
+	return ret, err
+}
+
+// generatedSummary describes a file's generated content in a sentence, for
+// SBOM formats that only have free-text fields for it.
+func generatedSummary(f *fileAttribution) string {
+	models := []string{}
+	for _, model := range f.models() {
+		models = append(models, fmt.Sprintf("%s (%d lines)", model, f.modelLines[model]))
+	}
+	return fmt.Sprintf("AI-generated content: %d of %d lines (%.1f%%), generated by %s", f.generated, f.lines, f.percent(), strings.Join(models, ", "))
+}
+
+// The SPDX 2.3 JSON format is described in https://spdx.github.io/spdx-spec/v2.3/
+type spdxDocument struct {
+	SPDXVersion       string             `json:"spdxVersion"`
+	DataLicense       string             `json:"dataLicense"`
+	SPDXID            string             `json:"SPDXID"`
+	Name              string             `json:"name"`
+	DocumentNamespace string             `json:"documentNamespace"`
+	CreationInfo      spdxCreationInfo   `json:"creationInfo"`
+	Packages          []spdxPackage      `json:"packages"`
+	Files             []spdxFile         `json:"files"`
+	Relationships     []spdxRelationship `json:"relationships"`
+}
+
+type spdxCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+	Comment  string   `json:"comment,omitempty"`
+}
+
+type spdxPackage struct {
+	Name                    string                   `json:"name"`
+	SPDXID                  string                   `json:"SPDXID"`
+	VersionInfo             string                   `json:"versionInfo"`
+	DownloadLocation        string                   `json:"downloadLocation"`
+	FilesAnalyzed           bool                     `json:"filesAnalyzed"`
+	PackageVerificationCode *spdxPackageVerification `json:"packageVerificationCode,omitempty"`
+	LicenseConcluded        string                   `json:"licenseConcluded"`
+	LicenseDeclared         string                   `json:"licenseDeclared"`
+	CopyrightText           string                   `json:"copyrightText"`
+	Comment                 string                   `json:"comment,omitempty"`
+}
+
+type spdxPackageVerification struct {
+	PackageVerificationCodeValue string `json:"packageVerificationCodeValue"`
+}
+
+type spdxRelationship struct {
+	SPDXElementID      string `json:"spdxElementId"`
+	RelationshipType   string `json:"relationshipType"`
+	RelatedSPDXElement string `json:"relatedSpdxElement"`
+}
+
+type spdxFile struct {
+	FileName    string           `json:"fileName"`
+	SPDXID      string           `json:"SPDXID"`
+	Checksums   []spdxChecksum   `json:"checksums"`
+	Annotations []spdxAnnotation `json:"annotations"`
+}
+
+type spdxChecksum struct {
+	Algorithm     string `json:"algorithm"`
+	ChecksumValue string `json:"checksumValue"`
+}
+
+type spdxAnnotation struct {
+	AnnotationDate string `json:"annotationDate"`
+	AnnotationType string `json:"annotationType"`
+	Annotator      string `json:"annotator"`
+	Comment        string `json:"comment"`
+}
+
+const sbomTool = "blaim"
+
+// spdxIDInvalid matches the characters that aren't allowed in an SPDX identifier.
+var spdxIDInvalid = regexp.MustCompile(`[^a-zA-Z0-9.-]`)
+
+// spdxVerificationCode returns the SPDX package verification code of files:
+// the SHA-1 of their sorted SHA-1s.
+func spdxVerificationCode(files []*fileAttribution) string {
+	sums := []string{}
+	for _, f := range files {
+		sums = append(sums, f.sha1)
+	}
+	sort.Strings(sums)
+	sum := sha1.Sum([]byte(strings.Join(sums, "")))
+	return hex.EncodeToString(sum[:])
+}
+
+// writeSPDX writes an SPDX document describing a package for the repository at
+// the revision, which contains the files with generated content, each with an
+// annotation describing how much of it was generated, and by which models.
+//
+// The package only lists the files with generated content, so its
+// verification code covers just those.
+func writeSPDX(out io.Writer, src *sbomSource, files []*fileAttribution) error {
+	created := src.time.Format(time.RFC3339)
+	pkg := spdxPackage{
+		Name:             src.name,
+		SPDXID:           "SPDXRef-Package-" + spdxIDInvalid.ReplaceAllString(src.name, "-"),
+		VersionInfo:      src.rev,
+		DownloadLocation: "NOASSERTION",
+		LicenseConcluded: "NOASSERTION",
+		LicenseDeclared:  "NOASSERTION",
+		CopyrightText:    "NOASSERTION",
+		Comment:          fmt.Sprintf("%s at commit %s; only files with AI-generated content are listed", src.rev, src.commit),
+	}
+	// A package with no files can't be analyzed.
+	if len(files) > 0 {
+		pkg.FilesAnalyzed = true
+		pkg.PackageVerificationCode = &spdxPackageVerification{PackageVerificationCodeValue: spdxVerificationCode(files)}
+	}
+	doc := spdxDocument{
+		SPDXVersion:       "SPDX-2.3",
+		DataLicense:       "CC0-1.0",
+		SPDXID:            "SPDXRef-DOCUMENT",
+		Name:              src.name + "-" + src.rev,
+		DocumentNamespace: fmt.Sprintf("https://github.com/banksean/me3/blaim/spdx/%s-%s", src.name, src.commit),
+		CreationInfo: spdxCreationInfo{
+			Created:  created,
+			Creators: []string{"Tool: " + sbomTool},
+			Comment:  fmt.Sprintf("Files with AI-generated content at %s (%s)", src.rev, src.commit),
+		},
+		Packages: []spdxPackage{pkg},
+		Files:    []spdxFile{},
+		Relationships: []spdxRelationship{{
+			SPDXElementID:      "SPDXRef-DOCUMENT",
+			RelationshipType:   "DESCRIBES",
+			RelatedSPDXElement: pkg.SPDXID,
+		}},
+	}
+	for i, f := range files {
+		id := fmt.Sprintf("SPDXRef-File-%d-%s", i+1, spdxIDInvalid.ReplaceAllString(f.fileName, "-"))
+		doc.Relationships = append(doc.Relationships, spdxRelationship{
+			SPDXElementID:      pkg.SPDXID,
+			RelationshipType:   "CONTAINS",
+			RelatedSPDXElement: id,
+		})
+		doc.Files = append(doc.Files, spdxFile{
+			FileName:  "./" + f.fileName,
+			SPDXID:    id,
+			Checksums: []spdxChecksum{{Algorithm: "SHA1", ChecksumValue: f.sha1}},
+			Annotations: []spdxAnnotation{{
+				AnnotationDate: created,
+				AnnotationType: "OTHER",
+				Annotator:      "Tool: " + sbomTool,
+				Comment:        generatedSummary(f),
+			}},
+		})
+	}
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
+
+// The CycloneDX 1.5 JSON format is described in https://cyclonedx.org/docs/1.5/json/
+type cycloneDXBOM struct {
+	BOMFormat   string               `json:"bomFormat"`
+	SpecVersion string               `json:"specVersion"`
+	Version     int                  `json:"version"`
+	Metadata    cycloneDXMetadata    `json:"metadata"`
+	Components  []cycloneDXComponent `json:"components"`
+}
+
+type cycloneDXMetadata struct {
+	Timestamp string `json:"timestamp"`
+	Tools     struct {
+		Components []cycloneDXComponent `json:"components"`
+	} `json:"tools"`
+	Component cycloneDXComponent `json:"component"`
+}
+
+type cycloneDXComponent struct {
+	Type       string              `json:"type"`
+	Name       string              `json:"name"`
+	Version    string              `json:"version,omitempty"`
+	Hashes     []cycloneDXHash     `json:"hashes,omitempty"`
+	Properties []cycloneDXProperty `json:"properties,omitempty"`
+}
+
+type cycloneDXHash struct {
+	Alg     string `json:"alg"`
+	Content string `json:"content"`
+}
+
+type cycloneDXProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// writeCycloneDX writes a CycloneDX BOM with a file component for each file
+// with generated content. How much of it was generated, and by which models,
+// are "blaim:" properties of the component.
+func writeCycloneDX(out io.Writer, src *sbomSource, files []*fileAttribution) error {
+	bom := cycloneDXBOM{
+		BOMFormat:   "CycloneDX",
+		SpecVersion: "1.5",
+		Version:     1,
+		Components:  []cycloneDXComponent{},
+	}
+	bom.Metadata.Timestamp = src.time.Format(time.RFC3339)
+	bom.Metadata.Tools.Components = []cycloneDXComponent{{Type: "application", Name: sbomTool}}
+	bom.Metadata.Component = cycloneDXComponent{
+		Type:       "application",
+		Name:       src.name,
+		Version:    src.rev,
+		Properties: []cycloneDXProperty{{Name: "blaim:commit", Value: src.commit}},
+	}
+	for _, f := range files {
+		c := cycloneDXComponent{
+			Type:   "file",
+			Name:   f.fileName,
+			Hashes: []cycloneDXHash{{Alg: "SHA-1", Content: f.sha1}},
+			Properties: []cycloneDXProperty{
+				{Name: "blaim:lines", Value: strconv.Itoa(f.lines)},
+				{Name: "blaim:generatedLines", Value: strconv.Itoa(f.generated)},
+				{Name: "blaim:generatedPercent", Value: fmt.Sprintf("%.1f", f.percent())},
+			},
+		}
+		for _, model := range f.models() {
+			c.Properties = append(c.Properties, cycloneDXProperty{Name: "blaim:model", Value: model})
+		}
+		bom.Components = append(bom.Components, c)
+	}
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(bom)
+}
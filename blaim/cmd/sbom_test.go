@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAttributeFilesAt(t *testing.T) {
+	dir, _ := newTestRepo(t, blameTestCommits...)
+	if _, err := gitOutput(dir, "tag", "v1.0"); err != nil {
+		t.Fatal(err)
+	}
+	files, err := attributeFilesAt(dir, "v1.0", ".blaim")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("expected 1 file, got %d", len(files))
+	}
+	f := files[0]
+	if f.fileName != "main.go" || f.lines != 5 || f.generated != 2 || f.modelLines["codegemma"] != 2 || len(f.sha1) != 40 {
+		t.Errorf("unexpected attribution %+v", f)
+	}
+	if f.percent() != 40 {
+		t.Errorf("expected 40%%, got %f", f.percent())
+	}
+
+	src, err := readSBOMSource(dir, "v1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if src.rev != "v1.0" || len(src.commit) != 40 {
+		t.Errorf("unexpected source %+v", src)
+	}
+}
+
+func testSBOMFiles() (*sbomSource, []*fileAttribution) {
+	src := &sbomSource{name: "me3", rev: "v1.0", commit: "0123abcd", time: time.Date(2024, 6, 10, 15, 40, 0, 0, time.UTC)}
+	files := []*fileAttribution{{
+		fileName:   "blaim/cmd/main.go",
+		sha1:       "da39a3ee5e6b4b0d3255bfef95601890afd80709",
+		lines:      200,
+		generated:  30,
+		modelLines: map[string]int{"codellama": 10, "codegemma": 20},
+	}}
+	return src, files
+}
+
+func TestWriteSPDX(t *testing.T) {
+	out := &bytes.Buffer{}
+	src, files := testSBOMFiles()
+	if err := writeSPDX(out, src, files); err != nil {
+		t.Fatal(err)
+	}
+	doc := spdxDocument{}
+	if err := json.Unmarshal(out.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.SPDXVersion != "SPDX-2.3" || doc.CreationInfo.Created != "2024-06-10T15:40:00Z" || len(doc.Files) != 1 {
+		t.Fatalf("unexpected document:\n%s", out.String())
+	}
+	file := doc.Files[0]
+	if file.FileName != "./blaim/cmd/main.go" || file.SPDXID != "SPDXRef-File-1-blaim-cmd-main.go" {
+		t.Errorf("unexpected file %+v", file)
+	}
+	expected := "AI-generated content: 30 of 200 lines (15.0%), generated by codegemma (20 lines), codellama (10 lines)"
+	if len(file.Annotations) != 1 || file.Annotations[0].Comment != expected {
+		t.Errorf("expected the annotation %q, got %+v", expected, file.Annotations)
+	}
+	if len(doc.Packages) != 1 {
+		t.Fatalf("expected 1 package, got %+v", doc.Packages)
+	}
+	pkg := doc.Packages[0]
+	if pkg.Name != "me3" || pkg.SPDXID != "SPDXRef-Package-me3" || pkg.VersionInfo != "v1.0" || !pkg.FilesAnalyzed {
+		t.Errorf("unexpected package %+v", pkg)
+	}
+	// The SHA-1 of the file's SHA-1.
+	if pkg.PackageVerificationCode == nil || pkg.PackageVerificationCode.PackageVerificationCodeValue != "10a34637ad661d98ba3344717656fcc76209c2f8" {
+		t.Errorf("unexpected verification code %+v", pkg.PackageVerificationCode)
+	}
+	expectedRelationships := []spdxRelationship{
+		{"SPDXRef-DOCUMENT", "DESCRIBES", "SPDXRef-Package-me3"},
+		{"SPDXRef-Package-me3", "CONTAINS", "SPDXRef-File-1-blaim-cmd-main.go"},
+	}
+	if !reflect.DeepEqual(doc.Relationships, expectedRelationships) {
+		t.Errorf("expected relationships %+v, got %+v", expectedRelationships, doc.Relationships)
+	}
+}
+
+func TestWriteCycloneDX(t *testing.T) {
+	out := &bytes.Buffer{}
+	src, files := testSBOMFiles()
+	if err := writeCycloneDX(out, src, files); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		`"bomFormat": "CycloneDX"`,
+		`"type": "file",`,
+		`"name": "blaim/cmd/main.go",`,
+		`"alg": "SHA-1",`,
+		`"name": "blaim:generatedPercent",
+          "value": "15.0"`,
+		`"name": "blaim:model",
+          "value": "codegemma"`,
+	} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("expected %s in:\n%s", expected, out.String())
+		}
+	}
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/banksean/me3/blaim"
+
+	_ "embed"
+)
+
+//go:embed static/index.html
+var indexHTML []byte
+
+// attributionRecord is a BlaimLine along with the commit that it attributes.
+type attributionRecord struct {
+	Commit string    `json:"commit"`
+	Author string    `json:"author"`
+	Time   time.Time `json:"time"`
+	*blaim.BlaimLine
+}
+
+// lineCount returns the number of source lines spanned by a BlaimLine.
+func lineCount(b *blaim.BlaimLine) int {
+	return b.Range.End.Line - b.Range.Start.Line + 1
+}
+
+// commitSummary describes the attributions recorded for a single commit.
+type commitSummary struct {
+	Commit  string    `json:"commit"`
+	Author  string    `json:"author"`
+	Time    time.Time `json:"time"`
+	Records int       `json:"records"`
+	Lines   int       `json:"lines"`
+}
+
+// aggregate totals the attributions that share a key, such as a model name.
+type aggregate struct {
+	Key     string `json:"key"`
+	Commits int    `json:"commits"`
+	Records int    `json:"records"`
+	Lines   int    `json:"lines"`
+}
+
+// attributionIndex holds every attribution in a repository's history, indexed
+// for lookup by file and commit.
+type attributionIndex struct {
+	commits []commitSummary
+	// records are ordered newest commit first.
+	records  []*attributionRecord
+	byFile   map[string][]*attributionRecord
+	byCommit map[string][]*attributionRecord
+}
+
+func newAttributionIndex(commits []*commitAttribution) *attributionIndex {
+	idx := &attributionIndex{
+		commits:  []commitSummary{},
+		records:  []*attributionRecord{},
+		byFile:   map[string][]*attributionRecord{},
+		byCommit: map[string][]*attributionRecord{},
+	}
+	for _, c := range commits {
+		summary := commitSummary{Commit: c.commit, Author: c.author, Time: c.time}
+		for _, line := range c.lines {
+			record := &attributionRecord{Commit: c.commit, Author: c.author, Time: c.time, BlaimLine: line}
+			idx.records = append(idx.records, record)
+			idx.byFile[line.FileName] = append(idx.byFile[line.FileName], record)
+			idx.byCommit[c.commit] = append(idx.byCommit[c.commit], record)
+			summary.Records++
+			summary.Lines += lineCount(line)
+		}
+		idx.commits = append(idx.commits, summary)
+	}
+	return idx
+}
+
+// attributionQuery selects records from an attributionIndex. Zero values match everything.
+type attributionQuery struct {
+	file string
+	// line matches records that span this line, as numbered in the file at the record's commit.
+	line int
+	// commit matches records whose commit hash starts with this prefix.
+	commit string
+	model  string
+	window blaim.TimeWindow
+}
+
+func (idx *attributionIndex) find(q attributionQuery) []*attributionRecord {
+	candidates := idx.records
+	if q.file != "" {
+		candidates = idx.byFile[q.file]
+	} else if records, ok := idx.byCommit[q.commit]; ok {
+		candidates = records
+	}
+	ret := []*attributionRecord{}
+	for _, r := range candidates {
+		if q.line > 0 && (q.line < r.Range.Start.Line || q.line > r.Range.End.Line) {
+			continue
+		}
+		if q.commit != "" && !strings.HasPrefix(r.Commit, q.commit) {
+			continue
+		}
+		if q.model != "" && r.InferenceConfig.ModelName != q.model {
+			continue
+		}
+		if !q.window.Contains(r.Time) {
+			continue
+		}
+		ret = append(ret, r)
+	}
+	return ret
+}
+
+// aggregateKeys are the ways records can be grouped by aggregateRecords.
+var aggregateKeys = map[string]func(*attributionRecord) string{
+	"model":  func(r *attributionRecord) string { return r.InferenceConfig.ModelName },
+	"file":   func(r *attributionRecord) string { return r.FileName },
+	"author": func(r *attributionRecord) string { return r.Author },
+	"day":    func(r *attributionRecord) string { return r.Time.Format("2006-01-02") },
+}
+
+// aggregateRecords totals records by the key that keyFn returns for each, sorted by key.
+func aggregateRecords(records []*attributionRecord, keyFn func(*attributionRecord) string) []*aggregate {
+	byKey := map[string]*aggregate{}
+	commits := map[string]map[string]bool{}
+	for _, r := range records {
+		key := keyFn(r)
+		agg, ok := byKey[key]
+		if !ok {
+			agg = &aggregate{Key: key}
+			byKey[key] = agg
+			commits[key] = map[string]bool{}
+		}
+		agg.Records++
+		agg.Lines += lineCount(r.BlaimLine)
+		commits[key][r.Commit] = true
+	}
+	ret := []*aggregate{}
+	for key, agg := range byKey {
+		agg.Commits = len(commits[key])
+		ret = append(ret, agg)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Key < ret[j].Key
+	})
+	return ret
+}
+
+// attributionServer serves a JSON API and a web UI over the attribution history
+// of a git repository. The index is rebuilt whenever the repository's HEAD changes.
+type attributionServer struct {
+	loadHead  func() (string, error)
+	loadIndex func() (*attributionIndex, error)
+
+	mu    sync.Mutex
+	head  string
+	index *attributionIndex
+}
+
+func newAttributionServer(dir, blaimFileName string) *attributionServer {
+	return &attributionServer{
+		loadHead: func() (string, error) {
+			out, err := gitOutput(dir, "rev-parse", "HEAD")
+			return strings.TrimSpace(out), err
+		},
+		loadIndex: func() (*attributionIndex, error) {
+			commits, err := readCommitAttributions(dir, blaimFileName)
+			if err != nil {
+				return nil, err
+			}
+			return newAttributionIndex(commits), nil
+		},
+	}
+}
+
+// currentIndex returns the index for the repository's current HEAD, rebuilding it if necessary.
+func (s *attributionServer) currentIndex() (*attributionIndex, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	head, err := s.loadHead()
+	if err != nil {
+		return nil, err
+	}
+	if s.index != nil && head == s.head {
+		return s.index, nil
+	}
+	index, err := s.loadIndex()
+	if err != nil {
+		return nil, err
+	}
+	s.head, s.index = head, index
+	return index, nil
+}
+
+func (s *attributionServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.handleUI)
+	mux.HandleFunc("/api/commits", s.handleCommits)
+	mux.HandleFunc("/api/attributions", s.handleAttributions)
+	mux.HandleFunc("/api/aggregates", s.handleAggregates)
+	return mux
+}
+
+func (s *attributionServer) handleUI(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(indexHTML)
+}
+
+// handleCommits serves a commitSummary for every commit with recorded attributions.
+func (s *attributionServer) handleCommits(w http.ResponseWriter, r *http.Request) {
+	idx, err := s.currentIndex()
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, idx.commits)
+}
+
+// handleAttributions serves the records matching the file, line, commit, model,
+// since and until query parameters.
+func (s *attributionServer) handleAttributions(w http.ResponseWriter, r *http.Request) {
+	q, err := parseAttributionQuery(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+	idx, err := s.currentIndex()
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, idx.find(q))
+}
+
+// handleAggregates serves totals of the records matching the same query
+// parameters as handleAttributions, grouped by the "by" parameter (model by default).
+func (s *attributionServer) handleAggregates(w http.ResponseWriter, r *http.Request) {
+	by := r.URL.Query().Get("by")
+	if by == "" {
+		by = "model"
+	}
+	keyFn, ok := aggregateKeys[by]
+	if !ok {
+		writeJSONError(w, http.StatusBadRequest, fmt.Errorf("unknown aggregate key %q", by))
+		return
+	}
+	q, err := parseAttributionQuery(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+	idx, err := s.currentIndex()
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, aggregateRecords(idx.find(q), keyFn))
+}
+
+func parseAttributionQuery(r *http.Request) (attributionQuery, error) {
+	params := r.URL.Query()
+	q := attributionQuery{
+		file:   params.Get("file"),
+		commit: params.Get("commit"),
+		model:  params.Get("model"),
+	}
+	if line := params.Get("line"); line != "" {
+		n, err := strconv.Atoi(line)
+		if err != nil {
+			return q, fmt.Errorf("invalid line %q: %v", line, err)
+		}
+		q.line = n
+	}
+	now := time.Now()
+	var err error
+	if q.window.Since, err = parseTimeFlag(params.Get("since"), now); err != nil {
+		return q, fmt.Errorf("invalid since: %v", err)
+	}
+	if q.window.Until, err = parseTimeFlag(params.Get("until"), now); err != nil {
+		return q, fmt.Errorf("invalid until: %v", err)
+	}
+	return q, nil
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		log.Printf("error encoding response: %v", err)
+	}
+}
+
+func writeJSONError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/banksean/me3/blaim"
+)
+
+func testAttributionIndex() *attributionIndex {
+	newer := time.Date(2024, 6, 11, 12, 0, 0, 0, time.UTC)
+	older := time.Date(2024, 6, 10, 12, 0, 0, 0, time.UTC)
+	line := func(fileName string, start, end int, model string) *blaim.BlaimLine {
+		return &blaim.BlaimLine{
+			FileName:        fileName,
+			Range:           blaim.Range{Start: blaim.Position{Line: start}, End: blaim.Position{Line: end}},
+			InferenceConfig: blaim.InferenceConfig{ModelName: model},
+		}
+	}
+	return newAttributionIndex([]*commitAttribution{
+		{commit: "bbbb", author: "Ann", time: newer, lines: []*blaim.BlaimLine{
+			line("a.js", 10, 12, "codegemma"),
+			line("b.js", 1, 1, "codellama"),
+		}},
+		{commit: "aaaa", author: "Bob", time: older, lines: []*blaim.BlaimLine{
+			line("a.js", 20, 29, "codegemma"),
+		}},
+	})
+}
+
+func newTestAttributionServer() *attributionServer {
+	return &attributionServer{
+		loadHead:  func() (string, error) { return "bbbb", nil },
+		loadIndex: func() (*attributionIndex, error) { return testAttributionIndex(), nil },
+	}
+}
+
+func getJSON(t *testing.T, s *attributionServer, url string, v any) int {
+	t.Helper()
+	w := httptest.NewRecorder()
+	s.handler().ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+	if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+		t.Fatalf("%s: error decoding %q: %v", url, w.Body.String(), err)
+	}
+	return w.Code
+}
+
+func TestServeAttributions(t *testing.T) {
+	s := newTestAttributionServer()
+	for _, test := range []struct {
+		url      string
+		expected []string
+	}{
+		{"/api/attributions", []string{"bbbb:a.js:10", "bbbb:b.js:1", "aaaa:a.js:20"}},
+		{"/api/attributions?file=a.js", []string{"bbbb:a.js:10", "aaaa:a.js:20"}},
+		{"/api/attributions?file=a.js&line=25", []string{"aaaa:a.js:20"}},
+		{"/api/attributions?commit=bb", []string{"bbbb:a.js:10", "bbbb:b.js:1"}},
+		{"/api/attributions?model=codellama", []string{"bbbb:b.js:1"}},
+		{"/api/attributions?until=2024-06-11", []string{"aaaa:a.js:20"}},
+	} {
+		records := []*attributionRecord{}
+		if code := getJSON(t, s, test.url, &records); code != 200 {
+			t.Errorf("%s: expected 200, got %d", test.url, code)
+		}
+		got := []string{}
+		for _, r := range records {
+			got = append(got, fmt.Sprintf("%s:%s:%d", r.Commit, r.FileName, r.Range.Start.Line))
+		}
+		if fmt.Sprint(got) != fmt.Sprint(test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.url, test.expected, got)
+		}
+	}
+}
+
+func TestServeAggregates(t *testing.T) {
+	s := newTestAttributionServer()
+	aggs := []aggregate{}
+	getJSON(t, s, "/api/aggregates", &aggs)
+	expected := []aggregate{
+		{Key: "codegemma", Commits: 2, Records: 2, Lines: 13},
+		{Key: "codellama", Commits: 1, Records: 1, Lines: 1},
+	}
+	if fmt.Sprint(aggs) != fmt.Sprint(expected) {
+		t.Errorf("expected %v, got %v", expected, aggs)
+	}
+
+	errResp := map[string]string{}
+	if code := getJSON(t, s, "/api/aggregates?by=color", &errResp); code != 400 || errResp["error"] == "" {
+		t.Errorf("expected a 400 error, got %d %v", code, errResp)
+	}
+}
+
+func TestServeCommits(t *testing.T) {
+	s := newTestAttributionServer()
+	commits := []commitSummary{}
+	getJSON(t, s, "/api/commits", &commits)
+	if len(commits) != 2 || commits[0].Commit != "bbbb" || commits[0].Lines != 4 || commits[1].Records != 1 {
+		t.Errorf("unexpected commits: %+v", commits)
+	}
+}
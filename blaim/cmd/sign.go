@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/banksean/me3/blaim"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// loadPrivateKey reads a private key from path: PKCS #8 (as written by
+// "openssl genpkey"), or unencrypted OpenSSH (as written by ssh-keygen).
+// openSSH reports which it was.
+func loadPrivateKey(path string) (signer ssh.Signer, openSSH bool, err error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false, err
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, false, fmt.Errorf("%s: no PEM-encoded private key found", path)
+	}
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, false, fmt.Errorf("%s: %v", path, err)
+		}
+		if signer, err = ssh.NewSignerFromKey(key); err != nil {
+			return nil, false, fmt.Errorf("%s: %v", path, err)
+		}
+		return signer, false, nil
+	case "OPENSSH PRIVATE KEY":
+		if signer, err = ssh.ParsePrivateKey(b); err != nil {
+			return nil, false, fmt.Errorf("%s: %v", path, err)
+		}
+		return signer, true, nil
+	}
+	return nil, false, fmt.Errorf("%s: unsupported key type %q", path, block.Type)
+}
+
+// loadRecordSigner reads a private key from path. PKCS #8 ed25519 keys make
+// blaim.SignatureEd25519 signatures, and OpenSSH private keys make
+// blaim.SignatureSSH signatures.
+func loadRecordSigner(path string) (blaim.Signer, error) {
+	signer, openSSH, err := loadPrivateKey(path)
+	if err != nil {
+		return nil, err
+	}
+	if openSSH {
+		return &sshSigner{signer: signer, publicKey: authorizedKey(signer.PublicKey())}, nil
+	}
+	if signer.PublicKey().Type() != ssh.KeyAlgoED25519 {
+		return nil, fmt.Errorf("%s: expected an ed25519 key, got %s", path, signer.PublicKey().Type())
+	}
+	return &ed25519Signer{signer: signer, publicKey: authorizedKey(signer.PublicKey())}, nil
+}
+
+// authorizedKey formats k in authorized_keys format, without a trailing newline.
+func authorizedKey(k ssh.PublicKey) string {
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(k)))
+}
+
+// ed25519Signer makes blaim.SignatureEd25519 signatures. An ed25519
+// ssh.Signer's signature blob is the plain ed25519 signature.
+type ed25519Signer struct {
+	signer    ssh.Signer
+	publicKey string
+}
+
+func newEd25519Signer(key ed25519.PrivateKey) (*ed25519Signer, error) {
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return &ed25519Signer{signer: signer, publicKey: authorizedKey(signer.PublicKey())}, nil
+}
+
+func (s *ed25519Signer) Sign(b *blaim.BlaimLine) error {
+	payload, err := b.SigningPayload()
+	if err != nil {
+		return err
+	}
+	sig, err := s.signer.Sign(rand.Reader, payload)
+	if err != nil {
+		return err
+	}
+	b.Signature = &blaim.Signature{
+		Format:    blaim.SignatureEd25519,
+		PublicKey: s.publicKey,
+		Value:     base64.StdEncoding.EncodeToString(sig.Blob),
+	}
+	return nil
+}
+
+type sshSigner struct {
+	signer    ssh.Signer
+	publicKey string
+}
+
+func (s *sshSigner) Sign(b *blaim.BlaimLine) error {
+	payload, err := b.SigningPayload()
+	if err != nil {
+		return err
+	}
+	armored, err := sshSign(s.signer, payload, blaim.SSHSignatureNamespace)
+	if err != nil {
+		return err
+	}
+	b.Signature = &blaim.Signature{
+		Format:    blaim.SignatureSSH,
+		PublicKey: s.publicKey,
+		Value:     armored,
+	}
+	return nil
+}
+
+// The SSH signature format is described in
+// https://github.com/openssh/openssh-portable/blob/master/PROTOCOL.sshsig
+const (
+	sshsigMagic         = "SSHSIG"
+	sshsigVersion       = 1
+	sshsigHashAlgorithm = "sha512"
+	sshsigArmorBegin    = "-----BEGIN SSH SIGNATURE-----"
+	sshsigArmorEnd      = "-----END SSH SIGNATURE-----"
+)
+
+// appendSSHString appends s to buf in the SSH wire format for strings: a
+// 4-byte big-endian length followed by the bytes themselves.
+func appendSSHString(buf []byte, s []byte) []byte {
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(s)))
+	return append(buf, s...)
+}
+
+// readSSHString reads a string in SSH wire format from the start of buf,
+// returning it and the rest of buf.
+func readSSHString(buf []byte) ([]byte, []byte, error) {
+	if len(buf) < 4 {
+		return nil, nil, errors.New("truncated signature")
+	}
+	n := binary.BigEndian.Uint32(buf)
+	if uint32(len(buf)-4) < n {
+		return nil, nil, errors.New("truncated signature")
+	}
+	return buf[4 : 4+n], buf[4+n:], nil
+}
+
+// sshsigSignedData returns the data that the inner SSH signature actually signs.
+func sshsigSignedData(message []byte, namespace string) []byte {
+	h := sha512.Sum512(message)
+	buf := []byte(sshsigMagic)
+	buf = appendSSHString(buf, []byte(namespace))
+	buf = appendSSHString(buf, nil) // reserved
+	buf = appendSSHString(buf, []byte(sshsigHashAlgorithm))
+	return appendSSHString(buf, h[:])
+}
+
+// sshSign returns an armored SSH signature of message, compatible with "ssh-keygen -Y sign".
+func sshSign(signer ssh.Signer, message []byte, namespace string) (string, error) {
+	data := sshsigSignedData(message, namespace)
+	var sig *ssh.Signature
+	var err error
+	// ssh-rsa (SHA-1) signatures aren't accepted in SSH signatures.
+	if as, ok := signer.(ssh.AlgorithmSigner); ok && signer.PublicKey().Type() == ssh.KeyAlgoRSA {
+		sig, err = as.SignWithAlgorithm(rand.Reader, data, ssh.KeyAlgoRSASHA512)
+	} else {
+		sig, err = signer.Sign(rand.Reader, data)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	blob := []byte(sshsigMagic)
+	blob = binary.BigEndian.AppendUint32(blob, sshsigVersion)
+	blob = appendSSHString(blob, signer.PublicKey().Marshal())
+	blob = appendSSHString(blob, []byte(namespace))
+	blob = appendSSHString(blob, nil) // reserved
+	blob = appendSSHString(blob, []byte(sshsigHashAlgorithm))
+	blob = appendSSHString(blob, ssh.Marshal(sig))
+
+	encoded := base64.StdEncoding.EncodeToString(blob)
+	armored := &strings.Builder{}
+	armored.WriteString(sshsigArmorBegin + "\n")
+	for len(encoded) > 70 {
+		armored.WriteString(encoded[:70] + "\n")
+		encoded = encoded[70:]
+	}
+	armored.WriteString(encoded + "\n" + sshsigArmorEnd + "\n")
+	return armored.String(), nil
+}
+
+// sshVerify checks an armored SSH signature of message made in namespace, and
+// returns the public key that made it.
+func sshVerify(armored string, message []byte, namespace string) (ssh.PublicKey, error) {
+	armored = strings.TrimSpace(armored)
+	if !strings.HasPrefix(armored, sshsigArmorBegin) || !strings.HasSuffix(armored, sshsigArmorEnd) {
+		return nil, errors.New("not an armored SSH signature")
+	}
+	encoded := strings.Join(strings.Fields(armored[len(sshsigArmorBegin):len(armored)-len(sshsigArmorEnd)]), "")
+	blob, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(blob, []byte(sshsigMagic)) || len(blob) < len(sshsigMagic)+4 {
+		return nil, errors.New("not an SSH signature")
+	}
+	blob = blob[len(sshsigMagic):]
+	if v := binary.BigEndian.Uint32(blob); v != sshsigVersion {
+		return nil, fmt.Errorf("unsupported SSH signature version %d", v)
+	}
+	blob = blob[4:]
+
+	fields := make([][]byte, 5)
+	for i := range fields {
+		if fields[i], blob, err = readSSHString(blob); err != nil {
+			return nil, err
+		}
+	}
+	pubKeyBytes, sigNamespace, hashAlgorithm, sigBytes := fields[0], string(fields[1]), string(fields[3]), fields[4]
+	if sigNamespace != namespace {
+		return nil, fmt.Errorf("signature is for namespace %q, not %q", sigNamespace, namespace)
+	}
+	if hashAlgorithm != sshsigHashAlgorithm {
+		return nil, fmt.Errorf("unsupported hash algorithm %q", hashAlgorithm)
+	}
+	pubKey, err := ssh.ParsePublicKey(pubKeyBytes)
+	if err != nil {
+		return nil, err
+	}
+	sig := &ssh.Signature{}
+	if err := ssh.Unmarshal(sigBytes, sig); err != nil {
+		return nil, err
+	}
+	if err := pubKey.Verify(sshsigSignedData(message, namespace), sig); err != nil {
+		return nil, err
+	}
+	return pubKey, nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/banksean/me3/blaim"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func testBlaimLine() *blaim.BlaimLine {
+	return &blaim.BlaimLine{
+		FileName:        "playground.js",
+		Range:           blaim.Range{Start: blaim.Position{Line: 26, Character: 1}, End: blaim.Position{Line: 30, Character: 21}},
+		Text:            "function test() {\n  return 1;\n}",
+		InferenceConfig: blaim.InferenceConfig{ModelName: "codegemma", Temperature: 0.2},
+	}
+}
+
+func TestLoadRecordSignerEd25519(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "key.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	signer, err := loadRecordSigner(path)
+	if err != nil {
+		t.Fatalf("error loading key: %v", err)
+	}
+	b := testBlaimLine()
+	if err := signer.Sign(b); err != nil {
+		t.Fatalf("error signing: %v", err)
+	}
+	if b.Signature.Format != blaim.SignatureEd25519 || !strings.HasPrefix(b.Signature.PublicKey, "ssh-ed25519 ") {
+		t.Errorf("unexpected signature: %+v", b.Signature)
+	}
+	if r := verifyBlaimLine(b, nil); r.status != verifySelfSigned {
+		t.Errorf("expected self-signed, got %s: %s", r.status, r.detail)
+	}
+}
+
+func TestSSHSignRoundTrip(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	message := []byte("some attribution record")
+	armored, err := sshSign(signer, message, blaim.SSHSignatureNamespace)
+	if err != nil {
+		t.Fatalf("error signing: %v", err)
+	}
+	got, err := sshVerify(armored, message, blaim.SSHSignatureNamespace)
+	if err != nil {
+		t.Fatalf("error verifying: %v", err)
+	}
+	if ssh.FingerprintSHA256(got) != ssh.FingerprintSHA256(signer.PublicKey()) {
+		t.Errorf("expected key %s, got %s", ssh.FingerprintSHA256(signer.PublicKey()), ssh.FingerprintSHA256(got))
+	}
+	if _, err := sshVerify(armored, []byte("some other record"), blaim.SSHSignatureNamespace); err == nil {
+		t.Errorf("expected an error verifying a different message")
+	}
+	if _, err := sshVerify(armored, message, "git"); err == nil {
+		t.Errorf("expected an error verifying in a different namespace")
+	}
+}
+
+// TestSSHSignInterop checks that our SSH signatures and ssh-keygen's are interchangeable.
+func TestSSHSignInterop(t *testing.T) {
+	if _, err := exec.LookPath("ssh-keygen"); err != nil {
+		t.Skip("ssh-keygen not available")
+	}
+	dir := t.TempDir()
+	keyPath := filepath.Join(dir, "id_ed25519")
+	if out, err := exec.Command("ssh-keygen", "-q", "-t", "ed25519", "-N", "", "-f", keyPath).CombinedOutput(); err != nil {
+		t.Fatalf("ssh-keygen: %v: %s", err, out)
+	}
+	signer, err := loadRecordSigner(keyPath)
+	if err != nil {
+		t.Fatalf("error loading key: %v", err)
+	}
+	b := testBlaimLine()
+	if err := signer.Sign(b); err != nil {
+		t.Fatalf("error signing: %v", err)
+	}
+	payload, _ := b.SigningPayload()
+	payloadPath := filepath.Join(dir, "payload")
+	sigPath := filepath.Join(dir, "payload.sig")
+	os.WriteFile(payloadPath, payload, 0644)
+	os.WriteFile(sigPath, []byte(b.Signature.Value), 0644)
+
+	check := exec.Command("ssh-keygen", "-Y", "check-novalidate", "-n", blaim.SSHSignatureNamespace, "-s", sigPath)
+	check.Stdin = strings.NewReader(string(payload))
+	if out, err := check.CombinedOutput(); err != nil {
+		t.Errorf("ssh-keygen rejected our signature: %v: %s", err, out)
+	}
+
+	os.Remove(sigPath)
+	sign := exec.Command("ssh-keygen", "-q", "-Y", "sign", "-n", blaim.SSHSignatureNamespace, "-f", keyPath, payloadPath)
+	if out, err := sign.CombinedOutput(); err != nil {
+		t.Fatalf("ssh-keygen -Y sign: %v: %s", err, out)
+	}
+	armored, err := os.ReadFile(sigPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sshVerify(string(armored), payload, blaim.SSHSignatureNamespace); err != nil {
+		t.Errorf("error verifying ssh-keygen's signature: %v", err)
+	}
+}
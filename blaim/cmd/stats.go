@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/banksean/me3/blaim"
+)
+
+// modelStats counts what happened to the suggestions made by a single model.
+type modelStats struct {
+	modelName         string
+	shown             int
+	accepted          int
+	partiallyAccepted int
+	rejected          int
+	edited            int
+	// completed counts completions recorded by blaim proxy, which can't tell
+	// whether they were shown or accepted.
+	completed int
+}
+
+// offered returns the number of suggestions the user had a chance to accept.
+// Logs written before shown events were recorded only contain outcomes, so
+// fall back to counting those.
+func (m *modelStats) offered() int {
+	outcomes := m.accepted + m.partiallyAccepted + m.rejected
+	if m.shown > outcomes {
+		return m.shown
+	}
+	return outcomes
+}
+
+// acceptanceRate returns the fraction of offered suggestions that were at least
+// partially accepted, and false if the log doesn't contain enough information
+// to tell, i.e. there are no shown or rejected events for the model.
+func (m *modelStats) acceptanceRate() (float64, bool) {
+	if m.shown == 0 && m.rejected == 0 {
+		return 0, false
+	}
+	return float64(m.accepted+m.partiallyAccepted) / float64(m.offered()), true
+}
+
+// withoutIgnored returns the entries whose files aren't ignored.
+func withoutIgnored(entries []*blaim.AcceptLogLine, ignore func(string) bool) []*blaim.AcceptLogLine {
+	ret := []*blaim.AcceptLogLine{}
+	for _, entry := range entries {
+		if !ignore(entry.FileName) {
+			ret = append(ret, entry)
+		}
+	}
+	return ret
+}
+
+// suggestionEvents is what happened to a single suggestion, from the entries
+// that share its SuggestionID.
+type suggestionEvents struct {
+	modelName string
+	shown     bool
+	edited    bool
+	completed bool
+	// outcome is the last of the suggestion's accepted, partially accepted and
+	// rejected events, or empty if it has none.
+	outcome blaim.EventType
+}
+
+// computeModelStats tallies accept log entries by model name. Entries that
+// share a SuggestionID are counted as one suggestion, which is shown, edited
+// and completed at most once, and has a single outcome: the last of its
+// accepted, partially accepted and rejected events. So accepting a suggestion
+// one word at a time, and then in full, counts as a single accept. Entries
+// without a SuggestionID are each counted separately.
+func computeModelStats(entries []*blaim.AcceptLogLine) []*modelStats {
+	suggestions := []*suggestionEvents{}
+	byID := map[string]*suggestionEvents{}
+	for _, entry := range entries {
+		s := byID[entry.SuggestionID]
+		if s == nil || entry.SuggestionID == "" {
+			s = &suggestionEvents{modelName: entry.InferenceConfig.ModelName}
+			suggestions = append(suggestions, s)
+			if entry.SuggestionID != "" {
+				byID[entry.SuggestionID] = s
+			}
+		}
+		switch event := entry.EventType(); event {
+		case blaim.EventShown:
+			s.shown = true
+		case blaim.EventAccepted, blaim.EventPartiallyAccepted, blaim.EventRejected:
+			s.outcome = event
+		case blaim.EventEditedAfterAccept:
+			s.edited = true
+		case blaim.EventCompleted:
+			s.completed = true
+		}
+	}
+
+	byModel := map[string]*modelStats{}
+	for _, s := range suggestions {
+		stats, ok := byModel[s.modelName]
+		if !ok {
+			stats = &modelStats{modelName: s.modelName}
+			byModel[s.modelName] = stats
+		}
+		if s.shown {
+			stats.shown++
+		}
+		if s.edited {
+			stats.edited++
+		}
+		if s.completed {
+			stats.completed++
+		}
+		switch s.outcome {
+		case blaim.EventAccepted:
+			stats.accepted++
+		case blaim.EventPartiallyAccepted:
+			stats.partiallyAccepted++
+		case blaim.EventRejected:
+			stats.rejected++
+		}
+	}
+
+	ret := []*modelStats{}
+	for _, stats := range byModel {
+		ret = append(ret, stats)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].modelName < ret[j].modelName
+	})
+	return ret
+}
+
+// writeModelStats prints a table of modelStats to out.
+func writeModelStats(out io.Writer, stats []*modelStats) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "MODEL\tSHOWN\tACCEPTED\tPARTIAL\tREJECTED\tEDITED\tCOMPLETED\tACCEPTANCE RATE")
+	for _, m := range stats {
+		rate := "n/a"
+		if r, ok := m.acceptanceRate(); ok {
+			rate = fmt.Sprintf("%.1f%%", r*100)
+		}
+		name := m.modelName
+		if name == "" {
+			name = "(unknown)"
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%d\t%d\t%s\n", name, m.shown, m.accepted, m.partiallyAccepted, m.rejected, m.edited, m.completed, rate)
+	}
+	return w.Flush()
+}
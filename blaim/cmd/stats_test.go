@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/banksean/me3/blaim"
+)
+
+const eventsAcceptLogText = `2024-06-10 15:40:00.000 [info] {"event":"shown","suggestionId":"1","fileName":"a.js","text":"foo(a, b);","inferenceConfig":{"modelName":"codegemma"}}
+2024-06-10 15:40:01.000 [info] {"event":"partiallyAccepted","suggestionId":"1","partialAcceptKind":"word","fileName":"a.js","text":"foo(a, b);","acceptedText":"foo(","inferenceConfig":{"modelName":"codegemma"}}
+2024-06-10 15:40:02.000 [info] {"event":"partiallyAccepted","suggestionId":"1","partialAcceptKind":"word","fileName":"a.js","text":"foo(a, b);","acceptedText":"foo(a, ","inferenceConfig":{"modelName":"codegemma"}}
+2024-06-10 15:41:00.000 [info] {"event":"shown","suggestionId":"2","fileName":"a.js","text":"bar();","inferenceConfig":{"modelName":"codegemma"}}
+2024-06-10 15:41:01.000 [info] {"event":"rejected","suggestionId":"2","fileName":"a.js","text":"bar();","inferenceConfig":{"modelName":"codegemma"}}
+2024-06-10 15:42:00.000 [info] {"event":"shown","suggestionId":"3","fileName":"a.js","text":"baz();","inferenceConfig":{"modelName":"codellama"}}
+2024-06-10 15:42:01.000 [info] {"suggestionId":"3","fileName":"a.js","text":"baz();","inferenceConfig":{"modelName":"codellama"}}
+2024-06-10 15:42:05.000 [info] {"event":"editedAfterAccept","suggestionId":"3","fileName":"a.js","text":"baz();","editedText":"baz(1);","inferenceConfig":{"modelName":"codellama"}}
+2024-06-10 15:43:00.000 [info] {"fileName":"a.js","text":"legacy();","inferenceConfig":{"modelName":"stable-code"}}
+`
+
+func TestComputeModelStats(t *testing.T) {
+	entries, _, err := blaim.ReadAcceptLog(strings.NewReader(eventsAcceptLogText), blaim.AcceptLogOptions{})
+	if err != nil {
+		t.Fatalf("error reading accept log: %v", err)
+	}
+	out := &bytes.Buffer{}
+	if err := writeModelStats(out, computeModelStats(entries)); err != nil {
+		t.Fatalf("error writing stats: %v", err)
+	}
+	expected := `MODEL        SHOWN  ACCEPTED  PARTIAL  REJECTED  EDITED  COMPLETED  ACCEPTANCE RATE
+codegemma    2      0         1        1         0       0          50.0%
+codellama    1      1         0        0         1       0          100.0%
+stable-code  0      1         0        0         0       0          n/a
+`
+	if got := out.String(); got != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, got)
+	}
+}
+
+func TestComputeModelStatsFinalOutcome(t *testing.T) {
+	logText := `2024-06-10 15:40:00.000 [info] {"event":"shown","suggestionId":"1","fileName":"a.js","text":"foo(a, b);","inferenceConfig":{"modelName":"codegemma"}}
+2024-06-10 15:40:01.000 [info] {"event":"partiallyAccepted","suggestionId":"1","partialAcceptKind":"word","fileName":"a.js","text":"foo(a, b);","acceptedText":"foo(","inferenceConfig":{"modelName":"codegemma"}}
+2024-06-10 15:40:02.000 [info] {"suggestionId":"1","fileName":"a.js","text":"foo(a, b);","inferenceConfig":{"modelName":"codegemma"}}
+2024-06-10 15:41:00.000 [info] {"event":"shown","suggestionId":"2","fileName":"a.js","text":"bar();","inferenceConfig":{"modelName":"codegemma"}}
+2024-06-10 15:41:01.000 [info] {"event":"rejected","suggestionId":"2","fileName":"a.js","text":"bar();","inferenceConfig":{"modelName":"codegemma"}}
+2024-06-10 15:42:00.000 [info] {"event":"completed","fileName":"","text":"baz();","inferenceConfig":{"modelName":"codellama"},"promptHash":"ab12"}
+`
+	entries, _, err := blaim.ReadAcceptLog(strings.NewReader(logText), blaim.AcceptLogOptions{})
+	if err != nil {
+		t.Fatalf("error reading accept log: %v", err)
+	}
+	stats := computeModelStats(entries)
+	if len(stats) != 2 {
+		t.Fatalf("expected stats for 2 models, got %d", len(stats))
+	}
+	// Partially accepting a suggestion and then accepting the rest is one accept.
+	gemma := stats[0]
+	if gemma.shown != 2 || gemma.accepted != 1 || gemma.partiallyAccepted != 0 || gemma.rejected != 1 {
+		t.Errorf("expected 2 shown, 1 accepted and 1 rejected, got %+v", gemma)
+	}
+	if rate, ok := gemma.acceptanceRate(); !ok || rate != 0.5 {
+		t.Errorf("expected an acceptance rate of 50%%, got %v, %v", rate, ok)
+	}
+	if llama := stats[1]; llama.completed != 1 || llama.shown != 0 || llama.accepted != 0 {
+		t.Errorf("expected 1 completion, got %+v", llama)
+	}
+	if _, ok := stats[1].acceptanceRate(); ok {
+		t.Errorf("expected no acceptance rate from completions alone")
+	}
+}
+
+func TestWithoutIgnored(t *testing.T) {
+	entries := []*blaim.AcceptLogLine{{FileName: "a.js"}, {FileName: "yarn.lock"}, {FileName: "b.js"}}
+	got := withoutIgnored(entries, func(path string) bool { return strings.HasSuffix(path, ".lock") })
+	if len(got) != 2 || got[0].FileName != "a.js" || got[1].FileName != "b.js" {
+		t.Errorf("expected a.js and b.js, got %v", got)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/banksean/me3/blaim"
+)
+
+// symbolAttribution is how much of a symbol was generated.
+type symbolAttribution struct {
+	FileName string `json:"fileName"`
+	blaim.Symbol
+	GeneratedLines int      `json:"generatedLines"`
+	Models         []string `json:"models"`
+}
+
+func (s symbolAttribution) lines() int {
+	return s.EndLine - s.StartLine + 1
+}
+
+func (s symbolAttribution) generatedPercent() float64 {
+	return 100 * float64(s.GeneratedLines) / float64(s.lines())
+}
+
+// attributeSymbols maps the generated ranges in blaimRangeSet onto the symbols
+// declared in src, returning how many lines of each symbol were generated and by
+// which models. ok is false if there's no blaim.SymbolExtractor for fileName.
+func attributeSymbols(fileName string, src []byte, blaimRangeSet *blaim.BlaimRangeSet) ([]symbolAttribution, bool, error) {
+	extractor, ok := blaim.SymbolExtractorFor(fileName)
+	if !ok {
+		return nil, false, nil
+	}
+	symbols, err := extractor.Symbols(fileName, src)
+	if err != nil {
+		return nil, true, fmt.Errorf("%s: %v", fileName, err)
+	}
+	ret := []symbolAttribution{}
+	for _, sym := range symbols {
+		attr := symbolAttribution{FileName: fileName, Symbol: sym, Models: []string{}}
+		models := map[string]bool{}
+		for line := sym.StartLine; line <= sym.EndLine; line++ {
+			matches := blaimRangeSet.ForSourceLine(line)
+			if len(matches) == 0 {
+				continue
+			}
+			attr.GeneratedLines++
+			for _, m := range matches {
+				models[m.InferenceConfig.ModelName] = true
+			}
+		}
+		for model := range models {
+			attr.Models = append(attr.Models, model)
+		}
+		sort.Strings(attr.Models)
+		ret = append(ret, attr)
+	}
+	return ret, true, nil
+}
+
+// writeSymbolAttributions prints a table of symbol attributions, or a JSON
+// array of them if asJSON is set.
+func writeSymbolAttributions(out io.Writer, attrs []symbolAttribution, asJSON bool) error {
+	if asJSON {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(attrs)
+	}
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "FILE\tSYMBOL\tKIND\tLINES\tGENERATED\tPERCENT\tMODELS")
+	for _, a := range attrs {
+		fmt.Fprintf(w, "%s:%d\t%s\t%s\t%d\t%d\t%.1f%%\t%s\n", a.FileName, a.StartLine, a.Name, a.Kind, a.lines(), a.GeneratedLines, a.generatedPercent(), strings.Join(a.Models, ","))
+	}
+	return w.Flush()
+}
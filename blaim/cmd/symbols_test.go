@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/banksean/me3/blaim"
+)
+
+const symbolsTestSource = `package example
+
+// T is a type.
+type T struct {
+	n int
+}
+
+type (
+	A int
+	B[K comparable] map[K]int
+)
+
+func (t *T) Inc() {
+	t.n++
+}
+
+func (b B[K]) Len() int { return len(b) }
+
+func helper() int {
+	x := 1
+	y := 2
+	return x + y
+}
+`
+
+func TestAttributeSymbols(t *testing.T) {
+	rangeSet := blaim.NewBlaimRangeSet([]*blaim.BlaimLine{
+		{
+			FileName:        "example.go",
+			Range:           blaim.Range{Start: blaim.Position{Line: 20}, End: blaim.Position{Line: 23}},
+			InferenceConfig: blaim.InferenceConfig{ModelName: "codegemma"},
+		},
+		{
+			FileName:        "example.go",
+			Range:           blaim.Range{Start: blaim.Position{Line: 22}, End: blaim.Position{Line: 22}},
+			InferenceConfig: blaim.InferenceConfig{ModelName: "codellama"},
+		},
+	})
+	attrs, ok, err := attributeSymbols("example.go", []byte(symbolsTestSource), rangeSet)
+	if err != nil || !ok {
+		t.Fatalf("expected symbols, got ok=%v err=%v", ok, err)
+	}
+	var helper symbolAttribution
+	for _, a := range attrs {
+		if a.Name == "helper" {
+			helper = a
+		} else if a.GeneratedLines != 0 {
+			t.Errorf("expected no generated lines in %s, got %d", a.Name, a.GeneratedLines)
+		}
+	}
+	if helper.GeneratedLines != 4 || helper.generatedPercent() != 80 {
+		t.Errorf("expected 4 generated lines (80%%) in helper, got %+v", helper)
+	}
+
+	out := &bytes.Buffer{}
+	if err := writeSymbolAttributions(out, []symbolAttribution{helper}, false); err != nil {
+		t.Fatal(err)
+	}
+	expected := `FILE           SYMBOL  KIND  LINES  GENERATED  PERCENT  MODELS
+example.go:19  helper  func  5      4          80.0%    codegemma,codellama
+`
+	if out.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, out.String())
+	}
+
+	if _, ok, _ := attributeSymbols("example.js", nil, rangeSet); ok {
+		t.Errorf("expected no symbol extractor for .js files")
+	}
+}
@@ -0,0 +1,525 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/banksean/me3/blaim"
+
+	"github.com/chzyer/readline"
+)
+
+// tuiSpan is a run of consecutive lines of a file that were generated by the
+// same accepted suggestion.
+type tuiSpan struct {
+	// start and end are the 1-based first and last lines of the span in the
+	// browsed revision of the file.
+	start, end int
+	// commit and author are those of the commit that recorded the attribution.
+	commit string
+	author string
+	line   *blaim.BlaimLine
+}
+
+type tuiFile struct {
+	name  string
+	lines []string
+	spans []*tuiSpan
+}
+
+// loadTUIFiles returns the files at rev with generated lines, with their
+// generated spans in line order.
+func loadTUIFiles(dir, rev, blaimFileName string) ([]*tuiFile, error) {
+	files := []*tuiFile{}
+	err := blameAttributedFiles(dir, rev, blaimFileName, func(fileName string, lines []attributedLine) error {
+		f := &tuiFile{name: fileName}
+		var span *tuiSpan
+		for _, l := range lines {
+			f.lines = append(f.lines, l.text)
+			if l.attribution == nil {
+				span = nil
+				continue
+			}
+			if span != nil && span.line == l.attribution && span.commit == l.commit && span.end == l.finalLine-1 {
+				span.end = l.finalLine
+				continue
+			}
+			span = &tuiSpan{start: l.finalLine, end: l.finalLine, commit: l.commit, author: l.author, line: l.attribution}
+			f.spans = append(f.spans, span)
+		}
+		if len(f.spans) > 0 {
+			files = append(files, f)
+		}
+		return nil
+	})
+	return files, err
+}
+
+// ANSI escape sequences used to draw the UI.
+const (
+	ansiReset       = "\x1b[0m"
+	ansiBold        = "\x1b[1m"
+	ansiDim         = "\x1b[2m"
+	ansiReverse     = "\x1b[7m"
+	ansiClearLine   = "\x1b[K"
+	ansiHome        = "\x1b[H"
+	ansiEnterAltScr = "\x1b[?1049h\x1b[?25l"
+	ansiLeaveAltScr = "\x1b[?25h\x1b[?1049l"
+)
+
+// tuiDetailsHeight is the number of rows describing the current span.
+const tuiDetailsHeight = 4
+
+// tuiModel is the state of the terminal browser: which file and span are
+// selected, the model filter, and how the file is scrolled. It knows nothing
+// about the terminal, so that keys and rendering can be tested without one.
+type tuiModel struct {
+	files []*tuiFile
+	// models are the names of the models that generated any span, sorted.
+	models []string
+	// filter is the model whose spans are shown, or empty for all of them.
+	filter string
+	// file indexes visibleFiles(), and span indexes spans().
+	file    int
+	span    int
+	top     int
+	details bool
+	width   int
+	height  int
+}
+
+func newTUIModel(files []*tuiFile) *tuiModel {
+	m := &tuiModel{files: files, details: true, width: 80, height: 24}
+	seen := map[string]bool{}
+	for _, f := range files {
+		for _, s := range f.spans {
+			if name := s.line.InferenceConfig.ModelName; !seen[name] {
+				seen[name] = true
+				m.models = append(m.models, name)
+			}
+		}
+	}
+	sort.Strings(m.models)
+	m.scrollToSpan()
+	return m
+}
+
+func (m *tuiModel) matches(s *tuiSpan) bool {
+	return m.filter == "" || s.line.InferenceConfig.ModelName == m.filter
+}
+
+// matchingSpans returns the spans of f that pass the filter.
+func (m *tuiModel) matchingSpans(f *tuiFile) []*tuiSpan {
+	ret := []*tuiSpan{}
+	for _, s := range f.spans {
+		if m.matches(s) {
+			ret = append(ret, s)
+		}
+	}
+	return ret
+}
+
+// visibleFiles returns the files with spans that pass the filter.
+func (m *tuiModel) visibleFiles() []*tuiFile {
+	ret := []*tuiFile{}
+	for _, f := range m.files {
+		if len(m.matchingSpans(f)) > 0 {
+			ret = append(ret, f)
+		}
+	}
+	return ret
+}
+
+func (m *tuiModel) currentFile() *tuiFile {
+	files := m.visibleFiles()
+	if m.file >= len(files) {
+		return nil
+	}
+	return files[m.file]
+}
+
+// spans returns the spans of the current file that pass the filter.
+func (m *tuiModel) spans() []*tuiSpan {
+	if f := m.currentFile(); f != nil {
+		return m.matchingSpans(f)
+	}
+	return []*tuiSpan{}
+}
+
+func (m *tuiModel) currentSpan() *tuiSpan {
+	spans := m.spans()
+	if m.span >= len(spans) {
+		return nil
+	}
+	return spans[m.span]
+}
+
+// contentHeight is the number of rows available for the file list and contents.
+func (m *tuiModel) contentHeight() int {
+	h := m.height - 1
+	if m.details {
+		h -= tuiDetailsHeight + 1
+	}
+	return max(h, 1)
+}
+
+// scrollToSpan scrolls so that the current span starts a third of the way
+// down the screen.
+func (m *tuiModel) scrollToSpan() {
+	if s := m.currentSpan(); s != nil {
+		m.top = s.start - 1 - m.contentHeight()/3
+	}
+	m.clampScroll()
+}
+
+func (m *tuiModel) clampScroll() {
+	lines := 0
+	if f := m.currentFile(); f != nil {
+		lines = len(f.lines)
+	}
+	m.top = max(min(m.top, lines-m.contentHeight()), 0)
+}
+
+// selectFile selects the i'th visible file, wrapping around, and its first
+// or last span.
+func (m *tuiModel) selectFile(i int, lastSpan bool) {
+	n := len(m.visibleFiles())
+	if n == 0 {
+		return
+	}
+	m.file = (i%n + n) % n
+	m.span = 0
+	if lastSpan {
+		m.span = len(m.spans()) - 1
+	}
+	m.scrollToSpan()
+}
+
+// handleKey updates the model for a key, as named by decodeKeys, and reports
+// whether the browser should quit.
+func (m *tuiModel) handleKey(key string) bool {
+	switch key {
+	case "q", "ctrl-c", "esc":
+		return true
+	case "j", "tab":
+		m.selectFile(m.file+1, false)
+	case "k", "shift-tab":
+		m.selectFile(m.file-1, false)
+	case "n":
+		if m.span+1 < len(m.spans()) {
+			m.span++
+			m.scrollToSpan()
+		} else {
+			m.selectFile(m.file+1, false)
+		}
+	case "N", "p":
+		if m.span > 0 {
+			m.span--
+			m.scrollToSpan()
+		} else {
+			m.selectFile(m.file-1, true)
+		}
+	case "down":
+		m.top++
+		m.clampScroll()
+	case "up":
+		m.top--
+		m.clampScroll()
+	case "pgdown", " ":
+		m.top += m.contentHeight() - 1
+		m.clampScroll()
+	case "pgup":
+		m.top -= m.contentHeight() - 1
+		m.clampScroll()
+	case "g", "home":
+		m.top = 0
+	case "G", "end":
+		m.top = 1 << 30
+		m.clampScroll()
+	case "m":
+		m.cycleFilter()
+	case "i":
+		m.details = !m.details
+		m.clampScroll()
+	}
+	return false
+}
+
+// cycleFilter shows only the next model's spans, or all spans after the last model.
+func (m *tuiModel) cycleFilter() {
+	next := ""
+	if m.filter == "" && len(m.models) > 0 {
+		next = m.models[0]
+	}
+	for i, name := range m.models {
+		if name == m.filter && i+1 < len(m.models) {
+			next = m.models[i+1]
+		}
+	}
+	// Stay on the same file if it still has spans to show.
+	current := m.currentFile()
+	m.filter = next
+	m.file = 0
+	for i, f := range m.visibleFiles() {
+		if f == current {
+			m.file = i
+		}
+	}
+	m.span = 0
+	m.scrollToSpan()
+}
+
+// fit returns s with tabs expanded and control characters removed, padded or
+// truncated to exactly width runes.
+func fit(s string, width int) string {
+	b := strings.Builder{}
+	n := 0
+	for _, r := range s {
+		if n >= width {
+			break
+		}
+		if r == '\t' {
+			// Expand to the next multiple of 4 columns.
+			for {
+				b.WriteByte(' ')
+				n++
+				if n >= width || n%4 == 0 {
+					break
+				}
+			}
+			continue
+		}
+		if unicode.IsControl(r) {
+			continue
+		}
+		b.WriteRune(r)
+		n++
+	}
+	for ; n < width; n++ {
+		b.WriteByte(' ')
+	}
+	return b.String()
+}
+
+// render returns the rows of the screen, each exactly m.width columns wide
+// before styling: the file list and the current file side by side, the
+// details of the current span, and a status line.
+func (m *tuiModel) render() []string {
+	listWidth := min(32, m.width/3)
+	contentWidth := max(m.width-listWidth-1, 0)
+	files := m.visibleFiles()
+	current := m.currentFile()
+	span := m.currentSpan()
+	generated := map[int]*tuiSpan{}
+	numberWidth := 1
+	if current != nil {
+		for _, s := range m.matchingSpans(current) {
+			for l := s.start; l <= s.end; l++ {
+				generated[l] = s
+			}
+		}
+		numberWidth = len(fmt.Sprint(len(current.lines)))
+	}
+
+	// Scroll the file list just far enough to show the current file.
+	listTop := max(m.file-m.contentHeight()+1, 0)
+	rows := []string{}
+	for row := 0; row < m.contentHeight(); row++ {
+		left := fit("", listWidth)
+		if i := listTop + row; i < len(files) {
+			left = fit(fmt.Sprintf(" %s (%d)", files[i].name, len(m.matchingSpans(files[i]))), listWidth)
+			if files[i] == current {
+				left = ansiReverse + left + ansiReset
+			}
+		}
+		right := ""
+		if lineNumber := m.top + row + 1; current != nil && lineNumber <= len(current.lines) {
+			s := generated[lineNumber]
+			marker := " "
+			if s != nil {
+				marker = "┃"
+			}
+			text := fit(fmt.Sprintf("%*d %s %s", numberWidth, lineNumber, marker, current.lines[lineNumber-1]), contentWidth)
+			switch {
+			case s != nil && s == span:
+				text = ansiReverse + text + ansiReset
+			case s != nil:
+				text = ansiBold + text + ansiReset
+			default:
+				text = ansiDim + text + ansiReset
+			}
+			right = text
+		}
+		rows = append(rows, left+"│"+right)
+	}
+
+	if m.details {
+		rows = append(rows, strings.Repeat("─", m.width))
+		for _, line := range m.detailLines(span) {
+			rows = append(rows, fit(line, m.width))
+		}
+	}
+
+	filter := "all models"
+	if m.filter != "" {
+		filter = m.filter
+	}
+	status := fmt.Sprintf(" %s · span %d/%d · %s · n/N span  j/k file  m model  i details  q quit", fileNameOrNone(current), m.span+1, len(m.spans()), filter)
+	rows = append(rows, ansiReverse+fit(status, m.width)+ansiReset)
+	return rows
+}
+
+func fileNameOrNone(f *tuiFile) string {
+	if f == nil {
+		return "no generated code"
+	}
+	return f.name
+}
+
+// detailLines describes the span: where it is, the commit that recorded it,
+// and the inference config it was generated with.
+func (m *tuiModel) detailLines(s *tuiSpan) []string {
+	ret := make([]string, tuiDetailsHeight)
+	if s == nil {
+		ret[0] = " no generated spans"
+		if m.filter != "" {
+			ret[0] += " from " + m.filter
+		}
+		return ret
+	}
+	c := s.line.InferenceConfig
+	ret[0] = fmt.Sprintf(" lines %d-%d  commit %.12s by %s", s.start, s.end, s.commit, s.author)
+	ret[1] = fmt.Sprintf(" model %s  format %s  endpoint %s", c.ModelName, c.ModelFormat, c.Endpoint)
+	ret[2] = fmt.Sprintf(" temperature %.2f  maxTokens %d  maxLines %d  delay %d", c.Temperature, c.MaxTokens, c.MaxLines, c.Delay)
+	if sig := s.line.Signature; sig != nil {
+		ret[3] = fmt.Sprintf(" signed (%s) by %s", sig.Format, sig.PublicKey)
+	} else {
+		ret[3] = " unsigned"
+	}
+	return ret
+}
+
+// tuiKeys maps the escape sequences terminals send for special keys to the
+// names handleKey uses.
+var tuiKeys = []struct {
+	seq  string
+	name string
+}{
+	{"\x1b[A", "up"},
+	{"\x1b[B", "down"},
+	{"\x1b[5~", "pgup"},
+	{"\x1b[6~", "pgdown"},
+	{"\x1b[H", "home"},
+	{"\x1b[F", "end"},
+	{"\x1b[1~", "home"},
+	{"\x1b[4~", "end"},
+	{"\x1b[Z", "shift-tab"},
+	{"\x1bOA", "up"},
+	{"\x1bOB", "down"},
+	{"\x1b", "esc"},
+	{"\t", "tab"},
+	{"\x03", "ctrl-c"},
+}
+
+// decodeKeys splits bytes read from a terminal in raw mode into key names.
+// Printable keys are named by themselves.
+func decodeKeys(b []byte) []string {
+	keys := []string{}
+	for len(b) > 0 {
+		matched := false
+		for _, k := range tuiKeys {
+			if bytes.HasPrefix(b, []byte(k.seq)) {
+				keys = append(keys, k.name)
+				b = b[len(k.seq):]
+				matched = true
+				break
+			}
+		}
+		if matched {
+			continue
+		}
+		r, size := utf8.DecodeRune(b)
+		keys = append(keys, string(r))
+		b = b[size:]
+	}
+	return keys
+}
+
+// runTUI runs the browser on the terminal at in and out until the user quits.
+func runTUI(in, out *os.File, m *tuiModel) error {
+	fd := int(in.Fd())
+	if !readline.IsTerminal(fd) || !readline.IsTerminal(int(out.Fd())) {
+		return errors.New("blaim tui must be run in a terminal")
+	}
+	state, err := readline.MakeRaw(fd)
+	if err != nil {
+		return err
+	}
+	defer readline.Restore(fd, state)
+	fmt.Fprint(out, ansiEnterAltScr)
+	defer fmt.Fprint(out, ansiLeaveAltScr)
+
+	input := make(chan []byte)
+	go func() {
+		defer close(input)
+		buf := make([]byte, 64)
+		for {
+			n, err := in.Read(buf)
+			if err != nil {
+				return
+			}
+			input <- append([]byte{}, buf[:n]...)
+		}
+	}()
+	resized := make(chan struct{}, 1)
+	readline.DefaultOnWidthChanged(func() {
+		select {
+		case resized <- struct{}{}:
+		default:
+		}
+	})
+
+	for {
+		if w, h, err := readline.GetSize(int(out.Fd())); err == nil {
+			m.width, m.height = w, h
+			m.clampScroll()
+		}
+		if err := drawTUI(out, m.render()); err != nil {
+			return err
+		}
+		select {
+		case b, ok := <-input:
+			if !ok {
+				return nil
+			}
+			for _, key := range decodeKeys(b) {
+				if m.handleKey(key) {
+					return nil
+				}
+			}
+		case <-resized:
+		}
+	}
+}
+
+// drawTUI redraws the screen from the top-left corner.
+func drawTUI(out io.Writer, rows []string) error {
+	b := &strings.Builder{}
+	b.WriteString(ansiHome)
+	for i, row := range rows {
+		b.WriteString(row + ansiClearLine)
+		if i+1 < len(rows) {
+			// The terminal is in raw mode, so newlines don't return the cursor.
+			b.WriteString("\r\n")
+		}
+	}
+	_, err := io.WriteString(out, b.String())
+	return err
+}
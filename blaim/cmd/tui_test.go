@@ -0,0 +1,169 @@
+package main
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/banksean/me3/blaim"
+)
+
+func TestLoadTUIFiles(t *testing.T) {
+	dir, _ := newTestRepo(t, blameTestCommits...)
+	files, err := loadTUIFiles(dir, "HEAD", ".blaim")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].name != "main.go" || len(files[0].lines) != 5 {
+		t.Fatalf("expected main.go with 5 lines, got %+v", files)
+	}
+	spans := files[0].spans
+	// Lines 2 and 3 of the first commit are lines 3 and 4 at HEAD.
+	if len(spans) != 1 || spans[0].start != 3 || spans[0].end != 4 || spans[0].author != "Test" || spans[0].line.InferenceConfig.ModelName != "codegemma" {
+		t.Errorf("unexpected spans %+v", spans)
+	}
+}
+
+func testTUIFiles() []*tuiFile {
+	gemma := &blaim.BlaimLine{InferenceConfig: blaim.InferenceConfig{ModelName: "codegemma", Temperature: 0.2}}
+	llama := &blaim.BlaimLine{InferenceConfig: blaim.InferenceConfig{ModelName: "codellama"}}
+	lines := func(n int) []string {
+		ret := []string{}
+		for i := 1; i <= n; i++ {
+			ret = append(ret, "line")
+		}
+		return ret
+	}
+	return []*tuiFile{
+		{name: "a.go", lines: lines(100), spans: []*tuiSpan{
+			{start: 10, end: 12, commit: "aaaa", author: "A", line: gemma},
+			{start: 50, end: 50, commit: "bbbb", author: "B", line: llama},
+		}},
+		{name: "b.go", lines: lines(5), spans: []*tuiSpan{
+			{start: 2, end: 3, commit: "cccc", author: "C", line: gemma},
+		}},
+	}
+}
+
+func TestTUIModelKeys(t *testing.T) {
+	m := newTUIModel(testTUIFiles())
+	if !reflect.DeepEqual(m.models, []string{"codegemma", "codellama"}) {
+		t.Errorf("unexpected models %v", m.models)
+	}
+	if s := m.currentSpan(); s == nil || s.start != 10 {
+		t.Fatalf("expected the first span of a.go, got %+v", s)
+	}
+	// Content is 24 rows, less the status line and details, so a span
+	// scrolled a third of the way down starts 6 rows below the top.
+	if m.top != 3 {
+		t.Errorf("expected to scroll to line 4, got %d", m.top+1)
+	}
+	m.handleKey("n")
+	if s := m.currentSpan(); s.start != 50 {
+		t.Errorf("expected the second span, got %+v", s)
+	}
+	// n at the last span moves on to the next file, and N back again.
+	m.handleKey("n")
+	if m.currentFile().name != "b.go" || m.currentSpan().start != 2 || m.top != 0 {
+		t.Errorf("expected the first span of b.go, got %s %+v", m.currentFile().name, m.currentSpan())
+	}
+	m.handleKey("N")
+	if m.currentFile().name != "a.go" || m.currentSpan().start != 50 {
+		t.Errorf("expected the last span of a.go, got %s %+v", m.currentFile().name, m.currentSpan())
+	}
+	m.handleKey("G")
+	if m.top != 100-m.contentHeight() {
+		t.Errorf("expected to scroll to the end, got %d", m.top)
+	}
+	m.handleKey("g")
+	m.handleKey("up")
+	if m.top != 0 {
+		t.Errorf("expected not to scroll above the top, got %d", m.top)
+	}
+
+	// Filtering to codellama hides b.go, and the codegemma span in a.go.
+	m.handleKey("m")
+	m.handleKey("m")
+	if m.filter != "codellama" || len(m.visibleFiles()) != 1 || len(m.spans()) != 1 || m.currentSpan().start != 50 {
+		t.Errorf("expected only the codellama span, got filter %q and %+v", m.filter, m.spans())
+	}
+	m.handleKey("m")
+	if m.filter != "" || len(m.visibleFiles()) != 2 {
+		t.Errorf("expected the filter to cycle back to all models, got %q", m.filter)
+	}
+	if !m.handleKey("q") {
+		t.Errorf("expected q to quit")
+	}
+}
+
+var ansiEscape = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+func TestTUIModelRender(t *testing.T) {
+	m := newTUIModel(testTUIFiles())
+	m.width, m.height = 60, 12
+	m.scrollToSpan()
+	rows := m.render()
+	if len(rows) != 12 {
+		t.Fatalf("expected 12 rows, got %d", len(rows))
+	}
+	for i, row := range rows {
+		if n := len([]rune(ansiEscape.ReplaceAllString(row, ""))); n != 60 {
+			t.Errorf("row %d is %d columns wide: %q", i, n, row)
+		}
+	}
+	plain := ansiEscape.ReplaceAllString(strings.Join(rows, "\n"), "")
+	for _, expected := range []string{
+		" a.go (2)",
+		" b.go (1)",
+		"│  9   line",
+		"│ 10 ┃ line",
+		" lines 10-12  commit aaaa by A",
+		" model codegemma",
+		" temperature 0.20",
+		" unsigned",
+		" a.go · span 1/2 · all models",
+	} {
+		if !strings.Contains(plain, expected) {
+			t.Errorf("expected %q in:\n%s", expected, plain)
+		}
+	}
+	// The current span is highlighted, and other lines aren't.
+	if !strings.Contains(strings.Join(rows, "\n"), ansiReverse+" 10 ┃") {
+		t.Errorf("expected the current span to be highlighted")
+	}
+
+	// With a filter, the file list counts only the spans that pass it.
+	m.handleKey("m")
+	m.handleKey("m")
+	plain = ansiEscape.ReplaceAllString(strings.Join(m.render(), "\n"), "")
+	if !strings.Contains(plain, " a.go (1)") || strings.Contains(plain, " b.go") {
+		t.Errorf("expected a.go with 1 codellama span, and no b.go, in:\n%s", plain)
+	}
+}
+
+func TestDecodeKeys(t *testing.T) {
+	got := decodeKeys([]byte("jn\x1b[A\x1b[6~\x1b[Z\x03\x1bé"))
+	expected := []string{"j", "n", "up", "pgdown", "shift-tab", "ctrl-c", "esc", "é"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+}
+
+func TestFit(t *testing.T) {
+	for _, test := range []struct {
+		s        string
+		width    int
+		expected string
+	}{
+		{"abc", 5, "abc  "},
+		{"abcdef", 4, "abcd"},
+		{"\tx", 6, "    x "},
+		{"ab\tx", 6, "ab  x "},
+		{"a\x1b[31mb", 4, "a[31"},
+	} {
+		if got := fit(test.s, test.width); got != test.expected {
+			t.Errorf("fit(%q, %d): expected %q, got %q", test.s, test.width, test.expected, got)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/banksean/me3/blaim"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// verifyStatus is the outcome of checking the signature of a BlaimLine.
+type verifyStatus string
+
+const (
+	// verifyOK means the signature is valid, and made by an allowed signer.
+	verifyOK verifyStatus = "ok"
+	// verifyUnsigned means the record has no signature.
+	verifyUnsigned verifyStatus = "unsigned"
+	// verifyTampered means the signature doesn't match the record, so the
+	// record was edited after it was signed, or the signature was forged.
+	verifyTampered verifyStatus = "tampered"
+	// verifyUntrusted means the signature is valid, but wasn't made by any of
+	// the allowed signers.
+	verifyUntrusted verifyStatus = "untrusted"
+	// verifySelfSigned means the signature is valid, but there are no allowed
+	// signers to check the key against. The public key is stored in the record
+	// itself, so anyone can edit a record and sign it again with their own key.
+	verifySelfSigned verifyStatus = "self-signed"
+)
+
+type verifyResult struct {
+	line   *blaim.BlaimLine
+	status verifyStatus
+	// detail explains the status, e.g. who signed the record or why the signature is invalid.
+	detail string
+}
+
+// allowedSigner is an entry in an allowed signers file.
+type allowedSigner struct {
+	principals []string
+	// namespaces restricts which namespaces the key may sign in. Nil means any.
+	namespaces []string
+	key        ssh.PublicKey
+}
+
+// parseAllowedSigners parses the allowed signers file format used by
+// "ssh-keygen -Y verify" and git's gpg.ssh.allowedSignersFile setting: one
+// entry per line, of comma-separated principals, optional options, and a
+// public key. Both ed25519 and SSH signatures are checked against it.
+func parseAllowedSigners(r io.Reader) ([]allowedSigner, error) {
+	ret := []allowedSigner{}
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		principals, rest, ok := strings.Cut(line, " ")
+		if !ok {
+			return nil, fmt.Errorf("line %d: missing public key", lineNumber)
+		}
+		key, _, options, _, err := ssh.ParseAuthorizedKey([]byte(strings.TrimSpace(rest)))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNumber, err)
+		}
+		signer := allowedSigner{principals: strings.Split(principals, ","), key: key}
+		for _, option := range options {
+			if value, ok := strings.CutPrefix(option, "namespaces="); ok {
+				signer.namespaces = strings.Split(strings.Trim(value, `"`), ",")
+			}
+		}
+		ret = append(ret, signer)
+	}
+	return ret, scanner.Err()
+}
+
+// principalFor returns the principals allowed to sign BlaimLines with key.
+func principalFor(signers []allowedSigner, key ssh.PublicKey) (string, bool) {
+	for _, s := range signers {
+		if !bytes.Equal(s.key.Marshal(), key.Marshal()) {
+			continue
+		}
+		if s.namespaces != nil && !containsString(s.namespaces, blaim.SSHSignatureNamespace) {
+			continue
+		}
+		return strings.Join(s.principals, ","), true
+	}
+	return "", false
+}
+
+func containsString(l []string, s string) bool {
+	for _, v := range l {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyBlaimLine checks the signature of b. If signers is nil, there's
+// nothing to trust the signing key by, so valid signatures are only
+// self-signed.
+func verifyBlaimLine(b *blaim.BlaimLine, signers []allowedSigner) verifyResult {
+	result := verifyResult{line: b}
+	tampered := func(format string, args ...any) verifyResult {
+		result.status = verifyTampered
+		result.detail = fmt.Sprintf(format, args...)
+		return result
+	}
+	if b.Signature == nil {
+		result.status = verifyUnsigned
+		return result
+	}
+	payload, err := b.SigningPayload()
+	if err != nil {
+		return tampered("%v", err)
+	}
+	key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(b.Signature.PublicKey))
+	if err != nil {
+		return tampered("invalid public key: %v", err)
+	}
+
+	switch b.Signature.Format {
+	case blaim.SignatureEd25519:
+		cryptoKey, ok := key.(ssh.CryptoPublicKey)
+		if !ok {
+			return tampered("not an ed25519 public key")
+		}
+		edKey, ok := cryptoKey.CryptoPublicKey().(ed25519.PublicKey)
+		if !ok {
+			return tampered("not an ed25519 public key")
+		}
+		sig, err := base64.StdEncoding.DecodeString(b.Signature.Value)
+		if err != nil {
+			return tampered("invalid signature encoding: %v", err)
+		}
+		if !ed25519.Verify(edKey, payload, sig) {
+			return tampered("signature does not match record")
+		}
+	case blaim.SignatureSSH:
+		signingKey, err := sshVerify(b.Signature.Value, payload, blaim.SSHSignatureNamespace)
+		if err != nil {
+			return tampered("signature does not match record: %v", err)
+		}
+		if !bytes.Equal(signingKey.Marshal(), key.Marshal()) {
+			return tampered("signature was made by %s, not the recorded public key", ssh.FingerprintSHA256(signingKey))
+		}
+	default:
+		return tampered("unknown signature format %q", b.Signature.Format)
+	}
+
+	fingerprint := ssh.FingerprintSHA256(key)
+	if signers == nil {
+		result.status = verifySelfSigned
+		result.detail = "signed by " + fingerprint + ", but no allowed signers were given"
+		return result
+	}
+	principal, ok := principalFor(signers, key)
+	if !ok {
+		result.status = verifyUntrusted
+		result.detail = fingerprint + " is not an allowed signer"
+		return result
+	}
+	result.status = verifyOK
+	result.detail = "signed by " + principal
+	return result
+}
+
+// writeVerifyResults prints a line for each result and a summary, and returns
+// an error if any record failed verification, including self-signed ones.
+// Unsigned records only count as failures if allowUnsigned is false.
+func writeVerifyResults(out io.Writer, results []verifyResult, allowUnsigned bool) error {
+	counts := map[verifyStatus]int{}
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	for _, r := range results {
+		counts[r.status]++
+		fmt.Fprintf(w, "%s\t%s:%d-%d\t%s\t%s\n", r.status, r.line.FileName, r.line.Range.Start.Line, r.line.Range.End.Line, r.line.InferenceConfig.ModelName, r.detail)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "%d ok, %d unsigned, %d tampered, %d untrusted, %d self-signed\n",
+		counts[verifyOK], counts[verifyUnsigned], counts[verifyTampered], counts[verifyUntrusted], counts[verifySelfSigned])
+
+	failed := counts[verifyTampered] + counts[verifyUntrusted] + counts[verifySelfSigned]
+	if !allowUnsigned {
+		failed += counts[verifyUnsigned]
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d records failed verification", failed)
+	}
+	return nil
+}
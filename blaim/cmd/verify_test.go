@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"strings"
+	"testing"
+)
+
+func TestVerifyBlaimLine(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := newEd25519Signer(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, otherKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherSigner, err := newEd25519Signer(otherKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signers, err := parseAllowedSigners(strings.NewReader("# comment\nann@example.com " + signer.publicKey + "\n" +
+		`bob@example.com namespaces="git" ` + otherSigner.publicKey + "\n"))
+	if err != nil {
+		t.Fatalf("error parsing allowed signers: %v", err)
+	}
+
+	signed := testBlaimLine()
+	signer.Sign(signed)
+	tampered := testBlaimLine()
+	signer.Sign(tampered)
+	tampered.InferenceConfig.ModelName = "human"
+	// bob's key is only allowed in the git namespace.
+	untrusted := testBlaimLine()
+	otherSigner.Sign(untrusted)
+
+	results := []verifyResult{
+		verifyBlaimLine(signed, signers),
+		verifyBlaimLine(testBlaimLine(), signers),
+		verifyBlaimLine(tampered, signers),
+		verifyBlaimLine(untrusted, signers),
+		// Without allowed signers, a valid signature proves nothing about who made it.
+		verifyBlaimLine(signed, nil),
+	}
+	expected := []verifyStatus{verifyOK, verifyUnsigned, verifyTampered, verifyUntrusted, verifySelfSigned}
+	for i, r := range results {
+		if r.status != expected[i] {
+			t.Errorf("result %d: expected %s, got %s: %s", i, expected[i], r.status, r.detail)
+		}
+	}
+	if results[0].detail != "signed by ann@example.com" {
+		t.Errorf("unexpected detail: %s", results[0].detail)
+	}
+
+	out := &bytes.Buffer{}
+	if err := writeVerifyResults(out, results, true); err == nil {
+		t.Errorf("expected an error for tampered records")
+	}
+	if !strings.HasSuffix(out.String(), "1 ok, 1 unsigned, 1 tampered, 1 untrusted, 1 self-signed\n") {
+		t.Errorf("unexpected output: %s", out.String())
+	}
+	if err := writeVerifyResults(&bytes.Buffer{}, results[:2], true); err != nil {
+		t.Errorf("unexpected error allowing unsigned records: %v", err)
+	}
+	if err := writeVerifyResults(&bytes.Buffer{}, results[:2], false); err == nil {
+		t.Errorf("expected an error for unsigned records")
+	}
+	if err := writeVerifyResults(&bytes.Buffer{}, results[4:], true); err == nil {
+		t.Errorf("expected an error for self-signed records")
+	}
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/banksean/me3/blaim"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchDebounce is how long watch waits for changes to settle before
+// regenerating the working attribution file, so that saving many files at once,
+// or a git checkout, only regenerates it once.
+const watchDebounce = 200 * time.Millisecond
+
+// watchTempSuffix is added to the name of the attribution file to name the
+// temp files it's written to.
+const watchTempSuffix = ".watch-"
+
+// emptyTree is the hash of git's empty tree, which a repository with no
+// commits yet is diffed against.
+const emptyTree = "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+
+// acceptLogTail follows an accept log as it grows, reading only what has been
+// appended since the last update.
+type acceptLogTail struct {
+	path string
+	info os.FileInfo
+	// contents is everything read from the log so far.
+	contents []byte
+}
+
+// update reads whatever has been appended to the log. If the log has been
+// replaced or truncated, e.g. by compact, it is read again from the start. A
+// log that doesn't exist yet is treated as empty.
+func (t *acceptLogTail) update() error {
+	f, err := os.Open(t.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		t.info, t.contents = nil, nil
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error opening accept log at %s: %v", t.path, err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if t.info == nil || !os.SameFile(t.info, info) || info.Size() < int64(len(t.contents)) {
+		t.contents = nil
+	} else if _, err := f.Seek(int64(len(t.contents)), io.SeekStart); err != nil {
+		return err
+	}
+	b, err := io.ReadAll(f)
+	if err != nil {
+		return fmt.Errorf("error reading accept log at %s: %v", t.path, err)
+	}
+	t.info = info
+	t.contents = append(t.contents, b...)
+	return nil
+}
+
+// lines returns the complete lines read so far. A last line without a newline
+// may still be being written, so it's left out until the rest of it arrives.
+func (t *acceptLogTail) lines() []byte {
+	return t.contents[:bytes.LastIndexByte(t.contents, '\n')+1]
+}
+
+// workingDiff returns a git diff of everything that hasn't been committed in
+// the repository at dir: staged and unstaged changes, and files that git
+// doesn't track yet but doesn't ignore either.
+func workingDiff(dir string) (string, error) {
+	base := "HEAD"
+	if _, err := gitOutput(dir, "rev-parse", "--verify", "-q", "HEAD"); err != nil {
+		base = emptyTree
+	}
+	prefixes := []string{"--no-color", "--no-ext-diff", "--src-prefix=a/", "--dst-prefix=b/"}
+	ret, err := gitOutput(dir, append(append([]string{"diff"}, prefixes...), base, "--")...)
+	if err != nil {
+		return "", err
+	}
+	untracked, err := gitOutput(dir, "ls-files", "-z", "--others", "--exclude-standard")
+	if err != nil {
+		return "", err
+	}
+	for _, fileName := range strings.Split(untracked, "\x00") {
+		if fileName == "" {
+			continue
+		}
+		// git diff --no-index exits with status 1 when the files differ, which
+		// they always do here.
+		cmd := exec.Command("git", append(append([]string{"diff", "--no-index"}, prefixes...), "--", os.DevNull, fileName)...)
+		cmd.Dir = dir
+		out, err := cmd.Output()
+		if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1 {
+			err = nil
+		}
+		if err != nil {
+			return "", fmt.Errorf("git diff --no-index %s: %v", fileName, err)
+		}
+		ret += string(out)
+	}
+	return ret, nil
+}
+
+// workingAttribution keeps a .blaim file up to date with the uncommitted
+// changes in a repository.
+type workingAttribution struct {
+	// dir is the root of the repository, and outPath the .blaim file.
+	dir     string
+	outPath string
+	logs    []*acceptLogTail
+	opts    blaim.GenerateOptions
+	// sinceHEAD scopes the accept log to entries accepted after the HEAD
+	// commit, as generate does by default, following HEAD as commits are made.
+	sinceHEAD bool
+}
+
+func newWorkingAttribution(dir, outPath string, logPaths []string, opts blaim.GenerateOptions, sinceHEAD bool) *workingAttribution {
+	w := &workingAttribution{dir: dir, outPath: outPath, opts: opts, sinceHEAD: sinceHEAD}
+	for _, path := range logPaths {
+		w.logs = append(w.logs, &acceptLogTail{path: path})
+	}
+	return w
+}
+
+// update regenerates the .blaim file from the working tree and the accept
+// logs, and reports whether its contents changed. The file is only rewritten
+// when they do.
+func (w *workingAttribution) update() (bool, error) {
+	logs := []io.Reader{}
+	for i, t := range w.logs {
+		if err := t.update(); err != nil {
+			return false, err
+		}
+		if i > 0 {
+			// In case the previous log doesn't end with a newline.
+			logs = append(logs, strings.NewReader("\n"))
+		}
+		logs = append(logs, bytes.NewReader(t.lines()))
+	}
+	opts := w.opts
+	if w.sinceHEAD {
+		opts.AcceptLog.Window.Since = time.Time{}
+		if t, err := parentCommitTime(w.dir, false); err == nil {
+			opts.AcceptLog.Window.Since = t
+		}
+	}
+	d, err := workingDiff(w.dir)
+	if err != nil {
+		return false, err
+	}
+	out := &bytes.Buffer{}
+	if _, err := blaim.Generate(strings.NewReader(d), io.MultiReader(logs...), out, opts); err != nil {
+		return false, err
+	}
+	if existing, err := os.ReadFile(w.outPath); err == nil && bytes.Equal(existing, out.Bytes()) {
+		return false, nil
+	}
+	return true, writeFileAtomically(w.outPath, out.Bytes())
+}
+
+// writeFileAtomically writes b to a temp file in the same directory as path and
+// renames it over path, so editors reading the file never see half of it.
+func writeFileAtomically(path string, b []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+watchTempSuffix+"*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// workingTreeWatcher regenerates a working attribution file whenever a file in
+// the working tree or an accept log changes, or a commit is made.
+type workingTreeWatcher struct {
+	root   string
+	gitDir string
+	// logPaths are the absolute paths of the accept logs.
+	logPaths    map[string]bool
+	attribution *workingAttribution
+	fsw         *fsnotify.Watcher
+	debounce    time.Duration
+}
+
+// newWorkingTreeWatcher watches root, except for what git ignores, and the
+// directories of the accept logs that w reads. root must be absolute.
+func newWorkingTreeWatcher(root string, w *workingAttribution) (*workingTreeWatcher, error) {
+	gitDir, err := gitOutput(root, "rev-parse", "--absolute-git-dir")
+	if err != nil {
+		return nil, err
+	}
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	ret := &workingTreeWatcher{
+		root:        root,
+		gitDir:      strings.TrimSpace(gitDir),
+		logPaths:    map[string]bool{},
+		attribution: w,
+		fsw:         fsw,
+		debounce:    watchDebounce,
+	}
+	// Watching the git directory itself, but not its subdirectories, is
+	// enough to see commits and checkouts, which rewrite the index.
+	if err := fsw.Add(ret.gitDir); err != nil {
+		fsw.Close()
+		return nil, err
+	}
+	for _, t := range w.logs {
+		path, err := filepath.Abs(t.path)
+		if err != nil {
+			fsw.Close()
+			return nil, err
+		}
+		ret.logPaths[path] = true
+		// The log may be replaced, or not exist yet, so watch its directory.
+		if err := fsw.Add(filepath.Dir(path)); err != nil {
+			fsw.Close()
+			return nil, fmt.Errorf("error watching accept log at %s: %v", t.path, err)
+		}
+	}
+	if err := ret.addTree(root); err != nil {
+		fsw.Close()
+		return nil, err
+	}
+	return ret, nil
+}
+
+func (ww *workingTreeWatcher) Close() error {
+	return ww.fsw.Close()
+}
+
+// addTree watches dir and its subdirectories, skipping git's own directory and
+// any that git ignores. fsnotify doesn't watch directories recursively.
+func (ww *workingTreeWatcher) addTree(dir string) error {
+	out, err := gitOutput(ww.root, "ls-files", "-z", "--others", "--ignored", "--exclude-standard", "--directory", "--", dir)
+	if err != nil {
+		return err
+	}
+	ignored := map[string]bool{}
+	for _, entry := range strings.Split(out, "\x00") {
+		if strings.HasSuffix(entry, "/") {
+			ignored[filepath.Join(ww.root, entry)] = true
+		}
+	}
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// The directory may have been removed since it was created.
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if d.Name() == ".git" || path == ww.gitDir || ignored[path] {
+			return filepath.SkipDir
+		}
+		return ww.fsw.Add(path)
+	})
+}
+
+// relevant reports whether a change to path could change the working
+// attribution file.
+func (ww *workingTreeWatcher) relevant(path string) bool {
+	if ww.logPaths[path] {
+		return true
+	}
+	if filepath.Dir(path) == ww.gitDir {
+		name := filepath.Base(path)
+		return name == "HEAD" || name == "index"
+	}
+	rel, err := filepath.Rel(ww.root, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		// Another file next to an accept log.
+		return false
+	}
+	// Skip the attribution file itself, and its temp files.
+	return path != ww.attribution.outPath && !strings.HasPrefix(path, ww.attribution.outPath+watchTempSuffix)
+}
+
+// run updates the attribution file, and then again each time relevant changes
+// settle, until stop is closed. Errors updating it are logged rather than
+// returned, since they're often transient, e.g. in the middle of a rebase.
+func (ww *workingTreeWatcher) run(stop <-chan struct{}, updated func(changed bool)) error {
+	update := func() {
+		changed, err := ww.attribution.update()
+		if err != nil {
+			log.Printf("error updating %s: %v", ww.attribution.outPath, err)
+			return
+		}
+		if updated != nil {
+			updated(changed)
+		}
+	}
+	update()
+	timer := time.NewTimer(ww.debounce)
+	timer.Stop()
+	for {
+		select {
+		case <-stop:
+			timer.Stop()
+			return nil
+		case err, ok := <-ww.fsw.Errors:
+			if !ok {
+				return nil
+			}
+			log.Printf("error watching %s: %v", ww.root, err)
+		case e, ok := <-ww.fsw.Events:
+			if !ok {
+				return nil
+			}
+			if !ww.relevant(e.Name) {
+				continue
+			}
+			if e.Has(fsnotify.Create) {
+				if info, err := os.Stat(e.Name); err == nil && info.IsDir() {
+					if err := ww.addTree(e.Name); err != nil {
+						log.Printf("error watching %s: %v", e.Name, err)
+					}
+				}
+			}
+			timer.Reset(ww.debounce)
+		case <-timer.C:
+			update()
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/banksean/me3/blaim"
+)
+
+func TestAcceptLogTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "accepted.suggestions.log")
+	tail := &acceptLogTail{path: path}
+	expect := func(expected string) {
+		t.Helper()
+		if err := tail.update(); err != nil {
+			t.Fatal(err)
+		}
+		if got := string(tail.lines()); got != expected {
+			t.Errorf("expected %q, got %q", expected, got)
+		}
+	}
+	appendLog := func(s string) {
+		t.Helper()
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if _, err := f.WriteString(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The log doesn't exist until the first suggestion is accepted.
+	expect("")
+	appendLog("a\n")
+	expect("a\n")
+	// A line isn't read until it's complete.
+	appendLog("b\nc")
+	expect("a\nb\n")
+	appendLog("\n")
+	expect("a\nb\nc\n")
+
+	// Replacing the log, as compact does, reads it again.
+	replacement := path + ".compact"
+	if err := os.WriteFile(replacement, []byte("b\nc\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(replacement, path); err != nil {
+		t.Fatal(err)
+	}
+	expect("b\nc\n")
+	if err := os.Truncate(path, 0); err != nil {
+		t.Fatal(err)
+	}
+	appendLog("d\n")
+	expect("d\n")
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	expect("")
+}
+
+func TestWorkingDiff(t *testing.T) {
+	dir, _ := newTestRepo(t, blameTestCommits...)
+	for name, contents := range map[string]string{
+		"main.go":    "h\na\nx\ny\nb\nchanged\n",
+		"new.go":     "new\n",
+		".gitignore": "ignored.go\n",
+		"ignored.go": "ignored\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	d, err := workingDiff(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"+++ b/main.go\n", "+changed\n", "+++ b/new.go\n", "+new\n", "+++ b/.gitignore\n"} {
+		if !strings.Contains(d, expected) {
+			t.Errorf("expected %q in diff:\n%s", expected, d)
+		}
+	}
+	if strings.Contains(d, "ignored.go\n+++") || strings.Contains(d, "+ignored\n") {
+		t.Errorf("expected no diff of an ignored file:\n%s", d)
+	}
+}
+
+func watchTestAccept(fileName, text string) string {
+	return `2024-06-10 15:42:42.061 [info] {"fileName":"` + fileName + `","position":{"line":0,"character":0},"text":"` + text + `","inferenceConfig":{"modelName":"codegemma","temperature":0.2}}` + "\n"
+}
+
+func readWatchTestBlaim(t *testing.T, path string) map[string][]*blaim.BlaimLine {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	ret, err := blaim.ReadBlaimFile(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ret
+}
+
+func TestWorkingAttributionUpdate(t *testing.T) {
+	dir, _ := newTestRepo(t, blameTestCommits...)
+	logPath := filepath.Join(t.TempDir(), "accepted.suggestions.log")
+	if err := os.WriteFile(logPath, []byte(watchTestAccept("gen.go", `func generated() {\n}`)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	outPath := filepath.Join(dir, ".blaim")
+	w := newWorkingAttribution(dir, outPath, []string{logPath}, blaim.GenerateOptions{}, false)
+
+	// Nothing has changed since the last commit.
+	if _, err := w.update(); err != nil {
+		t.Fatal(err)
+	}
+	if lines := readWatchTestBlaim(t, outPath); len(lines) != 0 {
+		t.Errorf("expected no attributions, got %v", lines)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "gen.go"), []byte("package main\n\nfunc generated() {\n}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	changed, err := w.update()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed {
+		t.Errorf("expected the attribution file to change")
+	}
+	if lines := readWatchTestBlaim(t, outPath)["gen.go"]; len(lines) != 1 || lines[0].InferenceConfig.ModelName != "codegemma" {
+		t.Errorf("expected gen.go to be attributed to codegemma, got %v", lines)
+	}
+	if changed, err := w.update(); err != nil || changed {
+		t.Errorf("expected no change, got %v, %v", changed, err)
+	}
+}
+
+func TestWorkingTreeWatcher(t *testing.T) {
+	dir, _ := newTestRepo(t, blameTestCommits...)
+	logDir := t.TempDir()
+	logPath := filepath.Join(logDir, "accepted.suggestions.log")
+	outPath := filepath.Join(dir, ".blaim")
+	ww, err := newWorkingTreeWatcher(dir, newWorkingAttribution(dir, outPath, []string{logPath}, blaim.GenerateOptions{}, false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ww.Close()
+	ww.debounce = 10 * time.Millisecond
+
+	for path, expected := range map[string]bool{
+		logPath:                            true,
+		filepath.Join(logDir, "other.log"): false,
+		filepath.Join(dir, "main.go"):      true,
+		filepath.Join(dir, ".blaimignore"): true,
+		outPath:                            false,
+		outPath + watchTempSuffix + "123":  false,
+		filepath.Join(ww.gitDir, "index"):  true,
+		filepath.Join(ww.gitDir, "config"): false,
+	} {
+		if got := ww.relevant(path); got != expected {
+			t.Errorf("relevant(%s): expected %v, got %v", path, expected, got)
+		}
+	}
+
+	updates := make(chan bool, 10)
+	stop := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- ww.run(stop, func(changed bool) { updates <- changed })
+	}()
+	waitForUpdate := func() {
+		t.Helper()
+		for {
+			select {
+			case changed := <-updates:
+				if changed {
+					return
+				}
+			case <-time.After(10 * time.Second):
+				t.Fatal("timed out waiting for the attribution file to be updated")
+			}
+		}
+	}
+	// The file is written when watch starts.
+	waitForUpdate()
+
+	// Accepting a suggestion in a new directory, and then saving it, updates it.
+	if err := os.Mkdir(filepath.Join(dir, "pkg"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if err := os.WriteFile(logPath, []byte(watchTestAccept("pkg/gen.go", `func generated() {\n}`)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "pkg", "gen.go"), []byte("package pkg\n\nfunc generated() {\n}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	waitForUpdate()
+	if lines := readWatchTestBlaim(t, outPath)["pkg/gen.go"]; len(lines) != 1 {
+		t.Errorf("expected pkg/gen.go to be attributed, got %v", lines)
+	}
+
+	close(stop)
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+}
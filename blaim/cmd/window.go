@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// timeFlagLayouts are the absolute time formats accepted by --since and --until.
+var timeFlagLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// parseTimeFlag parses the value of a --since or --until flag. Values may be
+// absolute times in one of timeFlagLayouts (interpreted in local time unless
+// they include a zone), or a duration such as "36h", meaning that long before now.
+func parseTimeFlag(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+	for _, layout := range timeFlagLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognized time %q: use a duration like 24h, or a time like 2006-01-02 15:04:05", value)
+}
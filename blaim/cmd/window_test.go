@@ -0,0 +1,60 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTimeFlag(t *testing.T) {
+	now := time.Date(2024, 6, 10, 12, 0, 0, 0, time.UTC)
+	for _, test := range []struct {
+		value       string
+		expected    time.Time
+		expectError bool
+	}{
+		{value: "", expected: time.Time{}},
+		{value: "24h", expected: now.Add(-24 * time.Hour)},
+		{value: "2024-06-09T10:00:00Z", expected: time.Date(2024, 6, 9, 10, 0, 0, 0, time.UTC)},
+		{value: "2024-06-09 10:00:00", expected: time.Date(2024, 6, 9, 10, 0, 0, 0, time.Local)},
+		{value: "2024-06-09", expected: time.Date(2024, 6, 9, 0, 0, 0, 0, time.Local)},
+		{value: "yesterday", expectError: true},
+	} {
+		got, err := parseTimeFlag(test.value, now)
+		if test.expectError {
+			if err == nil {
+				t.Errorf("%q: expected an error, got %v", test.value, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", test.value, err)
+		}
+		if !got.Equal(test.expected) {
+			t.Errorf("%q: expected %v, got %v", test.value, test.expected, got)
+		}
+	}
+}
+
+func TestParentCommitTime(t *testing.T) {
+	dir, _ := newTestRepo(t, blaimFile("[]\n"), blaimFile("[]\n"))
+	// As after a rebase, HEAD was authored well before it was committed.
+	if _, err := gitOutput(dir, "-c", "user.name=Test", "-c", "user.email=test@example.com", "commit", "-q", "--amend", "--allow-empty", "--no-edit", "--date=2024-06-10T15:00:00Z"); err != nil {
+		t.Fatal(err)
+	}
+	authored := time.Date(2024, 6, 10, 15, 0, 0, 0, time.UTC)
+	got, err := parentCommitTime(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Equal(authored) {
+		t.Errorf("expected HEAD's author time %v, got %v", authored, got)
+	}
+	// Amending HEAD, the parent is HEAD~1.
+	got, err = parentCommitTime(dir, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.After(authored) {
+		t.Errorf("expected HEAD~1's author time, after %v, got %v", authored, got)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// isRepoRelative reports whether p is a relative path that stays inside the
+// repository. "" and "." are the repository root.
+func isRepoRelative(p string) bool {
+	if p == "" {
+		return true
+	}
+	if filepath.IsAbs(p) || strings.HasPrefix(p, "/") {
+		return false
+	}
+	clean := path.Clean(filepath.ToSlash(p))
+	return clean != ".." && !strings.HasPrefix(clean, "../")
+}
+
+// fileNameNormalizer resolves the file names in accept log entries, which the
+// editor records relative to the folder it was opened at, to paths relative to
+// the root of the git checkout, as they appear in git diff output.
+type fileNameNormalizer struct {
+	toplevel string
+	roots    []string
+	mappings []pathMapping
+	// exists reports whether a path relative to toplevel exists.
+	exists func(string) bool
+	// warn reports names that could be more than one file.
+	warn  func(format string, args ...any)
+	cache map[string]string
+}
+
+// newFileNameNormalizer returns a normalizer for the checkout at toplevel,
+// using the workspaces settings of c.
+func newFileNameNormalizer(toplevel string, c *config) *fileNameNormalizer {
+	n := &fileNameNormalizer{
+		toplevel: toplevel,
+		roots:    c.Workspaces.Roots,
+		mappings: c.Workspaces.Mappings,
+		warn:     log.Printf,
+		cache:    map[string]string{},
+	}
+	n.exists = func(p string) bool {
+		_, err := os.Stat(filepath.Join(toplevel, filepath.FromSlash(p)))
+		return err == nil
+	}
+	return n
+}
+
+// mapPrefix applies the first mapping whose From is a directory prefix of
+// fileName, and reports whether there was one.
+func (n *fileNameNormalizer) mapPrefix(fileName string) (string, bool) {
+	for _, m := range n.mappings {
+		from := strings.TrimSuffix(filepath.ToSlash(m.From), "/")
+		rest, ok := strings.CutPrefix(fileName, from)
+		if !ok || (rest != "" && !strings.HasPrefix(rest, "/")) {
+			continue
+		}
+		return path.Join(filepath.ToSlash(m.To), strings.TrimPrefix(rest, "/")), true
+	}
+	return "", false
+}
+
+// normalize returns fileName relative to the root of the checkout:
+//   - a name matching one of the mappings is rewritten by it;
+//   - an absolute name inside the checkout is made relative to it;
+//   - a relative name is resolved against the first of the workspace roots
+//     that has it, or else the root of the checkout. A name that more than
+//     one of them has is ambiguous, and is warned about once.
+//
+// Any other name is returned cleaned but otherwise unchanged.
+func (n *fileNameNormalizer) normalize(fileName string) string {
+	if ret, ok := n.cache[fileName]; ok {
+		return ret
+	}
+	ret := n.resolve(filepath.ToSlash(fileName))
+	n.cache[fileName] = ret
+	return ret
+}
+
+func (n *fileNameNormalizer) resolve(fileName string) string {
+	if fileName == "" {
+		// Entries recorded by blaim proxy don't name a file.
+		return ""
+	}
+	if mapped, ok := n.mapPrefix(fileName); ok {
+		return mapped
+	}
+	if path.IsAbs(fileName) {
+		toplevel := strings.TrimSuffix(filepath.ToSlash(n.toplevel), "/")
+		if rest, ok := strings.CutPrefix(fileName, toplevel+"/"); ok {
+			return path.Clean(rest)
+		}
+		return fileName
+	}
+	fileName = path.Clean(fileName)
+	candidates := []string{}
+	for _, root := range n.roots {
+		if candidate := path.Join(filepath.ToSlash(root), fileName); n.exists(candidate) {
+			candidates = append(candidates, candidate)
+		}
+	}
+	if n.exists(fileName) {
+		candidates = append(candidates, fileName)
+	}
+	if len(candidates) == 0 {
+		return fileName
+	}
+	if len(candidates) > 1 {
+		n.warn("accept log file name %s is ambiguous: it could be %s; using %s (add a workspaces mapping to choose)", fileName, strings.Join(candidates, " or "), candidates[0])
+	}
+	return candidates[0]
+}
+
+// acceptLogFileNames returns the function that normalizes accept log file
+// names for the checkout at --root.
+func acceptLogFileNames() func(string) string {
+	toplevel, err := filepath.Abs(repoRoot(baseDir))
+	if err != nil {
+		toplevel = repoRoot(baseDir)
+	}
+	return newFileNameNormalizer(toplevel, cfg).normalize
+}
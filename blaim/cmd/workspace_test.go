@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/banksean/me3/blaim"
+)
+
+func TestFileNameNormalizer(t *testing.T) {
+	toplevel := t.TempDir()
+	for _, p := range []string{"README.md", "journ/README.md", "blaim/vscode-extension/playground.js", "blaim/vscode-extension/src/extension.ts", "journ/main.go"} {
+		if err := os.MkdirAll(filepath.Join(toplevel, filepath.Dir(p)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(toplevel, p), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c := defaultConfig()
+	c.Workspaces.Roots = []string{"journ", "blaim/vscode-extension"}
+	c.Workspaces.Mappings = []pathMapping{
+		{From: "extension/", To: "blaim/vscode-extension"},
+		{From: "/home/other/me3", To: ""},
+	}
+	n := newFileNameNormalizer(toplevel, c)
+	warnings := []string{}
+	n.warn = func(format string, args ...any) { warnings = append(warnings, fmt.Sprintf(format, args...)) }
+	for fileName, expected := range map[string]string{
+		// The workspace roots come before the root of the checkout.
+		"README.md":                            "journ/README.md",
+		"playground.js":                        "blaim/vscode-extension/playground.js",
+		"./src/extension.ts":                   "blaim/vscode-extension/src/extension.ts",
+		"main.go":                              "journ/main.go",
+		"blaim/vscode-extension/playground.js": "blaim/vscode-extension/playground.js",
+		toplevel + "/journ/main.go":            "journ/main.go",
+		"extension/playground.js":              "blaim/vscode-extension/playground.js",
+		"extensions/playground.js":             "extensions/playground.js",
+		"/home/other/me3/journ/main.go":        "journ/main.go",
+		"/elsewhere/main.go":                   "/elsewhere/main.go",
+		"deleted.js":                           "deleted.js",
+	} {
+		if got := n.normalize(fileName); got != expected {
+			t.Errorf("%s: expected %q, got %q", fileName, expected, got)
+		}
+	}
+	n.normalize("README.md")
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "journ/README.md or README.md") {
+		t.Errorf("expected one warning that README.md is ambiguous, got %q", warnings)
+	}
+}
+
+func TestWorkspacesConfigErrors(t *testing.T) {
+	dir := t.TempDir()
+	for name, contents := range map[string]string{
+		".blaimrc":      "workspaces:\n  roots: [../other]\n",
+		".blaimrc.yml":  "workspaces:\n  mappings:\n    - {from: /, to: src}\n",
+		".blaimrc.toml": "[[workspaces.mappings]]\nfrom = \"ext\"\nto = \"/abs\"\n",
+	} {
+		if _, err := loadConfig(writeConfigFile(t, dir, name, contents), dir); err == nil {
+			t.Errorf("%s: expected an error for %q", name, contents)
+		}
+	}
+}
+
+func TestCompactAcceptLogNormalized(t *testing.T) {
+	logText := `2024-06-10 15:42:00.000 [info] {"fileName":"playground.js","text":"attributed();"}` + "\n"
+	attributed := []*blaim.BlaimLine{{FileName: "blaim/vscode-extension/playground.js", Text: "attributed();"}}
+	normalize := func(fileName string) string { return "blaim/vscode-extension/" + fileName }
+	out := &bytes.Buffer{}
+	stats, err := compactAcceptLog(strings.NewReader(logText), out, attributed, normalize, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.attributed != 1 || out.Len() != 0 {
+		t.Errorf("expected the entry to be removed, got %+v and %q", stats, out.String())
+	}
+}
@@ -0,0 +1,217 @@
+package blaim
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/sourcegraph/go-diff/diff"
+	"gopkg.in/vmarkovtsev/go-lcss.v1"
+)
+
+// DefaultMinLCS is the default for Matcher.MinLCS.
+const DefaultMinLCS = 20
+
+// MinCompletionLength is the minimum length of the text of an EventCompleted
+// entry for it to match. Short completions, like a closing brace, appear in
+// most diffs whether or not they were accepted.
+const MinCompletionLength = DefaultMinLCS
+
+// Signer adds a Signature to BlaimLines.
+type Signer interface {
+	Sign(b *BlaimLine) error
+}
+
+// GenerateOptions controls how Generate reads the accept log and writes BlaimLines.
+type GenerateOptions struct {
+	AcceptLog AcceptLogOptions
+	// Matcher matches accept log entries against the text added by each hunk.
+	Matcher Matcher
+	// Signer, if non-nil, signs every BlaimLine that Generate writes.
+	Signer Signer
+	// Ignore, if non-nil, reports whether a file in the diff should be left
+	// out of the output, by its new name.
+	Ignore func(fileName string) bool
+}
+
+// HunkAdditions returns the text of just the lines added by a diff hunk body,
+// without their "+" prefixes. Diff hunks contain both additions and deletions,
+// but only additions can be attributed to accepted suggestions.
+func HunkAdditions(body string) string {
+	ret := []string{}
+	for _, line := range strings.Split(body, "\n") {
+		if strings.HasPrefix(line, "+") {
+			ret = append(ret, line[1:])
+		}
+	}
+	return strings.Join(ret, "\n")
+}
+
+// acceptKey identifies an accepted suggestion independently of where it
+// ended up in the file.
+type acceptKey struct {
+	fileName        string
+	text            string
+	inferenceConfig InferenceConfig
+}
+
+// Generate parses the accept log, compares its contents to a git diff and
+// writes a JSON array of BlaimLines for each file in the diff that contains
+// text that appears in the accept log. Only accept log entries within
+// opts.AcceptLog.Window are considered. The returned report describes how the
+// accept log was used.
+func Generate(diffStream, logReader io.Reader, out io.Writer, opts GenerateOptions) (*AcceptLogReport, error) {
+	diffReader := diff.NewMultiFileDiffReader(diffStream)
+
+	acceptsForFile, report, err := ReadAttributableAccepts(logReader, opts.AcceptLog)
+	if err != nil {
+		return report, fmt.Errorf("error processing accept log: %v", err)
+	}
+	used := map[acceptKey]bool{}
+
+	// Read the git diff output and check for blaim entries for each file mentioned
+	// in the diff.
+	for {
+		fdiff, err := diffReader.ReadFile()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return report, fmt.Errorf("err reading diff: %s", err)
+		}
+		// Strip the "a/" and "b/" prefixes from the diff file names.
+		origName := fdiff.OrigName[2:]
+		newName := fdiff.NewName[2:]
+		if opts.Ignore != nil && opts.Ignore(newName) {
+			continue
+		}
+		accepts := acceptsForFile[origName]
+		// If the filename changed in this diff, group the accept logs for the
+		// old name and the new name together.
+		if newName != origName {
+			accepts = append(accepts, acceptsForFile[newName]...)
+		}
+		// Entries that don't name a file could be for any of them.
+		accepts = append(accepts, acceptsForFile[""]...)
+		blaimLines := []BlaimLine{}
+		// Now check each "hunk" in the diff'd file to see if there are any
+		// entries in the .blaim file about it.
+		for _, hunk := range fdiff.Hunks {
+			addedInDiffHunk := HunkAdditions(string(hunk.Body))
+			// Now find any acceptLog entriesd that match the added text.
+			matchingBlaimLines := opts.Matcher.MatchHunk(accepts, addedInDiffHunk)
+			// Offset the line numbers in the blaim entries by the start line of the hunk
+			// so they line up with the full file contents.
+			for _, match := range matchingBlaimLines {
+				match.Range.Start.Line += int(hunk.NewStartLine) + 1
+				match.Range.End.Line += int(hunk.NewStartLine) + 1
+				used[acceptKey{match.FileName, match.Text, match.InferenceConfig}] = true
+				// Attribute the lines to the file as it's named after the
+				// diff, even if the suggestion was accepted before a rename.
+				if match.FileName == "" || match.FileName == origName {
+					match.FileName = newName
+				}
+				blaimLines = append(blaimLines, match)
+			}
+		}
+		if len(blaimLines) == 0 {
+			continue
+		}
+		if opts.Signer != nil {
+			for i := range blaimLines {
+				if err := opts.Signer.Sign(&blaimLines[i]); err != nil {
+					return report, fmt.Errorf("error signing blaimLine: %v", err)
+				}
+			}
+		}
+		if err := WriteBlaimLines(out, blaimLines); err != nil {
+			return report, err
+		}
+	}
+	for _, accepts := range acceptsForFile {
+		for _, accept := range accepts {
+			if used[acceptKey{accept.FileName, accept.AttributedText(), accept.InferenceConfig}] {
+				report.Used++
+			}
+		}
+	}
+	return report, nil
+}
+
+func indexToPos(s string, i int) Position {
+	prefixLines := strings.Split(s[:i], "\n")
+	startLine := len(prefixLines) + 1
+	startChar := i - len(strings.Join(prefixLines[:len(prefixLines)-1], "\n"))
+	return Position{
+		Line:      startLine,
+		Character: startChar,
+	}
+}
+
+// Matcher matches accept log entries against the text added by diff hunks.
+// The zero Matcher uses the default thresholds.
+type Matcher struct {
+	// MinLCS is the minimum length of the longest common substring of an
+	// entry's text and a hunk for an inexact match. Zero means DefaultMinLCS.
+	MinLCS int
+}
+
+// MatchHunk matches accepts against addedInDiffHunk with the default Matcher.
+func MatchHunk(accepts []*AcceptLogLine, addedInDiffHunk string) []BlaimLine {
+	return Matcher{}.MatchHunk(accepts, addedInDiffHunk)
+}
+
+// MatchHunk returns a BlaimLine for each of accepts whose attributed text
+// appears in addedInDiffHunk, the text added by a diff hunk. Line numbers in
+// the returned ranges are relative to the start of the hunk. EventCompleted
+// entries only match exactly, and only if they're at least
+// MinCompletionLength long, since they may never have been accepted at all.
+//
+// Things to watch out for:
+// - The accept log text may not exactly match the diff text, so we need to do some fuzzy matching.
+// - The accept log text may span multiple lines, so we need to handle that.
+// - The line numbers in the accept log may not match the line numbers in the diff
+// - The user may have accepted suggstions in a different order than they appear in the diff
+func (m Matcher) MatchHunk(accepts []*AcceptLogLine, addedInDiffHunk string) []BlaimLine {
+	minLCS := m.MinLCS
+	if minLCS == 0 {
+		minLCS = DefaultMinLCS
+	}
+	blaimLines := []BlaimLine{}
+	for _, accept := range accepts {
+		targetString := accept.AttributedText()
+		startIdx := strings.Index(addedInDiffHunk, targetString)
+		endIdx := -1
+		if accept.EventType() == EventCompleted && (startIdx < 0 || len(targetString) < MinCompletionLength) {
+			continue
+		}
+		if startIdx >= 0 { // exact match
+			// the accepted text starts at lineOffset within the diff hunk, so count the newlines preceding the accepted text
+			endIdx = startIdx + len(targetString)
+		} else { // check for a fuzzy match
+			// Find the longest common substring between the diff hunk and the accept log text
+			targetString = string(lcss.LongestCommonSubstring([]byte(addedInDiffHunk), []byte(targetString)))
+			if len(targetString) < minLCS {
+				continue
+			}
+			startIdx = strings.Index(addedInDiffHunk, targetString)
+			endIdx = startIdx + len(targetString)
+		}
+		if endIdx == -1 { // no match
+			continue
+		}
+
+		startPos, endPos := indexToPos(addedInDiffHunk, startIdx), indexToPos(addedInDiffHunk, endIdx)
+		blaimLine := BlaimLine{
+			FileName: accept.FileName,
+			Range: Range{
+				Start: startPos,
+				End:   endPos,
+			},
+			Text:            accept.AttributedText(),
+			InferenceConfig: accept.InferenceConfig,
+		}
+		blaimLines = append(blaimLines, blaimLine)
+	}
+	return blaimLines
+}
@@ -0,0 +1,189 @@
+package blaim
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHunkAdditions(t *testing.T) {
+	body := " context\n-removed\n+added one\n+added two\n context\n"
+	if got := HunkAdditions(body); got != "added one\nadded two" {
+		t.Errorf("expected the added lines, got %q", got)
+	}
+}
+
+func TestMatchHunk(t *testing.T) {
+	added := "func a() {}\nfunc b() {\n\treturn 1\n}\n"
+	accepts := []*AcceptLogLine{
+		{FileName: "a.go", Text: "func b() {\n\treturn 1\n}", InferenceConfig: InferenceConfig{ModelName: "codegemma"}},
+		{FileName: "a.go", Text: "func c() {}"},
+	}
+	matches := MatchHunk(accepts, added)
+	if len(matches) != 1 {
+		t.Fatalf("expected 1 match, got %v", matches)
+	}
+	if matches[0].Range.Start.Line != 3 || matches[0].Range.End.Line != 5 || matches[0].InferenceConfig.ModelName != "codegemma" {
+		t.Errorf("unexpected match %+v", matches[0])
+	}
+}
+
+// generateTestDiff adds a function to playground.js, which generateTestLog
+// records being accepted.
+const (
+	generateTestDiff = `diff --git a/playground.js b/playground.js
+--- a/playground.js
++++ b/playground.js
+@@ -1,1 +1,4 @@
+ // playground
++function test() {
++  return 1;
++}
+`
+	generateTestLog = `2024-06-10 15:42:42.061 [info] {"fileName":"playground.js","text":"function test() {\n  return 1;\n}","inferenceConfig":{"modelName":"codegemma"}}`
+)
+
+func TestGenerateOutsideWindow(t *testing.T) {
+	out := &bytes.Buffer{}
+	opts := GenerateOptions{AcceptLog: AcceptLogOptions{Window: TimeWindow{Since: time.Date(2024, 6, 11, 0, 0, 0, 0, time.Local)}}}
+	if _, err := Generate(strings.NewReader(generateTestDiff), strings.NewReader(generateTestLog), out, opts); err != nil {
+		t.Errorf("error generating: %v", err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("expected no blaim lines for accepts outside the window, got %s", out.String())
+	}
+}
+
+func TestGenerateReport(t *testing.T) {
+	logText := generateTestLog + "\n" + `2024-06-10 15:43:00.000 [info] {"fileName":"playground.js","text":"this text is not in the diff at all"}`
+	report, err := Generate(strings.NewReader(generateTestDiff), strings.NewReader(logText), &bytes.Buffer{}, GenerateOptions{})
+	if err != nil {
+		t.Fatalf("error generating: %v", err)
+	}
+	if report.Parsed != 2 || report.Used != 1 {
+		t.Errorf("expected 2 parsed and 1 used, got %+v", report)
+	}
+
+	out := &bytes.Buffer{}
+	report.Write(out)
+	expected := "accept log: 1 used, 1 unused, 0 ignored, 0 outside time window, 0 skipped, 0 failed\n"
+	if out.String() != expected {
+		t.Errorf("expected %q, got %q", expected, out.String())
+	}
+}
+
+type testSigner struct{}
+
+func (testSigner) Sign(b *BlaimLine) error {
+	b.Signature = &Signature{Format: SignatureEd25519, Value: "signed"}
+	return nil
+}
+
+func TestGenerateSigns(t *testing.T) {
+	diffText := `diff --git a/a.go b/a.go
+--- a/a.go
++++ b/a.go
+@@ -1,1 +1,2 @@
+ package a
++func b() { return }
+`
+	logText := `2024-06-10 15:40:00.000 [info] {"fileName":"a.go","text":"func b() { return }"}`
+	out := &bytes.Buffer{}
+	report, err := Generate(strings.NewReader(diffText), strings.NewReader(logText), out, GenerateOptions{Signer: testSigner{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Used != 1 {
+		t.Errorf("expected 1 used entry, got %+v", report)
+	}
+	blaimLinesByFile, err := ReadBlaimFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := blaimLinesByFile["a.go"]
+	if len(lines) != 1 || lines[0].Signature == nil || lines[0].Signature.Value != "signed" {
+		t.Errorf("expected 1 signed line, got %v", lines)
+	}
+}
+
+func TestMatcherMinLCS(t *testing.T) {
+	added := "total := price * quantity\n"
+	accepts := []*AcceptLogLine{{FileName: "a.go", Text: "total := price * qty"}}
+	if matches := MatchHunk(accepts, added); len(matches) != 0 {
+		t.Errorf("expected no match with the default MinLCS, got %v", matches)
+	}
+	if matches := (Matcher{MinLCS: 10}).MatchHunk(accepts, added); len(matches) != 1 {
+		t.Errorf("expected a fuzzy match with MinLCS 10, got %v", matches)
+	}
+}
+
+func TestGenerateWithoutFileName(t *testing.T) {
+	diffText := `diff --git a/a.go b/a.go
+--- a/a.go
++++ b/a.go
+@@ -1,1 +1,2 @@
+ package a
++func b() { return }
+diff --git a/c.go b/c.go
+--- a/c.go
++++ b/c.go
+@@ -1,1 +1,2 @@
+ package c
++func d() { return 1 }
+`
+	// As written by blaim proxy, which doesn't know which file a completion is for.
+	logText := `2024-06-10 15:40:00.000 [info] {"event":"completed","fileName":"","text":"func d() { return 1 }","promptHash":"ab12"}`
+	opts := GenerateOptions{AcceptLog: AcceptLogOptions{IncludeCompletions: true}}
+	out := &bytes.Buffer{}
+	report, err := Generate(strings.NewReader(diffText), strings.NewReader(logText), out, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Used != 1 {
+		t.Errorf("expected 1 used entry, got %+v", report)
+	}
+	blaimLinesByFile, err := ReadBlaimFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blaimLinesByFile) != 1 || len(blaimLinesByFile["c.go"]) != 1 || blaimLinesByFile["c.go"][0].FileName != "c.go" {
+		t.Errorf("expected 1 line attributed in c.go, got %v", blaimLinesByFile)
+	}
+}
+
+func TestMatchCompletions(t *testing.T) {
+	added := "total := price * quantity\n}\n"
+	completion := func(text string) []*AcceptLogLine {
+		return []*AcceptLogLine{{Event: EventCompleted, Text: text}}
+	}
+	if matches := MatchHunk(completion("total := price * quantity"), added); len(matches) != 1 {
+		t.Errorf("expected an exact match, got %v", matches)
+	}
+	// An accepted suggestion with this text would match inexactly.
+	if matches := MatchHunk(completion("total := price * quantity + tax"), added); len(matches) != 0 {
+		t.Errorf("expected completions not to match inexactly, got %v", matches)
+	}
+	if matches := MatchHunk(completion("}\n"), added); len(matches) != 0 {
+		t.Errorf("expected short completions not to match, got %v", matches)
+	}
+}
+
+func TestGenerateIgnoresCompletionsByDefault(t *testing.T) {
+	diffText := `diff --git a/a.go b/a.go
+--- a/a.go
++++ b/a.go
+@@ -1,1 +1,2 @@
+ package a
++func total() int { return 42 }
+`
+	logText := `2024-06-10 15:40:00.000 [info] {"event":"completed","fileName":"","text":"func total() int { return 42 }","promptHash":"ab12"}`
+	out := &bytes.Buffer{}
+	report, err := Generate(strings.NewReader(diffText), strings.NewReader(logText), out, GenerateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Ignored != 1 || report.Used != 0 || out.Len() != 0 {
+		t.Errorf("expected the completion to be ignored, got %+v and %q", report, out.String())
+	}
+}
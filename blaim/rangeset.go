@@ -0,0 +1,201 @@
+package blaim
+
+import "sort"
+
+// LineRange is an inclusive range of source lines.
+type LineRange struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// Len returns the number of lines in r, or 0 if r is empty.
+func (r LineRange) Len() int {
+	if r.End < r.Start {
+		return 0
+	}
+	return r.End - r.Start + 1
+}
+
+// MergeLineRanges returns the union of ranges as a sorted list of disjoint,
+// non-adjacent ranges. Empty ranges are dropped.
+func MergeLineRanges(ranges []LineRange) []LineRange {
+	sorted := make([]LineRange, 0, len(ranges))
+	for _, r := range ranges {
+		if r.Len() > 0 {
+			sorted = append(sorted, r)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Start < sorted[j].Start
+	})
+	ret := []LineRange{}
+	for _, r := range sorted {
+		if last := len(ret) - 1; last >= 0 && r.Start <= ret[last].End+1 {
+			ret[last].End = max(ret[last].End, r.End)
+			continue
+		}
+		ret = append(ret, r)
+	}
+	return ret
+}
+
+// SubtractLineRanges returns the lines in ranges that aren't in any of
+// removed, as a sorted list of disjoint ranges.
+func SubtractLineRanges(ranges, removed []LineRange) []LineRange {
+	removed = MergeLineRanges(removed)
+	ret := []LineRange{}
+	for _, r := range MergeLineRanges(ranges) {
+		// removed is sorted, so only the ranges that overlap r need looking at.
+		i := sort.Search(len(removed), func(i int) bool { return removed[i].End >= r.Start })
+		for ; i < len(removed) && removed[i].Start <= r.End; i++ {
+			if removed[i].Start > r.Start {
+				ret = append(ret, LineRange{Start: r.Start, End: removed[i].Start - 1})
+			}
+			r.Start = removed[i].End + 1
+		}
+		if r.Len() > 0 {
+			ret = append(ret, r)
+		}
+	}
+	return ret
+}
+
+// lineRange returns the lines that b covers.
+func lineRange(b *BlaimLine) LineRange {
+	return LineRange{Start: b.Range.Start.Line, End: b.Range.End.Line}
+}
+
+// intervalNode is a node of the interval tree in a BlaimRangeSet.
+type intervalNode struct {
+	line *BlaimLine
+	// index is the position of line in BlaimRangeSet.blaimLines, so query
+	// results can be returned in the order the lines were given.
+	index int
+	// maxEnd is the largest end line of any BlaimLine in the node's subtree.
+	maxEnd int
+}
+
+// BlaimRangeSet is the set of BlaimLines for a particular source file, which
+// can be queried by source line.
+//
+// The lines are indexed by an interval tree, so point and range queries take
+// O(log n + k) time for n lines and k results. The tree is an implicit
+// balanced binary search tree over the lines sorted by start line: the root of
+// the subtree nodes[lo:hi] is nodes[(lo+hi)/2].
+type BlaimRangeSet struct {
+	blaimLines []*BlaimLine
+	nodes      []intervalNode
+}
+
+// NewBlaimRangeSet returns a BlaimRangeSet of blaimLines, which should all
+// describe the same source file.
+func NewBlaimRangeSet(blaimLines []*BlaimLine) *BlaimRangeSet {
+	s := &BlaimRangeSet{
+		blaimLines: blaimLines,
+		nodes:      make([]intervalNode, len(blaimLines)),
+	}
+	for i, b := range blaimLines {
+		s.nodes[i] = intervalNode{line: b, index: i}
+	}
+	sort.SliceStable(s.nodes, func(i, j int) bool {
+		return s.nodes[i].line.Range.Start.Line < s.nodes[j].line.Range.Start.Line
+	})
+	s.computeMaxEnd(0, len(s.nodes))
+	return s
+}
+
+// computeMaxEnd fills in maxEnd for the subtree nodes[lo:hi], and returns it.
+func (s *BlaimRangeSet) computeMaxEnd(lo, hi int) int {
+	if lo >= hi {
+		return 0
+	}
+	mid := (lo + hi) / 2
+	n := &s.nodes[mid]
+	n.maxEnd = max(n.line.Range.End.Line, s.computeMaxEnd(lo, mid), s.computeMaxEnd(mid+1, hi))
+	return n.maxEnd
+}
+
+// visitOverlapping calls visit for each node in nodes[lo:hi] whose line
+// overlaps r.
+func (s *BlaimRangeSet) visitOverlapping(lo, hi int, r LineRange, visit func(intervalNode)) {
+	if lo >= hi {
+		return
+	}
+	mid := (lo + hi) / 2
+	n := s.nodes[mid]
+	if n.maxEnd < r.Start {
+		// Nothing in this subtree reaches r.
+		return
+	}
+	s.visitOverlapping(lo, mid, r, visit)
+	if n.line.Range.Start.Line > r.End {
+		// Everything to the right starts after r.
+		return
+	}
+	if n.line.Range.End.Line >= r.Start {
+		visit(n)
+	}
+	s.visitOverlapping(mid+1, hi, r, visit)
+}
+
+// Lines returns the BlaimLines in the set.
+func (s *BlaimRangeSet) Lines() []*BlaimLine {
+	return s.blaimLines
+}
+
+// ForSourceLine returns the BlaimLines that cover that line of the source file.
+func (s *BlaimRangeSet) ForSourceLine(lineNumber int) []*BlaimLine {
+	return s.Overlapping(lineNumber, lineNumber)
+}
+
+// Overlapping returns the BlaimLines that cover any of the source lines from
+// start to end, inclusive, in the order they were given to NewBlaimRangeSet.
+func (s *BlaimRangeSet) Overlapping(start, end int) []*BlaimLine {
+	found := []intervalNode{}
+	s.visitOverlapping(0, len(s.nodes), LineRange{Start: start, End: end}, func(n intervalNode) {
+		found = append(found, n)
+	})
+	sort.Slice(found, func(i, j int) bool {
+		return found[i].index < found[j].index
+	})
+	ret := make([]*BlaimLine, len(found))
+	for i, n := range found {
+		ret[i] = n.line
+	}
+	return ret
+}
+
+// Overlaps reports whether any BlaimLine covers any of the source lines from
+// start to end, inclusive.
+func (s *BlaimRangeSet) Overlaps(start, end int) bool {
+	overlaps := false
+	s.visitOverlapping(0, len(s.nodes), LineRange{Start: start, End: end}, func(intervalNode) {
+		overlaps = true
+	})
+	return overlaps
+}
+
+// Covered returns the source lines covered by the set's BlaimLines, as a
+// sorted list of disjoint ranges.
+func (s *BlaimRangeSet) Covered() []LineRange {
+	ranges := make([]LineRange, len(s.blaimLines))
+	for i, b := range s.blaimLines {
+		ranges[i] = lineRange(b)
+	}
+	return MergeLineRanges(ranges)
+}
+
+// Uncovered returns the lines from start to end, inclusive, that no BlaimLine
+// covers, as a sorted list of disjoint ranges.
+func (s *BlaimRangeSet) Uncovered(start, end int) []LineRange {
+	return SubtractLineRanges([]LineRange{{Start: start, End: end}}, s.Covered())
+}
+
+// LineCount returns the number of distinct source lines covered by the set's BlaimLines.
+func (s *BlaimRangeSet) LineCount() int {
+	count := 0
+	for _, r := range s.Covered() {
+		count += r.Len()
+	}
+	return count
+}
@@ -0,0 +1,101 @@
+package blaim
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func testRangeLine(start, end int) *BlaimLine {
+	return &BlaimLine{Range: Range{Start: Position{Line: start}, End: Position{Line: end}}}
+}
+
+func TestBlaimRangeSetLineCount(t *testing.T) {
+	s := NewBlaimRangeSet([]*BlaimLine{testRangeLine(10, 12), testRangeLine(1, 1), testRangeLine(11, 15), testRangeLine(13, 14)})
+	if got := s.LineCount(); got != 7 {
+		t.Errorf("expected 7 lines, got %d", got)
+	}
+}
+
+func TestBlaimRangeSetOverlapping(t *testing.T) {
+	a, b, c := testRangeLine(1, 3), testRangeLine(5, 5), testRangeLine(3, 8)
+	s := NewBlaimRangeSet([]*BlaimLine{a, b, c})
+	for _, test := range []struct {
+		start, end int
+		expected   []*BlaimLine
+	}{
+		{1, 1, []*BlaimLine{a}},
+		{3, 3, []*BlaimLine{a, c}},
+		{4, 6, []*BlaimLine{b, c}},
+		{8, 20, []*BlaimLine{c}},
+		{9, 20, []*BlaimLine{}},
+	} {
+		got := s.Overlapping(test.start, test.end)
+		if len(got) != len(test.expected) {
+			t.Errorf("%d-%d: expected %v, got %v", test.start, test.end, test.expected, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.expected[i] {
+				t.Errorf("%d-%d: expected %v, got %v", test.start, test.end, test.expected, got)
+			}
+		}
+		if s.Overlaps(test.start, test.end) != (len(test.expected) > 0) {
+			t.Errorf("%d-%d: expected Overlaps to be %v", test.start, test.end, len(test.expected) > 0)
+		}
+	}
+	if got := s.ForSourceLine(5); len(got) != 2 {
+		t.Errorf("expected 2 lines covering line 5, got %v", got)
+	}
+}
+
+// TestBlaimRangeSetOverlappingRandom checks the interval tree against a linear scan.
+func TestBlaimRangeSetOverlappingRandom(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	lines := []*BlaimLine{}
+	for i := 0; i < 200; i++ {
+		start := r.Intn(500)
+		lines = append(lines, testRangeLine(start, start+r.Intn(20)))
+	}
+	s := NewBlaimRangeSet(lines)
+	for i := 0; i < 500; i++ {
+		start := r.Intn(520)
+		end := start + r.Intn(10)
+		expected := []*BlaimLine{}
+		for _, b := range lines {
+			if b.Range.Start.Line <= end && start <= b.Range.End.Line {
+				expected = append(expected, b)
+			}
+		}
+		got := s.Overlapping(start, end)
+		if !reflect.DeepEqual(got, expected) {
+			t.Fatalf("%d-%d: expected %v, got %v", start, end, expected, got)
+		}
+		if s.Overlaps(start, end) != (len(expected) > 0) {
+			t.Fatalf("%d-%d: expected Overlaps to be %v", start, end, len(expected) > 0)
+		}
+	}
+}
+
+func TestMergeLineRanges(t *testing.T) {
+	got := MergeLineRanges([]LineRange{{10, 12}, {1, 1}, {13, 14}, {2, 3}, {20, 19}, {11, 11}})
+	expected := []LineRange{{1, 3}, {10, 14}}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestSubtractLineRanges(t *testing.T) {
+	got := SubtractLineRanges([]LineRange{{1, 10}, {20, 30}}, []LineRange{{3, 4}, {8, 22}, {25, 25}, {40, 50}})
+	expected := []LineRange{{1, 2}, {5, 7}, {23, 24}, {26, 30}}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	s := NewBlaimRangeSet([]*BlaimLine{testRangeLine(3, 5), testRangeLine(8, 8)})
+	got = s.Uncovered(1, 10)
+	expected = []LineRange{{1, 2}, {6, 7}, {9, 10}}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
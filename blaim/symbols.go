@@ -0,0 +1,102 @@
+package blaim
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+)
+
+// Symbol is a named region of a source file, such as a function, method or
+// type declaration.
+type Symbol struct {
+	Name      string `json:"name"`
+	Kind      string `json:"kind"`
+	StartLine int    `json:"startLine"`
+	EndLine   int    `json:"endLine"`
+}
+
+// SymbolExtractor finds the symbols declared in a source file. Implementations
+// for other languages can be added with RegisterSymbolExtractor.
+type SymbolExtractor interface {
+	Symbols(fileName string, src []byte) ([]Symbol, error)
+}
+
+// symbolExtractors maps file extensions (including the dot) to the extractor
+// used for files with that extension.
+var symbolExtractors = map[string]SymbolExtractor{}
+
+// RegisterSymbolExtractor makes e the extractor for files with extension ext,
+// including the dot, e.g. ".go". It is not safe to call concurrently with
+// SymbolExtractorFor, so call it from an init function.
+func RegisterSymbolExtractor(ext string, e SymbolExtractor) {
+	symbolExtractors[ext] = e
+}
+
+// SymbolExtractorFor returns the extractor registered for fileName's
+// extension, if there is one.
+func SymbolExtractorFor(fileName string) (SymbolExtractor, bool) {
+	e, ok := symbolExtractors[filepath.Ext(fileName)]
+	return e, ok
+}
+
+func init() {
+	RegisterSymbolExtractor(".go", goSymbolExtractor{})
+}
+
+// goSymbolExtractor finds top-level functions, methods and types in Go source.
+type goSymbolExtractor struct{}
+
+func (goSymbolExtractor) Symbols(fileName string, src []byte) ([]Symbol, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, fileName, src, parser.SkipObjectResolution)
+	if err != nil {
+		return nil, err
+	}
+	lines := func(n ast.Node) (int, int) {
+		return fset.Position(n.Pos()).Line, fset.Position(n.End()).Line
+	}
+	ret := []Symbol{}
+	for _, decl := range f.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			s := Symbol{Name: d.Name.Name, Kind: "func"}
+			if d.Recv != nil && len(d.Recv.List) > 0 {
+				s.Name = receiverTypeName(d.Recv.List[0].Type) + "." + d.Name.Name
+				s.Kind = "method"
+			}
+			s.StartLine, s.EndLine = lines(d)
+			ret = append(ret, s)
+		case *ast.GenDecl:
+			if d.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range d.Specs {
+				s := Symbol{Name: spec.(*ast.TypeSpec).Name.Name, Kind: "type"}
+				// Include the "type" keyword unless the declaration is grouped.
+				if d.Lparen.IsValid() {
+					s.StartLine, s.EndLine = lines(spec)
+				} else {
+					s.StartLine, s.EndLine = lines(d)
+				}
+				ret = append(ret, s)
+			}
+		}
+	}
+	return ret, nil
+}
+
+// receiverTypeName returns the name of a method receiver's type, e.g. "(*T)" or "T".
+func receiverTypeName(expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.StarExpr:
+		return "(*" + receiverTypeName(t.X) + ")"
+	case *ast.IndexExpr:
+		return receiverTypeName(t.X)
+	case *ast.IndexListExpr:
+		return receiverTypeName(t.X)
+	case *ast.Ident:
+		return t.Name
+	}
+	return "?"
+}
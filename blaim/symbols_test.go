@@ -0,0 +1,60 @@
+package blaim
+
+import "testing"
+
+const symbolsTestSource = `package example
+
+// T is a type.
+type T struct {
+	n int
+}
+
+type (
+	A int
+	B[K comparable] map[K]int
+)
+
+func (t *T) Inc() {
+	t.n++
+}
+
+func (b B[K]) Len() int { return len(b) }
+
+func helper() int {
+	x := 1
+	y := 2
+	return x + y
+}
+`
+
+func TestGoSymbolExtractor(t *testing.T) {
+	symbols, err := goSymbolExtractor{}.Symbols("example.go", []byte(symbolsTestSource))
+	if err != nil {
+		t.Fatalf("error extracting symbols: %v", err)
+	}
+	expected := []Symbol{
+		{Name: "T", Kind: "type", StartLine: 4, EndLine: 6},
+		{Name: "A", Kind: "type", StartLine: 9, EndLine: 9},
+		{Name: "B", Kind: "type", StartLine: 10, EndLine: 10},
+		{Name: "(*T).Inc", Kind: "method", StartLine: 13, EndLine: 15},
+		{Name: "B.Len", Kind: "method", StartLine: 17, EndLine: 17},
+		{Name: "helper", Kind: "func", StartLine: 19, EndLine: 23},
+	}
+	if len(symbols) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, symbols)
+	}
+	for i := range expected {
+		if symbols[i] != expected[i] {
+			t.Errorf("symbol %d: expected %+v, got %+v", i, expected[i], symbols[i])
+		}
+	}
+}
+
+func TestSymbolExtractorFor(t *testing.T) {
+	if _, ok := SymbolExtractorFor("dir/example.go"); !ok {
+		t.Errorf("expected a symbol extractor for .go files")
+	}
+	if _, ok := SymbolExtractorFor("example.js"); ok {
+		t.Errorf("expected no symbol extractor for .js files")
+	}
+}
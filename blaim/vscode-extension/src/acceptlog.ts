@@ -10,6 +10,14 @@ export interface AcceptLogLine {
   text: string;
   headGitCommit: any;
   inferenceConfig: any;
+  // One of "shown", "rejected", "partiallyAccepted" or "editedAfterAccept".
+  // Omitted for full accepts, which are the only events this extension logs
+  // so far; blaim stats reports acceptance rates as "n/a" until it logs more.
+  event?: string;
+  suggestionId?: string;
+  partialAcceptKind?: "word" | "line";
+  acceptedText?: string;
+  editedText?: string;
 }
 
 const accepts: AcceptLogLine[] = [];
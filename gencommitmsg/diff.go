@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// The changes a commit message can be generated for.
+const (
+	// diffStaged is what's in the index, i.e. what git commit is about to commit.
+	diffStaged = "staged"
+	// diffWorktree is every change to tracked files since HEAD, staged or not,
+	// i.e. what git commit -a would commit.
+	diffWorktree = "worktree"
+	// diffAmend is what's in the index compared to HEAD's parent, i.e. what
+	// git commit --amend is about to replace HEAD with.
+	diffAmend = "amend"
+	// diffRange is the changes in a revision range, e.g. main..HEAD.
+	diffRange = "range"
+)
+
+// emptyTree is the hash of git's empty tree, which the first commit is
+// compared against.
+const emptyTree = "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+
+// diffSource says which changes to generate a commit message for.
+type diffSource struct {
+	kind string
+	// revRange is the revision range for diffRange.
+	revRange string
+}
+
+// selectDiffSource works out which changes to describe from the flags. At most
+// one of staged, worktree, amend and revRange may be given. Otherwise, when run
+// as a prepare-commit-msg hook, it's the staged changes, or for git commit
+// --amend (which git passes as the commit source "commit" with the sha1
+// "HEAD"), the changes the amended commit will have; and when run by hand,
+// the working tree.
+func selectDiffSource(hookMode bool, commitSource, sha1 string, staged, worktree, amend bool, revRange string) (diffSource, error) {
+	selected := []diffSource{}
+	if staged {
+		selected = append(selected, diffSource{kind: diffStaged})
+	}
+	if worktree {
+		selected = append(selected, diffSource{kind: diffWorktree})
+	}
+	if amend {
+		selected = append(selected, diffSource{kind: diffAmend})
+	}
+	if revRange != "" {
+		selected = append(selected, diffSource{kind: diffRange, revRange: revRange})
+	}
+	switch {
+	case len(selected) > 1:
+		return diffSource{}, fmt.Errorf("-staged, -worktree, -amend and -range are mutually exclusive")
+	case len(selected) == 1:
+		return selected[0], nil
+	case hookMode && commitSource == commitSourceCommit && sha1 == "HEAD":
+		return diffSource{kind: diffAmend}, nil
+	case hookMode:
+		return diffSource{kind: diffStaged}, nil
+	}
+	return diffSource{kind: diffWorktree}, nil
+}
+
+// diffExcludes are pathspecs for files whose changes say little about a
+// commit, and would crowd out the ones that do.
+var diffExcludes = []string{":(exclude)go.mod", ":(exclude)go.sum", ":(exclude)*repositories.bzl"}
+
+// gitDiffArgs returns the arguments to git that diff src in the repository at
+// rootDir. hasParent says whether HEAD has a parent, which only matters for
+// diffAmend.
+func gitDiffArgs(rootDir string, src diffSource, hasParent bool) []string {
+	args := []string{"diff", "--no-color", "--no-ext-diff"}
+	switch src.kind {
+	case diffStaged:
+		args = append(args, "--cached")
+	case diffWorktree:
+		args = append(args, "HEAD")
+	case diffAmend:
+		parent := "HEAD~1"
+		if !hasParent {
+			parent = emptyTree
+		}
+		args = append(args, "--cached", parent)
+	case diffRange:
+		args = append(args, src.revRange)
+	}
+	return append(append(args, "--", rootDir), diffExcludes...)
+}
+
+// gitOutput runs git with the given arguments in dir and returns its stdout.
+func gitOutput(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = os.Environ()
+	out, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return "", fmt.Errorf("git %s: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", fmt.Errorf("git %s: %v", strings.Join(args, " "), err)
+	}
+	return string(out), nil
+}
+
+// getDiff returns the diff of src in the repository at rootDir.
+func getDiff(rootDir string, src diffSource) (string, error) {
+	hasParent := true
+	if src.kind == diffAmend {
+		_, err := gitOutput(rootDir, "rev-parse", "--verify", "-q", "HEAD~1")
+		hasParent = err == nil
+	}
+	return gitOutput(rootDir, gitDiffArgs(rootDir, src, hasParent)...)
+}
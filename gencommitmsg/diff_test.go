@@ -0,0 +1,116 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSelectDiffSource(t *testing.T) {
+	for _, test := range []struct {
+		name         string
+		hookMode     bool
+		commitSource string
+		sha1         string
+		staged       bool
+		worktree     bool
+		amend        bool
+		revRange     string
+		expected     diffSource
+		expectErr    bool
+	}{
+		{name: "by hand", expected: diffSource{kind: diffWorktree}},
+		{name: "hook", hookMode: true, expected: diffSource{kind: diffStaged}},
+		{name: "hook with -m", hookMode: true, commitSource: "message", expected: diffSource{kind: diffStaged}},
+		{name: "hook with --amend", hookMode: true, commitSource: commitSourceCommit, sha1: "HEAD", expected: diffSource{kind: diffAmend}},
+		{name: "hook with -c", hookMode: true, commitSource: commitSourceCommit, sha1: "0123abcd", expected: diffSource{kind: diffStaged}},
+		{name: "-worktree in hook", hookMode: true, worktree: true, expected: diffSource{kind: diffWorktree}},
+		{name: "-staged", staged: true, expected: diffSource{kind: diffStaged}},
+		{name: "-amend", amend: true, expected: diffSource{kind: diffAmend}},
+		{name: "-range", revRange: "main..HEAD", expected: diffSource{kind: diffRange, revRange: "main..HEAD"}},
+		{name: "-staged and -range", staged: true, revRange: "main..HEAD", expectErr: true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := selectDiffSource(test.hookMode, test.commitSource, test.sha1, test.staged, test.worktree, test.amend, test.revRange)
+			if test.expectErr {
+				if err == nil {
+					t.Errorf("expected an error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != test.expected {
+				t.Errorf("expected %v, got %v", test.expected, got)
+			}
+		})
+	}
+}
+
+func TestGitDiffArgs(t *testing.T) {
+	for _, test := range []struct {
+		src       diffSource
+		hasParent bool
+		expected  []string
+	}{
+		{diffSource{kind: diffStaged}, true, []string{"--cached"}},
+		{diffSource{kind: diffWorktree}, true, []string{"HEAD"}},
+		{diffSource{kind: diffAmend}, true, []string{"--cached", "HEAD~1"}},
+		{diffSource{kind: diffAmend}, false, []string{"--cached", emptyTree}},
+		{diffSource{kind: diffRange, revRange: "main..HEAD"}, true, []string{"main..HEAD"}},
+	} {
+		got := gitDiffArgs("/repo", test.src, test.hasParent)
+		expected := append(append(append([]string{"diff", "--no-color", "--no-ext-diff"}, test.expected...), "--", "/repo"), diffExcludes...)
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("%v: expected %q, got %q", test.src, expected, got)
+		}
+	}
+}
+
+func TestGetDiff(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	dir := t.TempDir()
+	git := func(args ...string) {
+		t.Helper()
+		if _, err := gitOutput(dir, append([]string{"-c", "user.name=Test", "-c", "user.email=test@example.com"}, args...)...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write := func(name, contents string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	git("init", "-q")
+	write("a.txt", "first\n")
+	git("add", "a.txt")
+	git("commit", "-q", "-m", "first")
+	write("a.txt", "second\n")
+	git("add", "a.txt")
+	write("a.txt", "third\n")
+
+	for _, test := range []struct {
+		src                  diffSource
+		contains, notContain string
+	}{
+		{diffSource{kind: diffStaged}, "+second\n", "+third\n"},
+		{diffSource{kind: diffWorktree}, "+third\n", "+second\n"},
+		// HEAD is the first commit, so amending it adds the file.
+		{diffSource{kind: diffAmend}, "+second\n", "-first\n"},
+	} {
+		got, err := getDiff(dir, test.src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(got, test.contains) || strings.Contains(got, test.notContain) {
+			t.Errorf("%s: expected %q and not %q in diff:\n%s", test.src.kind, test.contains, test.notContain, got)
+		}
+	}
+}
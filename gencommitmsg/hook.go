@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The commit sources that git passes to the prepare-commit-msg hook, as
+// described in githooks(5). An empty commit source means there's no message
+// yet, just git's commented instructions.
+const (
+	// commitSourceMessage is for a message given with -m or -F.
+	commitSourceMessage = "message"
+	// commitSourceTemplate is for a message from -t or commit.template.
+	commitSourceTemplate = "template"
+	// commitSourceMerge is for a merge, or .git/MERGE_MSG.
+	commitSourceMerge = "merge"
+	// commitSourceSquash is for git merge --squash, or .git/SQUASH_MSG.
+	commitSourceSquash = "squash"
+	// commitSourceCommit is for a message taken from an existing commit, with
+	// -c, -C or --amend.
+	commitSourceCommit = "commit"
+)
+
+// What to do with a message the commit already has, for -existing-message.
+const (
+	existingKeep    = "keep"
+	existingAugment = "augment"
+	existingReplace = "replace"
+)
+
+// hookAction is what to do with the commit message file.
+type hookAction int
+
+const (
+	// hookSkip leaves the message as it is.
+	hookSkip hookAction = iota
+	// hookWrite replaces the message with the generated one.
+	hookWrite
+	// hookAppend adds the generated message after the existing one.
+	hookAppend
+	// hookPrepend adds the generated message before the existing one.
+	hookPrepend
+)
+
+// scissors is the line, after the comment character, below which git
+// commit --verbose and --cleanup=scissors put text that isn't committed.
+const scissors = " ------------------------ >8 ------------------------"
+
+// commitMsg is the contents of a commit message file, split into what will be
+// committed and what git will strip.
+type commitMsg struct {
+	// message is the uncommented lines, without surrounding blank lines.
+	message string
+	// comments is the commented lines, in order, followed by everything from
+	// the scissors line on.
+	comments string
+}
+
+// parseCommitMsg splits the contents of a commit message file whose comments
+// start with commentChar.
+func parseCommitMsg(contents, commentChar string) commitMsg {
+	message, comments := &strings.Builder{}, &strings.Builder{}
+	lines := strings.SplitAfter(contents, "\n")
+	for i, line := range lines {
+		if strings.TrimRight(line, "\n") == commentChar+scissors {
+			comments.WriteString(strings.Join(lines[i:], ""))
+			break
+		}
+		if !strings.HasSuffix(line, "\n") && line != "" {
+			line += "\n"
+		}
+		if strings.HasPrefix(line, commentChar) {
+			comments.WriteString(line)
+		} else {
+			message.WriteString(line)
+		}
+	}
+	return commitMsg{message: strings.TrimSpace(message.String()), comments: comments.String()}
+}
+
+// selectHookAction decides what to do with the commit message file, given the
+// commit source git passed to the hook, the file's current contents and the
+// -existing-message mode.
+//
+// A merge keeps git's "Merge branch ..." subject and adds a summary of what's
+// merged, and a squash puts a summary before git's list of the squashed
+// commits. Otherwise, if there's already a message, e.g. from -m, a template
+// or the commit being amended, mode says whether to keep it, augment it or
+// replace it; and if there isn't, the generated one is written.
+func selectHookAction(commitSource string, existing commitMsg, mode string) (hookAction, error) {
+	switch mode {
+	case existingKeep, existingAugment, existingReplace:
+	default:
+		return hookSkip, fmt.Errorf("invalid -existing-message %q: expected %s, %s or %s", mode, existingKeep, existingAugment, existingReplace)
+	}
+	if existing.message == "" || mode == existingReplace {
+		return hookWrite, nil
+	}
+	switch commitSource {
+	case commitSourceMerge:
+		return hookAppend, nil
+	case commitSourceSquash:
+		return hookPrepend, nil
+	}
+	if mode == existingAugment {
+		return hookAppend, nil
+	}
+	return hookSkip, nil
+}
+
+// generatorInput returns what to ask the generator to describe: the diff, and
+// for merges and squashes, the commits being merged or squashed, as mergeLog
+// and the squash message respectively.
+func generatorInput(commitSource string, existing commitMsg, diff, mergeLog string) string {
+	switch {
+	case commitSource == commitSourceMerge && mergeLog != "":
+		return "Summarize the changes merged by these commits:\n" + mergeLog + "\n" + diff
+	case commitSource == commitSourceSquash && existing.message != "":
+		return "Summarize the changes made by these squashed commits:\n" + existing.message + "\n\n" + diff
+	}
+	return diff
+}
+
+// composeCommitMsg returns the new contents of the commit message file, with
+// the generated message placed according to action and git's comments kept
+// after it.
+func composeCommitMsg(action hookAction, existing commitMsg, generated string) string {
+	generated = strings.TrimSpace(generated)
+	msg := generated
+	switch action {
+	case hookSkip:
+		msg = existing.message
+	case hookAppend:
+		msg = existing.message + "\n\n" + generated
+	case hookPrepend:
+		msg = generated + "\n\n" + existing.message
+	}
+	ret := msg + "\n"
+	if existing.comments != "" {
+		ret += "\n" + existing.comments
+	}
+	return ret
+}
+
+// mergeLog returns a line for each commit that the merge in progress in the
+// repository at rootDir brings in.
+func mergeLog(rootDir string) (string, error) {
+	return gitOutput(rootDir, "log", "--no-merges", "--format=%h %s", "HEAD..MERGE_HEAD")
+}
+
+// commentChar returns the character that git starts comments in commit
+// messages with in the repository at rootDir. With core.commentChar set to
+// auto, git picks one that the message doesn't use, which is usually "#".
+func commentChar(rootDir string) string {
+	c, err := gitOutput(rootDir, "config", "--get", "core.commentChar")
+	c = strings.TrimSpace(c)
+	if err != nil || c == "" || c == "auto" {
+		return "#"
+	}
+	return c
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const gitTemplateComments = `# Please enter the commit message for your changes. Lines starting
+# with '#' will be ignored, and an empty message aborts the commit.
+#
+# On branch main
+`
+
+func TestParseCommitMsg(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		contents string
+		char     string
+		expected commitMsg
+	}{
+		{name: "empty"},
+		{name: "template", contents: "\n" + gitTemplateComments, char: "#", expected: commitMsg{comments: gitTemplateComments}},
+		{name: "message", contents: "Fix the thing\n\nBecause.\n" + gitTemplateComments, char: "#", expected: commitMsg{message: "Fix the thing\n\nBecause.", comments: gitTemplateComments}},
+		{name: "no trailing newline", contents: "Fix the thing\n# comment", char: "#", expected: commitMsg{message: "Fix the thing", comments: "# comment\n"}},
+		{name: "comment char", contents: "Fix #12\n; comment\n", char: ";", expected: commitMsg{message: "Fix #12", comments: "; comment\n"}},
+		{
+			name:     "scissors",
+			contents: "Fix\n# ------------------------ >8 ------------------------\n# Do not modify or remove the line above.\ndiff --git a/x b/x\n+added\n",
+			char:     "#",
+			expected: commitMsg{message: "Fix", comments: "# ------------------------ >8 ------------------------\n# Do not modify or remove the line above.\ndiff --git a/x b/x\n+added\n"},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if got := parseCommitMsg(test.contents, test.char); got != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, got)
+			}
+		})
+	}
+}
+
+func TestSelectHookAction(t *testing.T) {
+	withMessage := commitMsg{message: "Fix the thing", comments: gitTemplateComments}
+	commentsOnly := commitMsg{comments: gitTemplateComments}
+	for _, test := range []struct {
+		commitSource string
+		existing     commitMsg
+		mode         string
+		expected     hookAction
+	}{
+		{"", commentsOnly, existingKeep, hookWrite},
+		{commitSourceTemplate, commentsOnly, existingKeep, hookWrite},
+		{commitSourceTemplate, withMessage, existingKeep, hookSkip},
+		{commitSourceMessage, withMessage, existingKeep, hookSkip},
+		{commitSourceMessage, withMessage, existingAugment, hookAppend},
+		{commitSourceMessage, withMessage, existingReplace, hookWrite},
+		{commitSourceCommit, withMessage, existingKeep, hookSkip},
+		{commitSourceMerge, withMessage, existingKeep, hookAppend},
+		{commitSourceMerge, withMessage, existingReplace, hookWrite},
+		{commitSourceSquash, withMessage, existingKeep, hookPrepend},
+	} {
+		got, err := selectHookAction(test.commitSource, test.existing, test.mode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != test.expected {
+			t.Errorf("%q with message %q in %s mode: expected %v, got %v", test.commitSource, test.existing.message, test.mode, test.expected, got)
+		}
+	}
+	if _, err := selectHookAction("", commentsOnly, "overwrite"); err == nil {
+		t.Errorf("expected an error for an invalid mode")
+	}
+}
+
+func TestComposeCommitMsg(t *testing.T) {
+	existing := commitMsg{message: "Merge branch 'feature'", comments: "# Conflicts:\n#\tmain.go\n"}
+	for _, test := range []struct {
+		action   hookAction
+		expected string
+	}{
+		{hookWrite, "Add feature\n\n# Conflicts:\n#\tmain.go\n"},
+		{hookAppend, "Merge branch 'feature'\n\nAdd feature\n\n# Conflicts:\n#\tmain.go\n"},
+		{hookPrepend, "Add feature\n\nMerge branch 'feature'\n\n# Conflicts:\n#\tmain.go\n"},
+	} {
+		if got := composeCommitMsg(test.action, existing, "Add feature\n"); got != test.expected {
+			t.Errorf("%v: expected %q, got %q", test.action, test.expected, got)
+		}
+	}
+	if got, expected := composeCommitMsg(hookWrite, commitMsg{}, "Add feature"), "Add feature\n"; got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+}
+
+func TestGeneratorInput(t *testing.T) {
+	squash := commitMsg{message: "Squashed commit of the following:\n\ncommit 0123abcd"}
+	if got := generatorInput("", commitMsg{}, "diff", ""); got != "diff" {
+		t.Errorf("expected just the diff, got %q", got)
+	}
+	if got := generatorInput(commitSourceMerge, commitMsg{}, "diff", "0123abc Add feature\n"); !strings.Contains(got, "0123abc Add feature\n") || !strings.HasSuffix(got, "diff") {
+		t.Errorf("expected the merge log and the diff, got %q", got)
+	}
+	if got := generatorInput(commitSourceSquash, squash, "diff", ""); !strings.Contains(got, squash.message) || !strings.HasSuffix(got, "diff") {
+		t.Errorf("expected the squashed commits and the diff, got %q", got)
+	}
+}
+
+func TestMergeLog(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	dir := t.TempDir()
+	git := func(args ...string) {
+		t.Helper()
+		if _, err := gitOutput(dir, append([]string{"-c", "user.name=Test", "-c", "user.email=test@example.com"}, args...)...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	commit := func(name, msg string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(msg+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		git("add", name)
+		git("commit", "-q", "-m", msg)
+	}
+	git("init", "-q", "-b", "main")
+	commit("a.txt", "First")
+	git("checkout", "-q", "-b", "feature")
+	commit("b.txt", "Add b")
+	commit("c.txt", "Add c")
+	git("checkout", "-q", "main")
+	commit("d.txt", "Add d")
+	git("merge", "--no-commit", "--no-ff", "-q", "feature")
+
+	got, err := mergeLog(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(got, " Add b\n") || !strings.Contains(got, " Add c\n") || strings.Contains(got, "Add d") || strings.Contains(got, "First") {
+		t.Errorf("expected the commits on feature, got:\n%s", got)
+	}
+	if got := commentChar(dir); got != "#" {
+		t.Errorf("expected the default comment char, got %q", got)
+	}
+}
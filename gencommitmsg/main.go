@@ -6,9 +6,7 @@ import (
 	"errors"
 	"flag"
 	"fmt"
-	"io"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"reflect"
 	"time"
@@ -61,6 +59,11 @@ var (
 	commitMsgFilename = flag.String("commit-msg-file", "", "file to write the commit message to")
 	commitSrc         = flag.String("commit-source", "", "source of the commit message")
 	commitSHA1        = flag.String("sha1", "", "SHA1 of the commit")
+	staged            = flag.Bool("staged", false, "describe the staged changes; the default when run as a prepare-commit-msg hook")
+	worktree          = flag.Bool("worktree", false, "describe all changes to tracked files since HEAD, staged or not; the default when run by hand")
+	amend             = flag.Bool("amend", false, "describe the staged changes compared to HEAD~1, for amending HEAD")
+	revRange          = flag.String("range", "", "describe the changes in this revision range, e.g. main..HEAD")
+	existingMessage   = flag.String("existing-message", existingKeep, "what to do when the commit already has a message, e.g. from -m or --amend: keep, augment or replace it")
 	prompts           map[string]string
 )
 
@@ -205,45 +208,74 @@ func (g *openAIGenerator) GenerateCommitMessage(ctx context.Context, diff string
 	return res, err
 }
 
-func getDiff(rootDir string) (string, error) {
-	cmd := exec.Command("git", "diff", rootDir, ":(exclude)go.mod", ":(exclude)go.sum", ":(exclude)*repositories.bzl")
-	cmd.Dir = rootDir
-	cmd.Env = os.Environ()
-
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		return "", err
-	}
-	if err := cmd.Start(); err != nil {
-		return "", err
-	}
-
-	ret, err := io.ReadAll(stdout)
-	if err != nil {
-		return "", err
-	}
-
-	return string(ret), nil
-}
-
 func main() {
 	flag.Parse()
 	if *help {
 		flag.PrintDefaults()
 		os.Exit(0)
 	}
-	if len(os.Args) < 2 {
+	if flag.NArg() != 1 {
 		fmt.Fprintf(os.Stderr, "Usage: %s <path to git repository>\nOr alternatively: %s $(pwd) > .gitmessage && git commit\n", os.Args[0], os.Args[0])
 		os.Exit(1)
 	}
 
-	rootDir := os.Args[len(os.Args)-1]
+	rootDir := flag.Arg(0)
+
+	// git passes the name of the commit message file to the
+	// prepare-commit-msg hook, so that's how we know we're running as one.
+	hookMode := *commitMsgFilename != ""
+	var (
+		msgPath  string
+		existing commitMsg
+		action   = hookWrite
+	)
+	if hookMode {
+		// git passes the file's path relative to the top of the repository.
+		msgPath = *commitMsgFilename
+		if !filepath.IsAbs(msgPath) {
+			msgPath = filepath.Join(rootDir, msgPath)
+		}
+		contents, err := os.ReadFile(msgPath)
+		if err != nil && !os.IsNotExist(err) {
+			fmt.Fprintf(os.Stderr, "ReadFile error: %v\n", err)
+			os.Exit(1)
+		}
+		existing = parseCommitMsg(string(contents), commentChar(rootDir))
+		action, err = selectHookAction(*commitSrc, existing, *existingMessage)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		if action == hookSkip {
+			fmt.Fprintf(os.Stderr, "keeping the existing commit message\n")
+			os.Exit(0)
+		}
+	}
 
-	diff, err := getDiff(rootDir)
+	src, err := selectDiffSource(hookMode, *commitSrc, *commitSHA1, *staged, *worktree, *amend, *revRange)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	diff, err := getDiff(rootDir, src)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "getDiff error: %v\n", err)
 		os.Exit(1)
 	}
+	if diff == "" {
+		// e.g. git commit --allow-empty. Leave the message alone rather than
+		// have the model make something up.
+		fmt.Fprintf(os.Stderr, "no %s changes to describe\n", src.kind)
+		os.Exit(0)
+	}
+	log := ""
+	if hookMode && *commitSrc == commitSourceMerge {
+		log, err = mergeLog(rootDir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "mergeLog error: %v\n", err)
+			os.Exit(1)
+		}
+	}
 
 	ctx := context.Background()
 	var g Generator
@@ -265,14 +297,14 @@ func main() {
 		os.Exit(1)
 	}
 
-	msg, err := g.GenerateCommitMessage(ctx, diff)
+	msg, err := g.GenerateCommitMessage(ctx, generatorInput(*commitSrc, existing, diff, log))
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "GenerateCommitMessage error: %v\n", err)
 		os.Exit(1)
 	}
 
-	if *commitMsgFilename != "" {
-		err := os.WriteFile(filepath.Join(rootDir, *commitMsgFilename), []byte(msg), 0644)
+	if hookMode {
+		err := os.WriteFile(msgPath, []byte(composeCommitMsg(action, existing, msg)), 0644)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "WriteFile error: %v\n", err)
 			os.Exit(1)